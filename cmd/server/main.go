@@ -3,23 +3,53 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/drumil/system-design-mailer/internal/ai"
+	"github.com/drumil/system-design-mailer/internal/archive"
+	"github.com/drumil/system-design-mailer/internal/bounce"
 	"github.com/drumil/system-design-mailer/internal/config"
+	"github.com/drumil/system-design-mailer/internal/editorial"
+	"github.com/drumil/system-design-mailer/internal/jobs"
+	"github.com/drumil/system-design-mailer/internal/leader"
 	"github.com/drumil/system-design-mailer/internal/mailer"
+	"github.com/drumil/system-design-mailer/internal/newsletter"
+	"github.com/drumil/system-design-mailer/internal/scheduler"
 	"github.com/drumil/system-design-mailer/internal/store"
+	"github.com/drumil/system-design-mailer/internal/topics"
+	"github.com/drumil/system-design-mailer/internal/tracking"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// broadcastStopTimeout bounds how long shutdown waits for the message being
+// sent to finish before pausing a broadcast.
+const broadcastStopTimeout = time.Minute
+
 func main() {
+	dryRun := flag.Bool("dry-run", false, "generate and render today's issue for a sample of subscribers without sending, then exit")
+	dryRunSample := flag.Int("sample", 5, "number of subscribers to render in a dry run (0 for all)")
+	dryRunOut := flag.String("out", "", "directory for dry-run messages (default DATA_DIR/dry-run/<timestamp>)")
+	broadcastCmd := flag.String("broadcast", "", "control the running server's broadcast: status, pause, resume or cancel")
+	serverURL := flag.String("server", "", "server for -broadcast (default http://localhost:$PORT)")
+	flag.Parse()
+
 	// 0. Load .env file if present
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, relying on environment variables")
@@ -28,19 +58,33 @@ func main() {
 	// 1. Load Config
 	cfg := config.Load()
 
+	if *broadcastCmd != "" {
+		if err := runBroadcastCommand(cfg, *serverURL, *broadcastCmd); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// 2. Initialize Store
 	var subStore store.Store
+	var mongoDB *mongo.Database // set when running on MongoDB, shared by other collections
 	var err error
 
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "."
+	}
+
 	if mongoURI := os.Getenv("MONGO_URI"); mongoURI != "" {
 		log.Println("Initializing MongoDB store...")
-		subStore, err = store.NewMongoStore(mongoURI)
+		var ms *store.MongoStore
+		ms, err = store.NewMongoStore(mongoURI)
+		if err == nil {
+			mongoDB = ms.Database()
+			subStore = ms
+		}
 	} else {
 		log.Println("Initializing File store (local)...")
-		dataDir := os.Getenv("DATA_DIR")
-		if dataDir == "" {
-			dataDir = "."
-		}
 		if err := os.MkdirAll(dataDir, 0755); err != nil {
 			log.Printf("Warning: could not create data directory: %v", err)
 		}
@@ -52,13 +96,76 @@ func main() {
 		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
-	// 3. Initialize AI
-	aiClient, err := ai.NewContentGenerator(cfg.GeminiAPIKey)
+	// 3. Initialize AI. AI_PROVIDER is a comma-separated priority list,
+	// e.g. "gemini,openai" to fall back to a local model.
+	initialized := make(map[string]ai.Provider)
+	newProvider := func(name, setting string) ai.Provider {
+		if p, ok := initialized[name]; ok {
+			return p
+		}
+		var p ai.Provider
+		switch name {
+		case "gemini":
+			if cfg.GeminiAPIKey == "" {
+				log.Fatalf("%s includes gemini but GEMINI_API_KEY is not set", setting)
+			}
+			log.Println("Initializing Gemini provider...")
+			gp, err := ai.NewGeminiProvider(cfg.GeminiAPIKey, ai.Options{
+				Model:          cfg.GeminiModel,
+				Temperature:    cfg.GeminiTemperature,
+				MaxTokens:      cfg.GeminiMaxTokens,
+				EmbeddingModel: cfg.GeminiEmbeddingModel,
+			})
+			if err != nil {
+				log.Fatalf("Failed to initialize Gemini client: %v", err)
+			}
+			log.Printf("Gemini provider uses %s", gp.Model())
+			p = gp
+		case "openai":
+			log.Printf("Initializing OpenAI-compatible provider (%s at %s)...", cfg.OpenAIModel, cfg.OpenAIBaseURL)
+			p = ai.NewOpenAIProvider(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, ai.Options{
+				Model:          cfg.OpenAIModel,
+				Temperature:    cfg.OpenAITemperature,
+				MaxTokens:      cfg.OpenAIMaxTokens,
+				EmbeddingModel: cfg.OpenAIEmbeddingModel,
+			})
+		default:
+			log.Fatalf("Unknown AI provider %q in %s", name, setting)
+		}
+		initialized[name] = p
+		return p
+	}
+	var providers []ai.Provider
+	for _, name := range strings.Split(cfg.AIProvider, ",") {
+		providers = append(providers, newProvider(strings.TrimSpace(name), "AI_PROVIDER"))
+	}
+	aiClient, err := ai.NewContentGenerator(providers...)
 	if err != nil {
 		log.Fatalf("Failed to initialize AI client: %v", err)
 	}
+	aiClient.Structured = cfg.StructuredOutput
 	defer aiClient.Close()
 
+	// New articles are checked against recent issues' titles, and with
+	// DEDUP_EMBEDDINGS also their embeddings, so topics don't repeat
+	var embedder topics.Embedder
+	if cfg.DedupEmbeddings != "" {
+		_, shared := initialized[cfg.DedupEmbeddings]
+		p := newProvider(cfg.DedupEmbeddings, "DEDUP_EMBEDDINGS")
+		if !shared {
+			defer p.Close()
+		}
+		e, ok := p.(ai.Embedder)
+		if !ok {
+			log.Fatalf("AI provider %s can't compute embeddings", cfg.DedupEmbeddings)
+		}
+		embedder = e
+		log.Printf("Topic dedup compares %s embeddings", cfg.DedupEmbeddings)
+	}
+	deduper := topics.NewDeduper(cfg.DedupThreshold, embedder, cfg.DedupEmbeddingThreshold)
+	// Every attempt gets as long as a single generation used to
+	generateTimeout := time.Duration(max(cfg.DedupMaxAttempts, 1)) * 2 * time.Minute
+
 	// 4. Initialize Mailer (Gmail API)
 	// We read credentials from ENV or file
 	credsJSON := os.Getenv("GMAIL_CREDENTIALS_JSON")
@@ -75,85 +182,760 @@ func main() {
 		}
 	}
 
-	var emailSender interface {
-		Send(to []string, subject, bodyHTML string) error
+	// The Gmail token is obtained through /admin/oauth/gmail and kept in a
+	// token store so refreshes survive restarts
+	var gmailAuth *mailer.OAuth
+	if credsJSON != "" {
+		storeKind := cfg.GmailTokenStore
+		if storeKind == "" {
+			switch {
+			case os.Getenv("GMAIL_TOKEN_JSON") != "":
+				storeKind = "env"
+			case mongoDB != nil:
+				storeKind = "mongo"
+			default:
+				storeKind = "file"
+			}
+		}
+		var tokenStore mailer.TokenStore
+		switch storeKind {
+		case "env":
+			tokenStore = mailer.NewEnvTokenStore("GMAIL_TOKEN_JSON")
+		case "mongo":
+			if mongoDB == nil {
+				log.Fatal("GMAIL_TOKEN_STORE=mongo requires MONGO_URI")
+			}
+			tokenStore = mailer.NewMongoTokenStore(mongoDB, "gmail")
+		case "file":
+			tokenStore = mailer.NewFileTokenStore(cfg.GmailTokenFile)
+		default:
+			log.Fatalf("Unknown GMAIL_TOKEN_STORE %q", storeKind)
+		}
+
+		scopes := []string{mailer.GmailSendScope}
+		if cfg.SMTPAuth == "oauth2" {
+			// SMTP needs the full mail scope; the same token then serves both transports
+			scopes = []string{mailer.GoogleMailScope}
+		}
+		gmailAuth, err = mailer.NewGoogleOAuth([]byte(credsJSON), cfg.PublicURL+"/admin/oauth/gmail/callback", tokenStore, scopes...)
+		if err != nil {
+			log.Fatalf("Failed to initialize Gmail OAuth: %v", err)
+		}
+		if gmailAuth.Status().NeedsReauthorization {
+			log.Printf("Gmail is not authorized yet. Visit %s/admin/oauth/gmail?key=<CRON_SECRET> to grant access.", cfg.PublicURL)
+		}
 	}
 
-	if credsJSON != "" {
-		log.Println("Initializing Gmail API Mailer...")
-		gm, err := mailer.NewGmailMailer(context.Background(), cfg.SenderEmail, cfg.PublicURL, []byte(credsJSON))
+	var dkim *mailer.DKIMSigner
+	if cfg.DKIMDomain != "" && cfg.DKIMSelector != "" && cfg.DKIMPrivateKeyFile != "" {
+		dkim, err = mailer.LoadDKIMSigner(cfg.DKIMDomain, cfg.DKIMSelector, cfg.DKIMPrivateKeyFile)
 		if err != nil {
-			log.Fatalf("Failed to create Gmail client: %v", err)
+			log.Fatalf("Failed to load DKIM key: %v", err)
+		}
+		log.Printf("DKIM signing enabled for %s (selector %s)", cfg.DKIMDomain, cfg.DKIMSelector)
+	}
+
+	// MAIL_TRANSPORT is a comma-separated priority list, e.g. "gmail,smtp".
+	// By default Gmail is used when credentials exist, with SMTP as the
+	// fallback when an SMTP host is configured.
+	transportNames := cfg.MailTransport
+	if transportNames == "" {
+		transportNames = "smtp"
+		if credsJSON != "" {
+			transportNames = "gmail"
+			if cfg.SMTPHost != "" {
+				transportNames = "gmail,smtp"
+			}
 		}
-		emailSender = gm
+	}
+
+	var quotaStore mailer.QuotaStore
+	if mongoDB != nil {
+		quotaStore = mailer.NewMongoQuotaStore(mongoDB)
 	} else {
-		// Fallback to SMTP (will likely fail on Render, but keeps local dev simple if needed)
-		log.Println("No Gmail credentials found. Falling back to SMTP (Legacy)...")
-		emailSender = mailer.NewSMTPMailer(
-			cfg.SMTPHost,
-			cfg.SMTPPort,
-			cfg.SMTPUser,
-			cfg.SMTPPass,
-			cfg.SenderEmail,
-			cfg.PublicURL,
-		)
-	}
-
-	// 5. Define the Daily Job
-	dailyJob := func() {
-		log.Println("Starting daily newsletter generation...")
-		
-		subscribers, err := subStore.GetAll()
+		quotaStore = mailer.NewFileQuotaStore(fmt.Sprintf("%s/quota.json", dataDir))
+	}
+
+	var transports []mailer.Transport
+	var quotas []*mailer.QuotaMailer
+	var outbox http.Handler
+	for _, name := range strings.Split(transportNames, ",") {
+		name = strings.TrimSpace(name)
+		var m mailer.Mailer
+		switch name {
+		case "gmail":
+			if credsJSON == "" {
+				log.Fatal("MAIL_TRANSPORT includes gmail but no Gmail credentials were found")
+			}
+			log.Println("Initializing Gmail API Mailer...")
+			gm, err := mailer.NewGmailMailer(context.Background(), cfg.SenderEmail, cfg.PublicURL, gmailAuth)
+			if err != nil {
+				log.Fatalf("Failed to create Gmail client: %v", err)
+			}
+			gm.DKIM = dkim
+			m = gm
+		case "smtp":
+			// SMTP will likely fail on Render, but keeps local dev simple and works as a fallback
+			log.Println("Initializing SMTP Mailer...")
+			sm := mailer.NewSMTPMailer(
+				cfg.SMTPHost,
+				cfg.SMTPPort,
+				cfg.SMTPUser,
+				cfg.SMTPPass,
+				cfg.SenderEmail,
+				cfg.PublicURL,
+			)
+			sm.MaxMessagesPerConn = cfg.SMTPMaxMessagesPerConn
+			sm.IdleTimeout = cfg.SMTPIdleTimeout
+			sm.Timeout = cfg.SMTPTimeout
+			sm.DKIM = dkim
+			sm.BounceAddress = cfg.BounceAddress
+			switch cfg.SMTPAuth {
+			case "oauth2":
+				if gmailAuth == nil {
+					log.Fatal("SMTP_AUTH=oauth2 requires Google credentials (GMAIL_CREDENTIALS_JSON or credentials.json)")
+				}
+				sm.TokenSource = gmailAuth
+				if sm.Username == "" {
+					sm.Username = cfg.SenderEmail
+				}
+			case "password":
+			default:
+				log.Fatalf("Unknown SMTP_AUTH %q", cfg.SMTPAuth)
+			}
+			defer sm.Close()
+			m = sm
+		case "file":
+			// Local development: write messages to disk and browse them at /outbox/
+			log.Printf("Initializing File Mailer (writing to %s)...", cfg.MailDir)
+			fm, err := mailer.NewFileMailer(cfg.MailDir, cfg.MailDirFormat == "maildir", cfg.SenderEmail, cfg.PublicURL)
+			if err != nil {
+				log.Fatalf("Failed to create File mailer: %v", err)
+			}
+			fm.DKIM = dkim
+			m = fm
+			outbox = mailer.NewPreviewHandler(cfg.MailDir, "/outbox/")
+		case "sendgrid":
+			if cfg.SendGridAPIKey == "" {
+				log.Fatal("MAIL_TRANSPORT includes sendgrid but SENDGRID_API_KEY is not set")
+			}
+			log.Println("Initializing SendGrid Mailer...")
+			m = mailer.NewSendGridMailer(cfg.SendGridAPIKey, cfg.SenderEmail, cfg.PublicURL)
+		case "mailgun":
+			if cfg.MailgunAPIKey == "" || cfg.MailgunDomain == "" {
+				log.Fatal("MAIL_TRANSPORT includes mailgun but MAILGUN_API_KEY or MAILGUN_DOMAIN is not set")
+			}
+			log.Println("Initializing Mailgun Mailer...")
+			mg := mailer.NewMailgunMailer(cfg.MailgunAPIKey, cfg.MailgunDomain, cfg.SenderEmail, cfg.PublicURL)
+			mg.BaseURL = cfg.MailgunBaseURL
+			m = mg
+		case "postmark":
+			if cfg.PostmarkServerToken == "" {
+				log.Fatal("MAIL_TRANSPORT includes postmark but POSTMARK_SERVER_TOKEN is not set")
+			}
+			log.Println("Initializing Postmark Mailer...")
+			pm := mailer.NewPostmarkMailer(cfg.PostmarkServerToken, cfg.SenderEmail, cfg.PublicURL)
+			pm.MessageStream = cfg.PostmarkMessageStream
+			m = pm
+		case "ses":
+			if cfg.SESAccessKeyID == "" || cfg.SESSecretAccessKey == "" {
+				log.Fatal("MAIL_TRANSPORT includes ses but AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is not set")
+			}
+			log.Printf("Initializing SES Mailer (%s)...", cfg.SESRegion)
+			ses := mailer.NewSESMailer(cfg.SESRegion, cfg.SESAccessKeyID, cfg.SESSecretAccessKey, cfg.SenderEmail, cfg.PublicURL)
+			ses.SessionToken = cfg.SESSessionToken
+			ses.ConfigurationSet = cfg.SESConfigurationSet
+			m = ses
+		default:
+			log.Fatalf("Unknown mail transport %q", name)
+		}
+		if limit := cfg.MailQuotas[name]; limit > 0 {
+			qm := mailer.NewQuotaMailer(name, m, limit, quotaStore)
+			qm.WarnAt = float64(cfg.MailQuotaWarnPct) / 100
+			quotas = append(quotas, qm)
+			m = qm
+			log.Printf("Transport %s limited to %d messages per day", name, limit)
+		}
+		transports = append(transports, mailer.Transport{Name: name, Mailer: m})
+	}
+
+	var emailSender mailer.Mailer = transports[0].Mailer
+	var failover *mailer.FailoverMailer
+	if len(transports) > 1 {
+		failover = mailer.NewFailoverMailer(transports...)
+		failover.FailureThreshold = cfg.FailoverThreshold
+		failover.Cooldown = cfg.FailoverCooldown
+		emailSender = failover
+		log.Printf("Mail transports in priority order: %s", transportNames)
+	}
+
+	// Open and click tracking (opt-in per deployment, opt-out per subscriber)
+	var tracker *tracking.Tracker
+	if cfg.TrackingEnabled {
+		if cfg.TrackingSecret == "" {
+			log.Fatal("TRACKING_ENABLED requires TRACKING_SECRET (or CRON_SECRET) to sign links")
+		}
+		var events tracking.EventStore
+		if mongoDB != nil {
+			events, err = tracking.NewMongoEventStore(mongoDB)
+			if err != nil {
+				log.Fatalf("Failed to initialize tracking store: %v", err)
+			}
+		} else {
+			events = tracking.NewFileEventStore(fmt.Sprintf("%s/tracking_events.jsonl", dataDir))
+		}
+		tracker = tracking.NewTracker(cfg.TrackingSecret, cfg.PublicURL, events)
+		tracker.OptedOut = func(email string) bool {
+			sub, err := subStore.Get(email)
+			return err == nil && sub.TrackingOptOut
+		}
+		tracker.OnEvent = func(e tracking.Event) {
+			if e.Type != tracking.EventOpen {
+				return
+			}
+			sub, err := subStore.Get(e.Email)
+			if err != nil || !newsletter.UpdateStreak(sub, e.IssueID) {
+				return
+			}
+			if err := subStore.Update(*sub); err != nil {
+				log.Printf("Failed to update streak for %s: %v", e.Email, err)
+			}
+		}
+		log.Println("Open and click tracking enabled")
+	}
+
+	tmpl, err := newsletter.LoadTemplate(cfg.NewsletterTemplate, cfg.PublicURL)
+	if err != nil {
+		log.Fatalf("Failed to load newsletter template: %v", err)
+	}
+
+	sender := &newsletter.Sender{Mailer: emailSender, Template: tmpl, Tracker: tracker}
+	if len(quotas) > 0 || cfg.DeliveryWindows {
+		// Recipients over every transport's quota wait for the next window,
+		// and with delivery windows, for their local delivery hour
+		if mongoDB != nil {
+			sender.Deferred = newsletter.NewMongoDeferredStore(mongoDB)
+		} else {
+			sender.Deferred = newsletter.NewFileDeferredStore(fmt.Sprintf("%s/deferred.json", dataDir))
+		}
+	}
+	if cfg.DeliveryWindows && !newsletter.ValidDeliveryHour(cfg.DefaultDeliveryHour) {
+		log.Fatalf("Invalid DEFAULT_DELIVERY_HOUR %d, must be 0-23", cfg.DefaultDeliveryHour)
+	}
+
+	// Pause, resume and cancel for the broadcast in progress, with progress
+	// persisted so a resumed broadcast skips everyone already sent to
+	var progressStore newsletter.ProgressStore
+	if mongoDB != nil {
+		progressStore = newsletter.NewMongoProgressStore(mongoDB)
+	} else {
+		progressStore = newsletter.NewFileProgressStore(fmt.Sprintf("%s/broadcasts.json", dataDir))
+	}
+	broadcasts := newsletter.NewBroadcastControl(progressStore)
+	sender.Control = broadcasts
+	if p, err := broadcasts.Unfinished(); err != nil {
+		log.Printf("Failed to check for unfinished broadcasts: %v", err)
+	} else if p != nil {
+		log.Printf("Broadcast of issue %s is %s with %d of %d delivered. Resume it at %s/admin/broadcast/resume?key=<CRON_SECRET>",
+			p.Issue.ID, p.State, len(p.Delivered), p.Total, cfg.PublicURL)
+	}
+
+	// Gates the broadcast after the seed list has received the issue
+	canary := newsletter.NewCanary(cfg.CanaryWindow, cfg.CanaryMaxHold)
+
+	// The most recent issue, used by the preview endpoint
+	var lastIssue atomic.Pointer[newsletter.Issue]
+
+	// Every generated issue is archived with how it was made and sent
+	var articles archive.Store
+	if mongoDB != nil {
+		articles = archive.NewMongoStore(mongoDB)
+	} else {
+		articles, err = archive.NewFileStore(filepath.Join(dataDir, "archive"))
+		if err != nil {
+			log.Fatalf("Failed to initialize article archive: %v", err)
+		}
+	}
+	if latest, err := articles.List(1); err != nil {
+		log.Printf("Failed to load the latest archived issue: %v", err)
+	} else if len(latest) > 0 {
+		issue := latest[0].Issue()
+		lastIssue.Store(&issue)
+	}
+	sender.OnDeferredSent = func(issue newsletter.Issue, result newsletter.Result) {
+		if err := articles.AddSent(issue.ID, result.Sent, len(result.Failed)); err != nil && !errors.Is(err, archive.ErrNotFound) {
+			log.Printf("Failed to update archive stats for issue %s: %v", issue.ID, err)
+		}
+	}
+
+	// Bounce and complaint reports disable dead addresses before each send
+	bounces := bounce.NewProcessor(subStore, cfg.BounceSoftLimit)
+	processBounceMailbox := func() {
+		if cfg.BounceMailbox == "" {
+			return
+		}
+		n, err := bounces.ProcessMailbox(cfg.BounceMailbox)
 		if err != nil {
-			log.Printf("Error fetching subscribers: %v", err)
+			log.Printf("Error processing bounce mailbox: %v", err)
 			return
 		}
+		log.Printf("Processed %d messages from bounce mailbox", n)
+	}
+
+	// The editorial calendar picks each day's category
+	calendar, err := editorial.Load(cfg.EditorialCalendar)
+	if err != nil {
+		log.Fatalf("Failed to load editorial calendar: %v", err)
+	}
+
+	// Issue IDs and calendar dates follow the schedule's time zone, not the
+	// host's, so a 7:00 run in Tokyo gets the Tokyo date
+	scheduleLoc, err := time.LoadLocation(cfg.ScheduleTimezone)
+	if err != nil {
+		log.Fatalf("Invalid SCHEDULE_TIMEZONE: %v", err)
+	}
+	today := func() time.Time { return time.Now().In(scheduleLoc) }
+
+	// generateIssue writes today's article on the calendar's topic,
+	// regenerating it if it repeats a recent issue
+	generateIssue := func(ctx context.Context) (archive.Article, error) {
+		now := today()
+		id := now.Format("2006-01-02")
+		plan := calendar.For(now)
+		if plan.Source != "" {
+			log.Printf("Editorial calendar for %s (%s): category %q, theme %q, from %s rule",
+				plan.Date, plan.Weekday, plan.Category, plan.Theme, plan.Source)
+		}
+
+		var recent []topics.Past
+		var exclusions []string
+		if cfg.DedupLookback > 0 {
+			past, err := articles.List(cfg.DedupLookback + 1)
+			if err != nil {
+				log.Printf("Failed to load recent issues for topic dedup: %v", err)
+			}
+			for _, a := range past {
+				if a.ID == id || a.Title == "" || len(recent) == cfg.DedupLookback {
+					continue
+				}
+				recent = append(recent, topics.Past{ID: a.ID, Title: a.Title, Embedding: a.Embedding})
+				exclusions = append(exclusions, a.Title)
+			}
+		}
+
+		var article ai.Article
+		var embedding []float32
+		var rejected []string
+		for attempt := 1; ; attempt++ {
+			log.Println("Generating content...")
+			var err error
+			embedding = nil
+			article, err = aiClient.GenerateArticle(ctx, plan.Instruction, exclusions)
+			if err != nil {
+				return archive.Article{}, err
+			}
+			if article.Title == "" || len(recent) == 0 {
+				break
+			}
+			var match *topics.Match
+			match, embedding, err = deduper.Check(ctx, article.Title, recent)
+			if err != nil {
+				log.Printf("Topic dedup: %v", err)
+			}
+			if match == nil {
+				break
+			}
+			if attempt >= cfg.DedupMaxAttempts {
+				log.Printf("Topic dedup: %q repeats %s, sending it anyway after %d attempts", article.Title, match, attempt)
+				break
+			}
+			log.Printf("Topic dedup: %q repeats %s, regenerating (attempt %d of %d)", article.Title, match, attempt+1, cfg.DedupMaxAttempts)
+			rejected = append(rejected, article.Title)
+			exclusions = append(exclusions, article.Title)
+		}
+
+		// The calendar's category wins; the model's fills in when the
+		// calendar leaves the choice open
+		category := plan.Category
+		if category == "" {
+			category = article.Category
+		}
+		subject := "Daily System Design Article - " + now.Format("Jan 02, 2006")
+		if article.Title != "" {
+			subject = "Daily System Design: " + article.Title
+		}
+
+		return archive.Article{
+			ID:           id,
+			Subject:      subject,
+			Title:        article.Title,
+			Category:     category,
+			Theme:        plan.Theme,
+			Summary:      article.Summary,
+			Markdown:     article.Markdown,
+			HTML:         article.HTML,
+			Prompt:       article.Prompt,
+			Override:     article.Override,
+			Provider:     article.Provider,
+			Model:        article.Model,
+			PromptTokens: article.PromptTokens,
+			OutputTokens: article.OutputTokens,
+			Rejected:     rejected,
+			Embedding:    embedding,
+			CreatedAt:    time.Now(),
+		}, nil
+	}
+
+	// withoutSeeds drops the seed list, which got the issue before the
+	// broadcast started, from subscribers. Seed sends aren't recorded in the
+	// broadcast progress, so a resumed broadcast needs this too.
+	isSeed := make(map[string]bool, len(cfg.SeedEmails))
+	for _, email := range cfg.SeedEmails {
+		isSeed[strings.ToLower(email)] = true
+	}
+	withoutSeeds := func(subscribers []store.Subscriber) []store.Subscriber {
+		if len(isSeed) == 0 {
+			return subscribers
+		}
+		rest := subscribers[:0:0]
+		for _, sub := range subscribers {
+			if !isSeed[strings.ToLower(sub.Email)] {
+				rest = append(rest, sub)
+			}
+		}
+		return rest
+	}
+
+	// sendCanary sends the issue to the seed list, waits out the canary
+	// window and returns the subscribers still to be sent to
+	sendCanary := func(issue newsletter.Issue, subscribers []store.Subscriber) ([]store.Subscriber, error) {
+		seeds := make([]store.Subscriber, 0, len(cfg.SeedEmails))
+		for _, email := range cfg.SeedEmails {
+			if sub, err := subStore.Get(email); err == nil {
+				seeds = append(seeds, *sub)
+			} else {
+				seeds = append(seeds, store.Subscriber{Email: email})
+			}
+		}
+
+		log.Printf("Sending issue %s to %d seed addresses...", issue.ID, len(seeds))
+		if err := sender.Send(issue, seeds).Err(); err != nil {
+			log.Printf("Error sending to seed list: %v", err)
+		}
+		canary.Begin(issue.ID)
+		log.Printf("Broadcast starts in %s. Hold or abort with a POST to %s/admin/canary/hold?key=<CRON_SECRET> or %s/admin/canary/abort?key=<CRON_SECRET>",
+			cfg.CanaryWindow, cfg.PublicURL, cfg.PublicURL)
+		if err := canary.Wait(context.Background()); err != nil {
+			return nil, err
+		}
+		return withoutSeeds(subscribers), nil
+	}
+
+	// Only the instance holding the daily job's lease runs it, so two
+	// instances (or an overlapping deploy) can't both send
+	var locker leader.Locker
+	if mongoDB != nil {
+		locker = leader.NewMongoLocker(mongoDB)
+	} else {
+		locker = leader.NewFileLocker(dataDir)
+	}
+	instanceID := leader.Owner()
+	var currentLease atomic.Pointer[leader.Lease]
+	asLeader := func(job jobs.Job) jobs.Job {
+		return func(run *jobs.Run) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			lease, err := leader.Acquire(ctx, locker, "daily-job", instanceID, cfg.LeaderLockTTL, func(error) {
+				// Another instance may take over; stop before sending more
+				canary.Abort("leader lease lost")
+				broadcasts.Cancel()
+			})
+			if errors.Is(err, leader.ErrNotAcquired) {
+				run.Skip("another instance holds the daily job lock")
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("unable to acquire daily job lock: %v", err)
+			}
+			currentLease.Store(lease)
+			defer func() {
+				currentLease.Store(nil)
+				lease.Release()
+			}()
+			return job(run)
+		}
+	}
+
+	// broadcast sends issue to subscribers under the broadcast control.
+	// With delivery windows, only those due now are sent to; the rest are
+	// queued until their local delivery hour. Recipients an earlier attempt
+	// delivered to or queued are left out, so a resumed broadcast doesn't
+	// queue them again.
+	broadcast := func(run *jobs.Run, issue newsletter.Issue, subscribers []store.Subscriber) error {
+		if lease := currentLease.Load(); lease != nil {
+			// Fencing: make sure no other instance took over while we
+			// were generating or waiting out the canary window
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := lease.Check(ctx)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("not sending issue %s, lock check failed (token %d): %v", issue.ID, lease.Token, err)
+			}
+		}
+		recipients := len(subscribers)
+		if err := broadcasts.Begin(issue, recipients); err != nil {
+			return fmt.Errorf("not sending issue %s: %v", issue.ID, err)
+		}
+		pending := broadcasts.Pending(issue.ID, subscribers)
+		skipped := recipients - len(pending)
+		subscribers = pending
+
+		if cfg.DeliveryWindows {
+			subscribers = sender.Schedule(issue, subscribers, time.Now(), cfg.DefaultDeliveryHour)
+		}
+		run.SetPhase("sending")
+		run.TrackProgress(func() (int, int) {
+			st := broadcasts.Status()
+			return st.Delivered + st.Queued, st.Total
+		})
+
+		log.Printf("Sending email to %d subscribers...", len(subscribers))
+		result := sender.Send(issue, subscribers)
+		// Counted over every attempt, so a resumed broadcast reports the
+		// whole issue
+		st := broadcasts.Status()
+		scheduled := max(st.Queued-len(result.Deferred), 0)
+		run.SetCounts(jobs.Counts{
+			Recipients: recipients,
+			Scheduled:  scheduled,
+			Sent:       result.Sent,
+			Failed:     len(result.Failed),
+			Deferred:   len(result.Deferred),
+			Skipped:    skipped + result.Skipped,
+		})
+		err := articles.SetStats(issue.ID, archive.Stats{
+			Recipients: recipients,
+			Sent:       st.Delivered,
+			Failed:     len(result.Failed),
+			Deferred:   len(result.Deferred),
+			Scheduled:  scheduled,
+		})
+		if err != nil && !errors.Is(err, archive.ErrNotFound) {
+			log.Printf("Failed to update archive stats for issue %s: %v", issue.ID, err)
+		}
+		if result.Cancelled {
+			broadcasts.End(newsletter.ErrBroadcastCancelled)
+			log.Printf("Broadcast of issue %s cancelled: %d sent, %d failed", issue.ID, result.Sent, len(result.Failed))
+			return newsletter.ErrBroadcastCancelled
+		}
+		broadcasts.End(nil)
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("error sending emails: %v", err)
+		}
+		log.Println("Daily newsletter sent successfully!")
+		return nil
+	}
+
+	// 5. Define the Daily Job. It only ever runs through runner, so a
+	// manual trigger during a scheduled run can't send the issue twice.
+	runner := jobs.NewRunner("Daily job")
+	runner.Instance = instanceID
+	if mongoDB != nil {
+		runner.History = jobs.NewMongoHistoryStore(mongoDB)
+	} else {
+		runner.History = jobs.NewFileHistoryStore(fmt.Sprintf("%s/job_runs.json", dataDir))
+	}
+	dailyRun := func(run *jobs.Run) error {
+		log.Println("Starting daily newsletter generation...")
+
+		run.SetPhase("bounces")
+		processBounceMailbox()
+
+		subscribers, err := subStore.ListActive()
+		if err != nil {
+			return fmt.Errorf("error fetching subscribers: %v", err)
+		}
 
 		if len(subscribers) == 0 {
-			log.Println("No subscribers to send to. Skipping.")
-			return
+			run.Skip("no subscribers")
+			return nil
+		}
+		if plan := calendar.For(today()); plan.Blackout {
+			run.Skip("blackout date: " + plan.Reason)
+			return nil
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		// Finish today's issue if its broadcast was paused or interrupted,
+		// rather than writing a new one
+		if p, err := broadcasts.Unfinished(); err != nil {
+			log.Printf("Failed to check for unfinished broadcasts: %v", err)
+		} else if p != nil && p.Issue.ID == today().Format("2006-01-02") {
+			log.Printf("Resuming today's unfinished broadcast of issue %s", p.Issue.ID)
+			run.SetIssue(p.Issue.ID)
+			lastIssue.Store(&p.Issue)
+			return broadcast(run, p.Issue, withoutSeeds(subscribers))
+		}
+
+		// Today's issue is archived under its date, so a second run the
+		// same day must not write and send a new one over it
+		id := today().Format("2006-01-02")
+		if a, err := articles.Get(id); err == nil && a.Sent() {
+			run.Skip("issue " + id + " was already sent today")
+			return nil
+		}
+
+		run.SetPhase("generating")
+		ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
 		defer cancel()
 
-		// Determine if we need to force a specific category based on the day of the week
-		var overrideInstruction string
-		weekday := time.Now().Weekday()
+		article, err := generateIssue(ctx)
+		if err != nil {
+			return fmt.Errorf("error generating article: %v", err)
+		}
+		if err := articles.Save(article); errors.Is(err, archive.ErrAlreadySent) {
+			run.Skip("issue " + article.ID + " was already sent today")
+			return nil
+		} else if err != nil {
+			log.Printf("Failed to archive issue %s: %v", article.ID, err)
+		}
+		issue := article.Issue()
+		lastIssue.Store(&issue)
+		run.SetIssue(issue.ID)
 
-		switch weekday {
-		case time.Monday, time.Tuesday, time.Wednesday, time.Thursday:
-			// 4 Days of LLD & SOLID
-			overrideInstruction = "STRICTLY generate an article from CATEGORY 3: Low-Level Design (LLD), Patterns & SOLID. Focus on Design Patterns (Factory, Strategy, Observer) or SOLID principles."
-			log.Printf("It's %s! Forcing 'LLD & SOLID' topic.", weekday)
+		if len(cfg.SeedEmails) > 0 {
+			run.SetPhase("canary")
+			subscribers, err = sendCanary(issue, subscribers)
+			if err != nil {
+				return fmt.Errorf("broadcast of issue %s stopped: %v", issue.ID, err)
+			}
+		}
 
-		case time.Friday, time.Saturday:
-			// 2 Days of HLD
-			overrideInstruction = "STRICTLY generate an article from CATEGORY 2: High-Level System Design (HLD). Pick a standard system design interview question (e.g., Rate Limiter, Chat App)."
-			log.Printf("It's %s! Forcing 'HLD' topic.", weekday)
+		return broadcast(run, issue, subscribers)
+	}
+	dailyJob := asLeader(dailyRun)
+
+	// Send deferred batches when they're due, from one instance at a time
+	if sender.Deferred != nil && !*dryRun {
+		deferredScheduler := scheduler.NewScheduler(cfg.DeferredCheckEvery, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			lease, err := leader.Acquire(ctx, locker, "deferred-sends", instanceID, cfg.LeaderLockTTL, nil)
+			cancel()
+			if errors.Is(err, leader.ErrNotAcquired) {
+				return
+			}
+			if err != nil {
+				log.Printf("Unable to acquire deferred sends lock: %v", err)
+				return
+			}
+			defer lease.Release()
+			if err := sender.SendDeferred(subStore, time.Now()); err != nil {
+				log.Printf("Error sending deferred recipients: %v", err)
+			}
+		})
+		deferredScheduler.Start()
+		defer deferredScheduler.Stop()
+	}
 
-		case time.Sunday:
-			// 1 Day of Real-World Systems
-			overrideInstruction = "STRICTLY generate a 'Real-World System Breakdown' (Case Study). Explain how a specific company (like Uber, Netflix, Discord) solved a specific scaling problem."
-			log.Printf("It's %s! Forcing 'Real-World Case Study' topic.", weekday)
+	// Run the daily job in-process on its cron schedule
+	var cron *scheduler.CronScheduler
+	if cfg.DailySchedule != "" && !*dryRun {
+		cron, err = scheduler.NewCronScheduler(cfg.DailySchedule, scheduleLoc, func() {
+			// The runner logs the outcome, including a run already in progress
+			runner.RunNow("schedule", dailyJob)
+		})
+		if err != nil {
+			log.Fatalf("Invalid DAILY_SCHEDULE: %v", err)
+		}
+		cron.Start()
+		defer cron.Stop()
+
+		var catchUpWithin time.Duration
+		if cfg.CatchUpPolicy != "once" && cfg.CatchUpPolicy != "skip" {
+			catchUpWithin, err = time.ParseDuration(cfg.CatchUpPolicy)
+			if err != nil || catchUpWithin <= 0 {
+				log.Fatalf("Invalid CATCHUP_POLICY %q: want once, skip or a duration like 6h", cfg.CatchUpPolicy)
+			}
+		}
+
+		// Check whether the last scheduled run was missed while the service
+		// was asleep or crashed, and catch up according to the policy
+		catchUp := asLeader(func(run *jobs.Run) error {
+			// Holding the lock means no other instance is mid-run, so any run
+			// still marked running died with its process
+			if n, err := jobs.MarkInterrupted(runner.History, runner.Name, run.ID()); err != nil {
+				log.Printf("Failed to update run history: %v", err)
+			} else if n > 0 {
+				log.Printf("Marked %d unfinished runs as interrupted", n)
+			}
+
+			scheduled := cron.Schedule.Prev(time.Now(), 8*24*time.Hour)
+			if scheduled.IsZero() {
+				run.Skip(jobs.SkipNotDue)
+				return nil
+			}
+			ran, err := jobs.RanSince(runner.History, runner.Name, run.ID(), scheduled)
+			if err != nil {
+				return fmt.Errorf("unable to read run history: %v", err)
+			}
+			if ran {
+				run.Skip(jobs.SkipNotDue)
+				return nil
+			}
+
+			late := time.Since(scheduled).Round(time.Minute)
+			switch {
+			case cfg.CatchUpPolicy == "skip":
+				run.Skip(fmt.Sprintf("missed the run scheduled for %s; CATCHUP_POLICY=skip", scheduled.Format(time.RFC3339)))
+				return nil
+			case catchUpWithin > 0 && late > catchUpWithin:
+				run.Skip(fmt.Sprintf("missed the run scheduled for %s by %s, more than CATCHUP_POLICY=%s", scheduled.Format(time.RFC3339), late, cfg.CatchUpPolicy))
+				return nil
+			}
+			log.Printf("Catching up on the run scheduled for %s (%s late)", scheduled.Format(time.RFC3339), late)
+			return dailyRun(run)
+		})
+		if err := runner.Start("catch-up", catchUp); err != nil {
+			log.Printf("Failed to start catch-up check: %v", err)
 		}
+	}
 
-		log.Println("Generating content with Gemini...")
-		articleHTML, err := aiClient.GenerateArticle(ctx, overrideInstruction)
+	// runDryRun generates today's issue and saves the messages a sample of
+	// subscribers would get, without contacting any transport
+	runDryRun := func(sample int, outDir string) (*newsletter.DryRunReport, error) {
+		subscribers, err := subStore.ListActive()
 		if err != nil {
-			log.Printf("Error generating article: %v", err)
-			return
+			return nil, fmt.Errorf("unable to fetch subscribers: %v", err)
 		}
 
-		subject := "Daily System Design Article - " + time.Now().Format("Jan 02, 2006")
-		
-		log.Printf("Sending email to %d subscribers...", len(subscribers))
-		err = emailSender.Send(subscribers, subject, articleHTML)
+		ctx, cancel := context.WithTimeout(context.Background(), generateTimeout)
+		defer cancel()
+		article, err := generateIssue(ctx)
 		if err != nil {
-			log.Printf("Error sending emails: %v", err)
-		} else {
-			log.Println("Daily newsletter sent successfully!")
+			return nil, fmt.Errorf("unable to generate article: %v", err)
 		}
+		// Not stored as the latest issue: it was never sent
+		issue := article.Issue()
+
+		if outDir == "" {
+			outDir = filepath.Join(dataDir, "dry-run", time.Now().Format("20060102-150405"))
+		}
+		return sender.DryRun(issue, subscribers, newsletter.DryRunOptions{
+			Sample:    sample,
+			OutputDir: outDir,
+			Sender:    cfg.SenderEmail,
+			PublicURL: cfg.PublicURL,
+			DKIM:      dkim,
+		})
+	}
+
+	if *dryRun {
+		report, err := runDryRun(*dryRunSample, *dryRunOut)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return
 	}
 
 	// 7. HTTP Server for Subscriptions
@@ -161,6 +943,11 @@ func main() {
 	fs := http.FileServer(http.Dir("./public"))
 	http.Handle("/", fs)
 
+	if outbox != nil {
+		http.Handle("/outbox/", outbox)
+		log.Printf("Outbox viewer available at http://localhost:%s/outbox/", cfg.Port)
+	}
+
 	http.HandleFunc("/subscribe", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -168,7 +955,12 @@ func main() {
 		}
 
 		var req struct {
-			Email string `json:"email"`
+			Email    string `json:"email"`
+			Name     string `json:"name"`
+			Language string `json:"language"`
+			Ref      string `json:"ref"`
+			TimeZone string `json:"time_zone"`
+			Hour     *int   `json:"delivery_hour"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -179,6 +971,51 @@ func main() {
 			http.Error(w, "Invalid email address", http.StatusBadRequest)
 			return
 		}
+		req.TimeZone = strings.TrimSpace(req.TimeZone)
+		if req.TimeZone != "" {
+			if _, err := time.LoadLocation(req.TimeZone); err != nil {
+				http.Error(w, "Invalid time zone", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Hour != nil && !newsletter.ValidDeliveryHour(*req.Hour) {
+			http.Error(w, "Invalid delivery hour, must be 0-23", http.StatusBadRequest)
+			return
+		}
+
+		existing, err := subStore.Get(req.Email)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Failed to look up subscriber: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil && !existing.Active() {
+			// Only a confirmed opt-in brings back an address disabled by
+			// bounces, and nothing brings back one that reported spam
+			if existing.Status == store.StatusComplained {
+				log.Printf("Not resubscribing %s: the address reported the newsletter as spam", req.Email)
+			} else if cfg.CronSecret == "" {
+				log.Printf("Not resubscribing %s: CRON_SECRET is needed to sign the confirmation link", req.Email)
+			} else {
+				subject, body := newsletter.ResubscribeEmail(cfg.PublicURL, cfg.CronSecret, *existing)
+				if err := emailSender.Send([]string{req.Email}, subject, body); err != nil {
+					log.Printf("Failed to send resubscribe confirmation to %s: %v", req.Email, err)
+				} else {
+					log.Printf("Sent resubscribe confirmation to %s", req.Email)
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, "Check your inbox to confirm your subscription")
+			return
+		}
+
+		if existing != nil {
+			// Anyone can post any address here, so an existing subscriber's
+			// name, language and delivery time are never overwritten
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "Subscribed %s successfully", req.Email)
+			return
+		}
 
 		if err := subStore.Add(req.Email); err != nil {
 			log.Printf("Failed to add subscriber: %v", err)
@@ -186,11 +1023,75 @@ func main() {
 			return
 		}
 
+		// Optional personalization details, taken on first subscribe only
+		if req.Name != "" || req.Language != "" || req.Ref != "" || req.TimeZone != "" || req.Hour != nil {
+			sub, err := subStore.Get(req.Email)
+			if err == nil {
+				if req.Name != "" {
+					sub.Name = strings.TrimSpace(req.Name)
+				}
+				if req.Language != "" {
+					sub.Language = strings.TrimSpace(req.Language)
+				}
+				if req.Ref != "" && sub.ReferredBy == "" && req.Ref != newsletter.ReferralCode(req.Email) {
+					sub.ReferredBy = req.Ref
+				}
+				if req.TimeZone != "" {
+					sub.TimeZone = req.TimeZone
+				}
+				if req.Hour != nil {
+					sub.DeliveryHour = req.Hour
+				}
+				err = subStore.Update(*sub)
+			}
+			if err != nil {
+				log.Printf("Failed to save subscriber details: %v", err)
+			}
+		}
+
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Subscribed %s successfully", req.Email)
 		log.Printf("New subscriber: %s", req.Email)
 	})
 
+	// The emailed link opens a page whose button confirms, so link scanners
+	// that follow URLs in mail can't reactivate an address on their own
+	http.HandleFunc("/subscribe/confirm", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		email, token := r.FormValue("email"), r.FormValue("token")
+		sub, err := subStore.Get(email)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Failed to look up subscriber: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if sub == nil || sub.Status != store.StatusBounced || !newsletter.ValidResubscribeToken(cfg.CronSecret, *sub, token) {
+			http.Error(w, "This confirmation link is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<h1>Confirm your subscription</h1><form method="post"><input type="hidden" name="email" value="%s"><input type="hidden" name="token" value="%s"><button type="submit">Subscribe %s again</button></form>`,
+				html.EscapeString(email), html.EscapeString(token), html.EscapeString(email))
+			return
+		}
+
+		sub.Reactivate()
+		if err := subStore.Update(*sub); err != nil {
+			log.Printf("Failed to reactivate subscriber: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>Subscription confirmed</h1><p>%s will receive the newsletter again.</p>", html.EscapeString(email))
+		log.Printf("Subscriber reactivated by confirmation: %s", email)
+	})
+
 	http.HandleFunc("/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet { // Using GET for simple link clicking
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -214,25 +1115,497 @@ func main() {
 		log.Printf("Subscriber removed: %s", email)
 	})
 	
+	if tracker != nil {
+		http.Handle("/t/", tracker.OpenHandler("/t/"))
+		http.Handle("/r/", tracker.ClickHandler("/r/"))
+		http.Handle("/tracking/opt-out", tracker.OptOutHandler(func(email string) error {
+			sub, err := subStore.Get(email)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			if err != nil || sub.TrackingOptOut {
+				return err
+			}
+			sub.TrackingOptOut = true
+			return subStore.Update(*sub)
+		}))
+
+		http.HandleFunc("/admin/tracking", func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(cfg, w, r) {
+				return
+			}
+			var events []tracking.Event
+			var err error
+			if email := r.URL.Query().Get("email"); email != "" {
+				events, err = tracker.Events.ForSubscriber(email)
+			} else {
+				events, err = tracker.Events.ForIssue(r.URL.Query().Get("issue"))
+			}
+			if err != nil {
+				log.Printf("Failed to load tracking events: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"stats":  tracking.Summarize(events),
+				"events": events,
+			})
+		})
+	}
+
+	if gmailAuth != nil {
+		http.HandleFunc("/admin/oauth/gmail", func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(cfg, w, r) {
+				return
+			}
+			gmailAuth.StartHandler().ServeHTTP(w, r)
+		})
+		// Protected by the single-use state issued to the admin above
+		http.Handle("/admin/oauth/gmail/callback", gmailAuth.CallbackHandler())
+		http.HandleFunc("/admin/oauth/gmail/status", func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(cfg, w, r) {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(gmailAuth.Status())
+		})
+	}
+
+	// Preview the personalized body a subscriber would get for the latest
+	// issue (or a placeholder article before the first run)
+	http.HandleFunc("/admin/preview", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		issue := lastIssue.Load()
+		if issue == nil {
+			issue = &newsletter.Issue{
+				ID:      today().Format("2006-01-02"),
+				Subject: "Preview",
+				HTML:    "<h1>Sample article</h1><p>The next generated article will appear here.</p>",
+			}
+		}
+
+		email := r.URL.Query().Get("email")
+		sub, err := subStore.Get(email)
+		if errors.Is(err, store.ErrNotFound) {
+			// Show how the fallbacks look for an unknown or sparse record
+			sub = &store.Subscriber{Email: email}
+		} else if err != nil {
+			log.Printf("Failed to load subscriber for preview: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if r.URL.Query().Get("fields") != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tmpl.Fields(*issue, *sub))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(sender.Personalize(*issue, *sub)))
+	})
+
+	// Dry run: POST generates and renders today's issue for ?sample=N
+	// subscribers (default 5) in the background, as a run of the daily job so
+	// it never overlaps a real send; GET returns the last report
+	var lastDryRun atomic.Pointer[newsletter.DryRunReport]
+	http.HandleFunc("/admin/dry-run", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			report := lastDryRun.Load()
+			if report == nil {
+				http.Error(w, "No dry run yet", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+			return
+		case http.MethodPost:
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sample := 5
+		if v := r.URL.Query().Get("sample"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid sample", http.StatusBadRequest)
+				return
+			}
+			sample = n
+		}
+
+		err := runner.Start(jobs.TriggerDryRun, func(run *jobs.Run) error {
+			run.SetPhase("generating")
+			report, err := runDryRun(sample, "")
+			if err != nil {
+				return err
+			}
+			run.SetIssue(report.IssueID)
+			lastDryRun.Store(report)
+			log.Printf("Dry run of issue %s saved to %s", report.IssueID, report.OutputDir)
+			return nil
+		})
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, jobs.ErrAlreadyRunning) {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(runner.Status())
+	})
+
+	// Canary window controls: status, and POST to hold, release or abort,
+	// so a prefetched or scanned link can't change the state. ?reason= is
+	// logged with the state change.
+	http.HandleFunc("/admin/canary", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(canary.Status())
+	})
+	canaryActions := map[string]func(string) error{
+		"hold":    canary.Hold,
+		"release": canary.Release,
+		"abort":   canary.Abort,
+	}
+	for action, apply := range canaryActions {
+		http.HandleFunc("/admin/canary/"+action, func(w http.ResponseWriter, r *http.Request) {
+			if !authorized(cfg, w, r) {
+				return
+			}
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			reason := r.FormValue("reason")
+			if reason == "" {
+				reason = action + " requested by admin"
+			}
+			if err := apply(reason); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(canary.Status())
+		})
+	}
+
+	// Broadcast controls: status, and POST to pause, resume or cancel.
+	// Resume also restarts a broadcast that was paused or interrupted before
+	// a restart.
+	http.HandleFunc("/admin/broadcast", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(broadcasts.Status())
+	})
+	http.HandleFunc("/admin/broadcast/pause", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := broadcasts.Pause(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(broadcasts.Status())
+	})
+	http.HandleFunc("/admin/broadcast/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := broadcasts.Cancel(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(broadcasts.Status())
+	})
+	http.HandleFunc("/admin/broadcast/resume", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := broadcasts.Resume(); err != nil {
+			p, uerr := broadcasts.Unfinished()
+			if uerr != nil {
+				log.Printf("Failed to load unfinished broadcast: %v", uerr)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if p == nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			subscribers, err := subStore.ListActive()
+			if err != nil {
+				log.Printf("Error fetching subscribers: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			err = runner.Start("resume", asLeader(func(run *jobs.Run) error {
+				log.Printf("Resuming interrupted broadcast of issue %s", p.Issue.ID)
+				return broadcast(run, p.Issue, withoutSeeds(subscribers))
+			}))
+			if errors.Is(err, jobs.ErrAlreadyRunning) {
+				http.Error(w, "The daily job is running", http.StatusConflict)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(broadcasts.Status())
+	})
+
 	// Manual trigger endpoint for testing
 	http.HandleFunc("/trigger-now", func(w http.ResponseWriter, r *http.Request) {
-		// Basic security check (in real app, use auth)
-		inputKey := r.URL.Query().Get("key")
-		if cfg.CronSecret == "" {
-			log.Println("Error: CRON_SECRET is not set. Manual trigger disabled.")
-			http.Error(w, "Configuration error", http.StatusInternalServerError)
+		if !authorized(cfg, w, r) {
 			return
 		}
-		if inputKey != cfg.CronSecret {
-			log.Println("Auth failed: Invalid key provided")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Println("Manual trigger received. Starting daily job...")
+		if err := runner.Start("manual", dailyJob); errors.Is(err, jobs.ErrAlreadyRunning) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(runner.Status())
 			return
 		}
-		go dailyJob()
-		log.Println("Manual trigger received. Starting daily job...")
 		w.Write([]byte("Job triggered manually"))
 	})
 
+	// The daily job's cron schedule and its next ?n= run times (default 5)
+	http.HandleFunc("/admin/schedule", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if cron == nil {
+			http.Error(w, "No DAILY_SCHEDULE configured", http.StatusNotFound)
+			return
+		}
+		n := 5
+		if v := r.URL.Query().Get("n"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 100 {
+				n = parsed
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"schedule":  cron.Schedule.Expr,
+			"time_zone": cron.Schedule.Location.String(),
+			"next_runs": cron.NextRuns(n),
+		})
+	})
+
+	// Archived issues, newest first, without their bodies (?limit=, default 30)
+	http.HandleFunc("/admin/archive", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		limit := 30
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+				limit = parsed
+			}
+		}
+		list, err := articles.List(limit)
+		if err != nil {
+			log.Printf("Failed to list archived issues: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		summaries := make([]archive.Article, len(list))
+		for i, a := range list {
+			summaries[i] = a.Listing()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summaries)
+	})
+
+	// One archived issue (?id=): JSON by default, or the article alone with
+	// &format=html or &format=markdown
+	http.HandleFunc("/admin/archive/issue", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		a, err := articles.Get(r.URL.Query().Get("id"))
+		if errors.Is(err, archive.ErrNotFound) {
+			http.Error(w, "Issue not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load archived issue: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Query().Get("format") {
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, a.HTML)
+		case "markdown":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			fmt.Fprint(w, a.Markdown)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(a)
+		}
+	})
+
+	// What the editorial calendar has planned (?days=, default 30)
+	http.HandleFunc("/admin/calendar", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		days := 30
+		if v := r.URL.Query().Get("days"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 366 {
+				days = parsed
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(calendar.Upcoming(today(), days))
+	})
+
+	// Past runs of the daily job, newest first (?limit=, default 20)
+	http.HandleFunc("/admin/job/history", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+				limit = n
+			}
+		}
+		runs, err := runner.History.Recent(runner.Name, limit)
+		if err != nil {
+			log.Printf("Failed to load run history: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+	})
+
+	// Whether the daily job is running, its phase and progress, or how the
+	// last run ended
+	http.HandleFunc("/admin/job", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runner.Status())
+	})
+
+	// Inbound bounce webhook: POST the raw DSN/ARF message as the request body
+	http.HandleFunc("/webhooks/bounce", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(cfg, w, r) {
+			return
+		}
+		events, err := bounces.ProcessMessage(http.MaxBytesReader(w, r.Body, 10<<20))
+		if errors.Is(err, bounce.ErrNotReport) {
+			// Accept so the forwarding service doesn't retry
+			w.Write([]byte("Ignored: not a bounce or complaint report"))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to process bounce: %v", err)
+			http.Error(w, "Unable to process report", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	})
+
+	// Provider event webhooks are verified by their own signatures
+	if cfg.SendGridWebhookKey != "" {
+		wh, err := bounce.NewSendGridWebhook(cfg.SendGridWebhookKey)
+		if err != nil {
+			log.Fatalf("Failed to initialize SendGrid webhook: %v", err)
+		}
+		http.Handle("/webhooks/sendgrid", bounces.WebhookHandler(wh))
+	}
+	if cfg.MailgunWebhookKey != "" {
+		http.Handle("/webhooks/mailgun", bounces.WebhookHandler(bounce.NewMailgunWebhook(cfg.MailgunWebhookKey)))
+	}
+	if cfg.PostmarkWebhookUser != "" && cfg.PostmarkWebhookPass != "" {
+		http.Handle("/webhooks/postmark", bounces.WebhookHandler(bounce.NewPostmarkWebhook(cfg.PostmarkWebhookUser, cfg.PostmarkWebhookPass)))
+	}
+	if cfg.SESTopicARN != "" {
+		http.Handle("/webhooks/ses", bounces.WebhookHandler(bounce.NewSESWebhook(cfg.SESTopicARN)))
+	}
+
+	http.HandleFunc("/admin/bounces/process", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if cfg.BounceMailbox == "" {
+			http.Error(w, "BOUNCE_MAILBOX is not configured", http.StatusNotFound)
+			return
+		}
+		n, err := bounces.ProcessMailbox(cfg.BounceMailbox)
+		if err != nil {
+			log.Printf("Error processing bounce mailbox: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "Processed %d messages", n)
+	})
+
+	// Transport health and recent deliveries (only meaningful with failover)
+	http.HandleFunc("/admin/transports", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(cfg, w, r) {
+			return
+		}
+		if failover == nil && len(quotas) == 0 {
+			http.Error(w, "Failover is not enabled (single transport)", http.StatusNotFound)
+			return
+		}
+		usage := make([]mailer.QuotaUsage, 0, len(quotas))
+		for _, q := range quotas {
+			usage = append(usage, q.Usage())
+		}
+		status := map[string]interface{}{"quotas": usage}
+		if failover != nil {
+			status["transports"] = failover.Health()
+			status["deliveries"] = failover.Deliveries()
+		}
+		if sender.Deferred != nil {
+			pending, err := sender.Deferred.Pending()
+			if err != nil {
+				log.Printf("Failed to load deferred recipients: %v", err)
+			}
+			deferred := make(map[string]int, len(pending))
+			for _, d := range pending {
+				deferred[d.Issue.ID] += len(d.Emails)
+			}
+			status["deferred"] = deferred
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+
 	srv := &http.Server{Addr: ":" + cfg.Port}
 
 	// Graceful Shutdown
@@ -255,6 +1628,27 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Pause a broadcast in progress so it can be resumed, and let another
+	// instance take over the daily job straight away. The lease is only
+	// released once the send loop has stopped; otherwise it is left to
+	// expire so nobody resumes while a message may still be going out.
+	if lease := currentLease.Load(); lease != nil {
+		release := true
+		if broadcasts.Active() {
+			ctx, cancel := context.WithTimeout(context.Background(), broadcastStopTimeout)
+			if err := broadcasts.PauseAndWait(ctx); err != nil {
+				log.Printf("Broadcast did not stop in time, leaving the daily job lock to expire: %v", err)
+				release = false
+			} else {
+				log.Println("Paused the broadcast in progress; resume it at /admin/broadcast/resume")
+			}
+			cancel()
+		}
+		if release {
+			lease.Release()
+		}
+	}
+
 	log.Println("Server exited")
 }
 
@@ -263,3 +1657,56 @@ func isValidEmail(email string) bool {
 	re := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 	return re.MatchString(email)
 }
+
+// authorized checks the ?key= query parameter against CRON_SECRET and writes
+// the error response itself when the request is rejected.
+func authorized(cfg *config.Config, w http.ResponseWriter, r *http.Request) bool {
+	// Basic security check (in real app, use auth)
+	inputKey := r.URL.Query().Get("key")
+	if cfg.CronSecret == "" {
+		log.Println("Error: CRON_SECRET is not set. Admin endpoints disabled.")
+		http.Error(w, "Configuration error", http.StatusInternalServerError)
+		return false
+	}
+	if inputKey != cfg.CronSecret {
+		log.Println("Auth failed: Invalid key provided")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// runBroadcastCommand sends a broadcast control command to a running server
+// and prints the resulting status.
+func runBroadcastCommand(cfg *config.Config, server, command string) error {
+	switch command {
+	case "status", "pause", "resume", "cancel":
+	default:
+		return fmt.Errorf("unknown broadcast command %q (want status, pause, resume or cancel)", command)
+	}
+	if server == "" {
+		server = "http://localhost:" + cfg.Port
+	}
+	endpoint := strings.TrimRight(server, "/") + "/admin/broadcast"
+	if command != "status" {
+		endpoint += "/" + command
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+"?key="+url.QueryEscape(cfg.CronSecret), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s: %s", command, resp.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Print(string(body))
+	return nil
+}
@@ -0,0 +1,225 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// ContentGenerator writes the daily article with the first of its
+// providers that succeeds, and renders it as HTML.
+type ContentGenerator struct {
+	// Structured asks providers for JSON in ArticleSchema, which is
+	// validated and rendered through our templates, instead of free-form
+	// Markdown.
+	Structured bool
+
+	providers []Provider
+	md        goldmark.Markdown
+}
+
+// NewContentGenerator tries providers in order, so later ones act as
+// fallbacks.
+func NewContentGenerator(providers ...Provider) (*ContentGenerator, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("no AI providers configured")
+	}
+
+	// Configure Markdown parser with syntax highlighting
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle("dracula"), // Dark theme
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(
+			html.WithHardWraps(),
+			html.WithXHTML(),
+		),
+	)
+
+	return &ContentGenerator{
+		providers: providers,
+		md:        md,
+	}, nil
+}
+
+// Article is a generated article and how it was made.
+type Article struct {
+	Title string
+	// Category and Summary are only set by structured output.
+	Category string
+	Summary  string
+	Markdown string
+	HTML     string
+	// Prompt is the full prompt sent, including Override.
+	Prompt   string
+	Override string
+	Provider string
+	Completion
+}
+
+// GenerateArticle writes an article, steering clear of the exclusions,
+// which are titles of recently covered topics.
+func (c *ContentGenerator) GenerateArticle(ctx context.Context, overrideInstruction string, exclusions []string) (Article, error) {
+	prompt := `
+	You are a Senior Mentor and Technical Lead writing a daily educational newsletter for **college students and junior engineers**.
+	
+	Your goal is to explain complex software engineering concepts in a way that is **accessible, encouraging, and easy to understand**, while still being technically accurate. Avoid overly dense jargon; if you use a complex term, explain it simply first.
+	
+	Your task is to generate an article on a **randomly selected topic** from one of the following categories. Pick ONE category and one specific topic.
+
+	### CATEGORY 1: Core Distributed Systems Concepts
+	Explain a fundamental concept that powers modern systems.
+	- Examples: "Consistent Hashing", "CAP Theorem", "Load Balancing Algorithms", "Database Sharding vs Partitioning", "Raft Consensus (Simplified)", "Bloom Filters".
+	- Focus on: **Why do we need this?** (The problem it solves) and how it works conceptually.
+
+	### CATEGORY 2: High-Level System Design (HLD)
+	Architect a familiar application.
+	- Examples: "Design a URL Shortener", "Design Instagram's Feed", "Design a Chat Application", "Design a Rate Limiter".
+	- Focus on: The high-level components (DB, Cache, Server) and how data flows between them.
+
+	### CATEGORY 3: Low-Level Design (LLD), Patterns & SOLID
+	Zoom in on coding patterns, object-oriented design, and SOLID principles.
+	- Examples: "Understanding the Single Responsibility Principle", "Factory Pattern vs Abstract Factory", "Implementing an LRU Cache", "Thread Pools explained", "Observer Pattern in Real Life".
+	- Focus on: Clean code examples, class diagrams (text-based), and **why** a pattern is used.
+
+	### GUIDELINES:
+	1. **Tone**: **"The Smart Senior Student"**. Explain it like you are teaching a friend in the college library.
+		- **Simplify Complexity**: If explaining Raft or Consistent Hashing, DO NOT dump math. Use analogies (e.g., "Imagine a ring of servers..." or "Think of consensus like a group voting on where to eat lunch").
+	2. **Structure**:
+		- **Title**: Clear and descriptive.
+		- **The "Why"**: Start with a simple problem statement. (e.g., "Why does a standard hash function fail when we add a server?")
+		- **The "How" (Concept)**: Explain the solution using simple terms and diagrams (described in text).
+		- **Code / Architecture**: Show the structure. For LLD, provide **commented code** (Java or Go).
+		- **Real World**: Where is this actually used? (e.g., "DynamoDB uses this").
+	3. **Formatting**: Markdown. Use triple backticks for code.
+	
+	SURPRISE ME. Pick a topic that makes the student go "Oh, so THAT is how it works!".
+	`
+
+	if overrideInstruction != "" {
+		prompt += fmt.Sprintf("\n\n**IMPORTANT OVERRIDE**: %s", overrideInstruction)
+	}
+	if len(exclusions) > 0 {
+		prompt += "\n\n**AVOID REPEATS**: These topics were covered recently. Pick a clearly different topic, not a variation or another angle on any of them:\n- " +
+			strings.Join(exclusions, "\n- ")
+	}
+
+	var (
+		provider   string
+		completion Completion
+		structured *StructuredArticle
+		err        error
+	)
+	if c.Structured {
+		jsonPrompt := strings.Replace(prompt, formattingGuideline, structuredGuideline, 1)
+		provider, completion, structured, err = c.generate(ctx, jsonPrompt, ArticleSchema)
+		if err == nil {
+			prompt = jsonPrompt
+		} else if errors.Is(err, errInvalidArticle) && ctx.Err() == nil {
+			// Better a free-form issue than none
+			log.Printf("AI: no valid structured article, falling back to Markdown: %v", err)
+			provider, completion, structured, err = c.generate(ctx, prompt, nil)
+		}
+	} else {
+		provider, completion, structured, err = c.generate(ctx, prompt, nil)
+	}
+	if err != nil {
+		return Article{}, err
+	}
+
+	article := Article{
+		Title:      Title(completion.Text),
+		Markdown:   completion.Text,
+		Prompt:     prompt,
+		Override:   overrideInstruction,
+		Provider:   provider,
+		Completion: completion,
+	}
+	if structured != nil {
+		article.Title = structured.Title
+		article.Category = structured.Category
+		article.Summary = structured.Summary
+		article.Markdown, err = renderMarkdown(structured)
+		if err != nil {
+			return Article{}, fmt.Errorf("unable to render article: %v", err)
+		}
+	}
+
+	// Convert Markdown to HTML with Highlighting
+	var buf bytes.Buffer
+	if err := c.md.Convert([]byte(article.Markdown), &buf); err != nil {
+		return Article{}, fmt.Errorf("markdown conversion failed: %w", err)
+	}
+
+	// Wrap in a styled page. Chroma styles the code inline.
+	article.HTML, err = renderPage(buf.String(), article.Summary)
+	if err != nil {
+		return Article{}, fmt.Errorf("unable to render article: %v", err)
+	}
+	return article, nil
+}
+
+// Title returns the text of the first heading in markdown, or "" if there
+// is none.
+func Title(markdown string) string {
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		title := strings.TrimSpace(strings.TrimLeft(line, "#"))
+		title = strings.Trim(title, "*_ ")
+		title = strings.TrimPrefix(title, "Title:")
+		if title = strings.TrimSpace(title); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// generate asks each provider in turn until one answers, and returns the
+// name of the one that did. With a schema, an answer that doesn't match it
+// counts as a failure, and the error wraps errInvalidArticle.
+func (c *ContentGenerator) generate(ctx context.Context, prompt string, schema *Schema) (string, Completion, *StructuredArticle, error) {
+	var errs []error
+	for _, p := range c.providers {
+		completion, err := p.Generate(ctx, prompt, schema)
+		var structured *StructuredArticle
+		if err == nil && schema != nil {
+			structured, err = ParseStructuredArticle(completion.Text)
+		}
+		if err == nil {
+			log.Printf("AI: generated %d characters with %s (%s)", len(completion.Text), p.Name(), completion.Model)
+			return p.Name(), completion, structured, nil
+		}
+		log.Printf("AI: %s failed: %v", p.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", Completion{}, nil, errors.Join(errs...)
+}
+
+func (c *ContentGenerator) Close() {
+	for _, p := range c.providers {
+		if err := p.Close(); err != nil {
+			log.Printf("AI: unable to close %s: %v", p.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fakeProvider answers structured requests with jsonText and free-form
+// ones with markdown, and keeps the prompts it was sent.
+type fakeProvider struct {
+	jsonText string
+	markdown string
+	prompts  []string
+	schemas  []*Schema
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+func (p *fakeProvider) Close() error { return nil }
+
+func (p *fakeProvider) Generate(ctx context.Context, prompt string, schema *Schema) (Completion, error) {
+	p.prompts = append(p.prompts, prompt)
+	p.schemas = append(p.schemas, schema)
+	if schema != nil {
+		return Completion{Text: p.jsonText}, nil
+	}
+	return Completion{Text: p.markdown}, nil
+}
+
+func TestStructuredPromptReplacesFormattingGuideline(t *testing.T) {
+	p := &fakeProvider{jsonText: `{}`, markdown: "# Bloom Filters\n\nBody."}
+	c, err := NewContentGenerator(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Structured = true
+
+	if _, err := c.GenerateArticle(context.Background(), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	first := p.prompts[0]
+	if strings.Contains(first, formattingGuideline) {
+		t.Error("structured prompt still asks for Markdown")
+	}
+	if strings.Count(first, "3. **Formatting**") != 1 || !strings.Contains(first, structuredGuideline) {
+		t.Error("structured prompt doesn't have the JSON formatting guideline in place of the Markdown one")
+	}
+}
+
+func TestInvalidStructuredArticleFallsBackToMarkdown(t *testing.T) {
+	p := &fakeProvider{jsonText: `{"title": "Bloom Filters"}`, markdown: "# Bloom Filters\n\nBody."}
+	c, err := NewContentGenerator(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Structured = true
+
+	article, err := c.GenerateArticle(context.Background(), "", nil)
+	if err != nil {
+		t.Fatalf("GenerateArticle: %v", err)
+	}
+	if len(p.schemas) != 2 || p.schemas[0] == nil || p.schemas[1] != nil {
+		t.Fatalf("want a structured request then a free-form one, got schemas %v", p.schemas)
+	}
+	if !strings.Contains(p.prompts[1], formattingGuideline) {
+		t.Error("fallback prompt doesn't ask for Markdown")
+	}
+	if article.Title != "Bloom Filters" || article.Prompt != p.prompts[1] {
+		t.Errorf("article = %q from prompt %q, want the Markdown one", article.Title, article.Prompt)
+	}
+}
@@ -0,0 +1,176 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to any server implementing the OpenAI chat
+// completions API, including local ones such as Ollama
+// (http://localhost:11434/v1) or llama.cpp's llama-server
+// (http://localhost:8080/v1).
+type OpenAIProvider struct {
+	// BaseURL is the API root, up to and including /v1.
+	BaseURL string
+	// APIKey is sent as a bearer token if set; local servers don't need it.
+	APIKey  string
+	Options Options
+
+	HTTPClient *http.Client
+}
+
+func NewOpenAIProvider(baseURL, apiKey string, opts Options) *OpenAIProvider {
+	return &OpenAIProvider{BaseURL: baseURL, APIKey: apiKey, Options: opts}
+}
+
+func (p *OpenAIProvider) Name() string { return "openai" }
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// responseFormat asks for JSON matching a schema. Ollama, llama.cpp and
+// OpenAI all accept the json_schema type.
+type responseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string  `json:"name"`
+		Schema *Schema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) Generate(ctx context.Context, prompt string, schema *Schema) (Completion, error) {
+	req := chatRequest{
+		Model:       p.Options.Model,
+		Messages:    []chatMessage{{Role: "user", Content: prompt}},
+		Temperature: p.Options.Temperature,
+		MaxTokens:   p.Options.MaxTokens,
+	}
+	if schema != nil {
+		req.ResponseFormat = &responseFormat{Type: "json_schema"}
+		req.ResponseFormat.JSONSchema.Name = "article"
+		req.ResponseFormat.JSONSchema.Schema = schema
+	}
+	var out chatResponse
+	err := p.post(ctx, "/chat/completions", req, &out)
+	if err != nil {
+		if out.Error != nil {
+			return Completion{}, fmt.Errorf("%v: %s", err, out.Error.Message)
+		}
+		return Completion{}, err
+	}
+	if len(out.Choices) == 0 || out.Choices[0].Message.Content == "" {
+		return Completion{}, fmt.Errorf("no content generated")
+	}
+
+	model := out.Model
+	if model == "" {
+		model = p.Options.Model
+	}
+	return Completion{
+		Text:         out.Choices[0].Message.Content,
+		Model:        model,
+		PromptTokens: out.Usage.PromptTokens,
+		OutputTokens: out.Usage.CompletionTokens,
+	}, nil
+}
+
+type embeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	var out embeddingResponse
+	if err := p.post(ctx, "/embeddings", embeddingRequest{Model: p.Options.EmbeddingModel, Input: text}, &out); err != nil {
+		if out.Error != nil {
+			return nil, fmt.Errorf("%v: %s", err, out.Error.Message)
+		}
+		return nil, err
+	}
+	if len(out.Data) == 0 || len(out.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	return out.Data[0].Embedding, nil
+}
+
+// post sends payload as JSON to path under BaseURL and decodes the response
+// into out, also when the status isn't 200 so error details can be read.
+func (p *OpenAIProvider) post(ctx context.Context, path string, payload, out any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.BaseURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+		}
+		return fmt.Errorf("invalid %s response: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return nil
+}
+
+func (p *OpenAIProvider) Close() error { return nil }
@@ -0,0 +1,37 @@
+package ai
+
+import "context"
+
+// Provider is a language model backend that turns a prompt into text.
+type Provider interface {
+	// Name identifies the provider in logs, e.g. "gemini".
+	Name() string
+	// Generate answers prompt. With a schema, the answer must be JSON
+	// matching it.
+	Generate(ctx context.Context, prompt string, schema *Schema) (Completion, error)
+	Close() error
+}
+
+// Embedder is a provider that can also embed text, for comparing topics.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// Completion is a provider's answer to a prompt.
+type Completion struct {
+	Text  string
+	Model string
+	// Token usage as reported by the provider; zero if it didn't say.
+	PromptTokens int
+	OutputTokens int
+}
+
+// Options tune a provider's model. Zero values leave the provider's
+// defaults in place.
+type Options struct {
+	Model       string
+	Temperature *float32
+	MaxTokens   int
+	// EmbeddingModel is used by Embed.
+	EmbeddingModel string
+}
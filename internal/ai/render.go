@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// formattingGuideline is the prompt's guideline for free-form Markdown
+// output, and structuredGuideline replaces it when the article is
+// requested as JSON.
+const (
+	formattingGuideline = "3. **Formatting**: Markdown. Use triple backticks for code."
+	structuredGuideline = `3. **Formatting**: A single JSON object matching the provided schema, not Markdown. Follow the structure guidelines above through its fields: "sections" carry the why, the how and the architecture, with Markdown paragraphs and lists but no headings or code blocks; put all code and text diagrams in "code_samples"; put production uses in "real_world_examples". Keep "summary" to one or two plain sentences.`
+)
+
+// markdownTemplate lays out a structured article as Markdown, which is
+// what gets archived and rendered to HTML. Code uses ~~~ fences so the
+// template can live in a raw string.
+var markdownTemplate = texttemplate.Must(texttemplate.New("article.md").Parse(`# {{.Title}}
+
+_{{.Summary}}_
+{{range .Sections}}
+## {{.Heading}}
+
+{{.Body}}
+{{end}}
+{{- if .CodeSamples}}
+## In Code
+{{range .CodeSamples}}
+{{- if .Caption}}
+{{.Caption}}
+{{end}}
+~~~{{.Language}}
+{{.Code}}
+~~~
+{{end}}
+{{- end}}
+## In the Real World
+{{range .RealWorldExamples}}
+- **{{.System}}**: {{.Description}}
+{{- end}}
+
+## Key Takeaways
+{{range .KeyTakeaways}}
+- {{.}}
+{{- end}}
+`))
+
+// pageTemplate wraps the article HTML in a styled page. The summary is a
+// hidden preheader, which mail clients show as the preview text.
+var pageTemplate = template.Must(template.New("article.html").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+<style>
+	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; line-height: 1.6; color: #333; max-width: 800px; margin: 0 auto; padding: 20px; }
+	h1 { color: #2c3e50; border-bottom: 2px solid #3498db; padding-bottom: 10px; }
+	h2 { color: #2980b9; margin-top: 30px; border-bottom: 1px solid #eee; padding-bottom: 5px; }
+	p { margin-bottom: 15px; }
+	ul, ol { margin-bottom: 20px; padding-left: 25px; }
+	li { margin-bottom: 5px; }
+	
+	/* Code Block Container Styling */
+	pre { 
+		padding: 15px; 
+		border-radius: 5px; 
+		overflow-x: auto; 
+		font-family: 'Menlo', 'Monaco', 'Courier New', monospace; 
+		font-size: 14px; 
+		border: 1px solid #ddd; 
+		/* Background is handled by Chroma (dracula theme usually has dark bg) */
+	}
+	code { font-family: 'Menlo', 'Monaco', 'Courier New', monospace; }
+</style>
+</head>
+<body>
+{{- if .Summary}}
+	<div style="display: none; max-height: 0; overflow: hidden;">{{.Summary}}</div>
+{{- end}}
+	{{.Body}}
+</body>
+</html>`))
+
+func renderMarkdown(a *StructuredArticle) (string, error) {
+	clean := *a
+	clean.Title = strings.TrimSpace(strings.Trim(a.Title, "#* "))
+	clean.CodeSamples = append(clean.CodeSamples[:0:0], a.CodeSamples...)
+	for i, s := range clean.CodeSamples {
+		clean.CodeSamples[i].Code = strings.Trim(s.Code, "\n")
+	}
+	var buf bytes.Buffer
+	if err := markdownTemplate.Execute(&buf, clean); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func renderPage(body, summary string) (string, error) {
+	var buf bytes.Buffer
+	err := pageTemplate.Execute(&buf, struct {
+		Body    template.HTML
+		Summary string
+	}{template.HTML(body), summary})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema that providers accept for
+// structured output. It marshals as JSON Schema.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// MinItems is only checked by Validate; providers don't all support
+	// it.
+	MinItems int `json:"-"`
+}
+
+// Validate decodes data as JSON and checks it against s: types, required
+// properties, enums, non-empty required strings and minimum array lengths.
+// Unknown properties are allowed.
+func (s *Schema) Validate(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v any) error {
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		for _, name := range s.Required {
+			value, ok := obj[name]
+			if !ok || value == nil {
+				return fmt.Errorf("%s.%s: required", path, name)
+			}
+			if str, ok := value.(string); ok && strings.TrimSpace(str) == "" {
+				return fmt.Errorf("%s.%s: must not be empty", path, name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if value, ok := obj[name]; ok && value != nil {
+				if err := s.Properties[name].validate(path+"."+name, value); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		if len(arr) < s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, s.MinItems, len(arr))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+		if len(s.Enum) > 0 {
+			for _, e := range s.Enum {
+				if str == e {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: %q is not one of %s", path, str, strings.Join(s.Enum, ", "))
+		}
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected a number", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+	}
+	return nil
+}
+
+// Article categories the model picks from, matching the prompt's.
+var articleCategories = []string{"core-concepts", "high-level-design", "low-level-design", "case-study"}
+
+// ArticleSchema is the structure articles are requested in.
+var ArticleSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"title":    {Type: "string", Description: "Clear, descriptive title of the article, without markdown."},
+		"category": {Type: "string", Enum: articleCategories, Description: "The category the topic belongs to."},
+		"summary":  {Type: "string", Description: "One or two plain sentences saying what the reader will learn, for the email preview."},
+		"sections": {
+			Type:        "array",
+			Description: "The article body in order: the problem (the why), the concept (the how), and the architecture or design.",
+			MinItems:    2,
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"heading": {Type: "string"},
+					"body":    {Type: "string", Description: "Markdown paragraphs and lists, without headings or code blocks."},
+				},
+				Required: []string{"heading", "body"},
+			},
+		},
+		"code_samples": {
+			Type:        "array",
+			Description: "Commented code (Java or Go) or text diagrams illustrating the design.",
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"language": {Type: "string", Description: "Language for syntax highlighting, e.g. go, java or text."},
+					"caption":  {Type: "string", Description: "One sentence saying what the code shows."},
+					"code":     {Type: "string", Description: "The code itself, without backticks."},
+				},
+				Required: []string{"language", "code"},
+			},
+		},
+		"real_world_examples": {
+			Type:        "array",
+			Description: "Where this is used in production systems.",
+			MinItems:    1,
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"system":      {Type: "string", Description: "Company or product, e.g. DynamoDB."},
+					"description": {Type: "string", Description: "How it uses the concept."},
+				},
+				Required: []string{"system", "description"},
+			},
+		},
+		"key_takeaways": {
+			Type:        "array",
+			Description: "Three to five short points to remember.",
+			MinItems:    1,
+			Items:       &Schema{Type: "string"},
+		},
+	},
+	Required: []string{"title", "category", "summary", "sections", "code_samples", "real_world_examples", "key_takeaways"},
+}
+
+// StructuredArticle is an article returned in ArticleSchema.
+type StructuredArticle struct {
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Summary  string `json:"summary"`
+	Sections []struct {
+		Heading string `json:"heading"`
+		Body    string `json:"body"`
+	} `json:"sections"`
+	CodeSamples []struct {
+		Language string `json:"language"`
+		Caption  string `json:"caption"`
+		Code     string `json:"code"`
+	} `json:"code_samples"`
+	RealWorldExamples []struct {
+		System      string `json:"system"`
+		Description string `json:"description"`
+	} `json:"real_world_examples"`
+	KeyTakeaways []string `json:"key_takeaways"`
+}
+
+// errInvalidArticle is returned for a response that isn't an article in
+// ArticleSchema.
+var errInvalidArticle = errors.New("response doesn't match the article schema")
+
+// ParseStructuredArticle validates data against ArticleSchema and decodes
+// it. Models sometimes wrap JSON in a code fence, which is removed.
+func ParseStructuredArticle(data string) (*StructuredArticle, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "```") {
+		data = strings.TrimPrefix(data, "```json")
+		data = strings.TrimPrefix(data, "```")
+		data = strings.TrimSuffix(strings.TrimSpace(data), "```")
+	}
+	if err := ArticleSchema.Validate([]byte(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArticle, err)
+	}
+	var a StructuredArticle
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArticle, err)
+	}
+	return &a, nil
+}
@@ -0,0 +1,89 @@
+// Package archive keeps every generated issue: the article as written and
+// rendered, how it was generated and how its sends went.
+package archive
+
+import (
+	"errors"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/newsletter"
+)
+
+// ErrNotFound is returned when no issue has the given ID.
+var ErrNotFound = errors.New("issue not found in archive")
+
+// ErrAlreadySent is returned by Save when an issue with the same ID has
+// already been sent, so its article and stats must not be replaced.
+var ErrAlreadySent = errors.New("issue already sent")
+
+// Article is one archived issue. Its ID is the issue ID.
+type Article struct {
+	ID       string `bson:"_id" json:"id"`
+	Subject  string `bson:"subject" json:"subject"`
+	Title    string `bson:"title" json:"title"`
+	Category string `bson:"category,omitempty" json:"category,omitempty"`
+	Theme    string `bson:"theme,omitempty" json:"theme,omitempty"`
+	Summary  string `bson:"summary,omitempty" json:"summary,omitempty"`
+	Markdown string `bson:"markdown" json:"markdown,omitempty"`
+	HTML     string `bson:"html" json:"html,omitempty"`
+
+	// How it was generated
+	Prompt       string `bson:"prompt" json:"prompt,omitempty"`
+	Override     string `bson:"override,omitempty" json:"override,omitempty"`
+	Provider     string `bson:"provider" json:"provider"`
+	Model        string `bson:"model" json:"model"`
+	PromptTokens int    `bson:"prompt_tokens" json:"prompt_tokens"`
+	OutputTokens int    `bson:"output_tokens" json:"output_tokens"`
+	// Rejected are titles generated first and dropped as repeats of a
+	// recent issue.
+	Rejected []string `bson:"rejected,omitempty" json:"rejected,omitempty"`
+	// Embedding of Title, kept for comparing later topics.
+	Embedding []float32 `bson:"embedding,omitempty" json:"embedding,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	Stats     Stats     `bson:"stats" json:"stats"`
+}
+
+// Stats are the send totals of an issue.
+type Stats struct {
+	Recipients int `bson:"recipients" json:"recipients"`
+	Sent       int `bson:"sent" json:"sent"`
+	Failed     int `bson:"failed" json:"failed"`
+	// Deferred recipients were over quota when the broadcast ran.
+	Deferred int `bson:"deferred" json:"deferred"`
+	// Scheduled recipients were queued for their local delivery hour.
+	Scheduled int       `bson:"scheduled" json:"scheduled"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitzero"`
+}
+
+// Sent reports whether a broadcast of the issue has recorded stats.
+func (a Article) Sent() bool {
+	return !a.Stats.UpdatedAt.IsZero()
+}
+
+// Issue returns the article as an issue to send.
+func (a Article) Issue() newsletter.Issue {
+	return newsletter.Issue{ID: a.ID, Subject: a.Subject, HTML: a.HTML}
+}
+
+// Listing drops the article's body, prompt and embedding, for listings.
+func (a Article) Listing() Article {
+	a.Markdown, a.HTML, a.Prompt = "", "", ""
+	a.Embedding = nil
+	return a
+}
+
+// Store keeps archived issues.
+type Store interface {
+	// Save adds an article, or replaces one with the same ID that hasn't
+	// been sent yet. It returns ErrAlreadySent rather than replace one that
+	// has.
+	Save(a Article) error
+	Get(id string) (*Article, error)
+	// List returns up to limit articles, newest first.
+	List(limit int) ([]Article, error)
+	// SetStats records the totals of an issue's broadcast.
+	SetStats(id string, s Stats) error
+	// AddSent adds the outcome of a later send, such as a deferred batch.
+	AddSent(id string, sent, failed int) error
+}
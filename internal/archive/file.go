@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps one JSON file per issue in a directory.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create archive directory: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	// Issue IDs are dates, but never let one escape the directory
+	return filepath.Join(s.dir, filepath.Base(filepath.Clean("/"+id))+".json")
+}
+
+func (s *FileStore) Save(a Article) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, err := s.load(a.ID); err == nil && old.Sent() {
+		return fmt.Errorf("%w: %s", ErrAlreadySent, a.ID)
+	}
+	return s.save(a)
+}
+
+func (s *FileStore) Get(id string) (*Article, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *FileStore) List(limit int) ([]Article, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var all []Article
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		a, err := s.load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, *a)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt.After(all[j].CreatedAt) })
+	if limit > 0 && len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+func (s *FileStore) SetStats(id string, st Stats) error {
+	return s.update(id, func(a *Article) {
+		st.UpdatedAt = time.Now()
+		a.Stats = st
+	})
+}
+
+func (s *FileStore) AddSent(id string, sent, failed int) error {
+	return s.update(id, func(a *Article) {
+		a.Stats.Sent += sent
+		a.Stats.Failed += failed
+		a.Stats.UpdatedAt = time.Now()
+	})
+}
+
+func (s *FileStore) update(id string, fn func(a *Article)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	fn(a)
+	return s.save(*a)
+}
+
+func (s *FileStore) load(id string) (*Article, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a Article
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("unable to read archived issue %s: %v", id, err)
+	}
+	return &a, nil
+}
+
+func (s *FileStore) save(a Article) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves half an issue behind
+	tmp := s.path(a.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(a.ID))
+}
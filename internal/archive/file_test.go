@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFileStoreSaveReplacesUnsentIssue(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(Article{ID: "2026-10-18", Title: "Consistent Hashing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(Article{ID: "2026-10-18", Title: "Rate Limiting"}); err != nil {
+		t.Fatalf("replacing an unsent issue: %v", err)
+	}
+	a, err := s.Get("2026-10-18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Rate Limiting" {
+		t.Errorf("Title = %q, want the replacement", a.Title)
+	}
+}
+
+func TestFileStoreSaveRefusesSentIssue(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(Article{ID: "2026-10-18", Title: "Consistent Hashing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetStats("2026-10-18", Stats{Recipients: 3, Sent: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Save(Article{ID: "2026-10-18", Title: "Rate Limiting"})
+	if !errors.Is(err, ErrAlreadySent) {
+		t.Fatalf("Save over a sent issue = %v, want ErrAlreadySent", err)
+	}
+	a, err := s.Get("2026-10-18")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Consistent Hashing" || a.Stats.Sent != 3 {
+		t.Errorf("sent issue was changed: title %q, %d sent", a.Title, a.Stats.Sent)
+	}
+}
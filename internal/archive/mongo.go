@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per issue in the articles collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("articles")}
+}
+
+func (s *MongoStore) Save(a Article) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Replace everything but the stats, which only SetStats and AddSent
+	// change, as long as the issue hasn't been sent. A sent issue doesn't
+	// match the filter, so the upsert collides with its _id.
+	doc, err := bson.Marshal(a)
+	if err != nil {
+		return err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(doc, &fields); err != nil {
+		return err
+	}
+	delete(fields, "_id")
+	delete(fields, "stats")
+	_, err = s.collection.UpdateOne(ctx,
+		bson.M{"_id": a.ID, "stats.updated_at": bson.M{"$exists": false}},
+		bson.M{"$set": fields, "$setOnInsert": bson.M{"stats": a.Stats}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrAlreadySent, a.ID)
+	}
+	return err
+}
+
+func (s *MongoStore) Get(id string) (*Article, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var a Article
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&a)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *MongoStore) List(limit int) ([]Article, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var all []Article
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func (s *MongoStore) SetStats(id string, st Stats) error {
+	st.UpdatedAt = time.Now()
+	return s.update(id, bson.M{"$set": bson.M{"stats": st}})
+}
+
+func (s *MongoStore) AddSent(id string, sent, failed int) error {
+	return s.update(id, bson.M{
+		"$inc": bson.M{"stats.sent": sent, "stats.failed": failed},
+		"$set": bson.M{"stats.updated_at": time.Now()},
+	})
+}
+
+func (s *MongoStore) update(id string, update bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
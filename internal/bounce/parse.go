@@ -0,0 +1,255 @@
+// Package bounce turns delivery status notifications (RFC 3464) and abuse
+// feedback reports (ARF, RFC 5965) into subscriber status changes.
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/drumil/system-design-mailer/internal/mailer"
+)
+
+// Event kinds.
+const (
+	KindHardBounce = "hard_bounce"
+	KindSoftBounce = "soft_bounce"
+	KindComplaint  = "complaint"
+	KindDelivered  = "delivered"
+)
+
+// Event is a normalized delivery outcome for a single recipient.
+type Event struct {
+	Kind         string `json:"kind"`
+	Recipient    string `json:"recipient"`
+	Status       string `json:"status,omitempty"` // enhanced status code, e.g. 5.1.1
+	Diagnostic   string `json:"diagnostic,omitempty"`
+	FeedbackType string `json:"feedback_type,omitempty"` // ARF Feedback-Type, e.g. abuse
+	MessageID    string `json:"message_id,omitempty"`    // Message-ID of the original message
+	Source       string `json:"source,omitempty"`
+}
+
+// ErrNotReport is returned for messages that are neither a DSN nor an ARF
+// report, such as auto-replies or mail sent to the bounce address by hand.
+var ErrNotReport = errors.New("message is not a delivery status or feedback report")
+
+// Parse reads a single RFC 5322 message and returns the events it reports.
+// The recipient of each event is resolved in order of reliability: a VERP
+// envelope address, the recipient embedded in the original Message-ID, and
+// finally the address named in the report itself.
+func Parse(r io.Reader) ([]Event, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse message: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, ErrNotReport
+	}
+
+	// Bounces are delivered to the envelope sender; with VERP that address
+	// identifies the recipient directly.
+	var verpRecipient string
+	for _, h := range []string{"X-Original-To", "Delivered-To", "Envelope-To", "To"} {
+		if addr := firstAddress(msg.Header.Get(h)); addr != "" {
+			if rcpt, ok := mailer.RecipientFromVERP(addr); ok {
+				verpRecipient = rcpt
+				break
+			}
+		}
+	}
+
+	var report *reportParts
+	switch strings.ToLower(params["report-type"]) {
+	case "delivery-status":
+		report, err = readReport(msg.Body, params["boundary"], "delivery-status")
+	case "feedback-report":
+		report, err = readReport(msg.Body, params["boundary"], "feedback-report")
+	default:
+		return nil, ErrNotReport
+	}
+	if err != nil {
+		return nil, err
+	}
+	if report.fields == nil {
+		return nil, ErrNotReport
+	}
+
+	messageID := report.original.Get("Message-Id")
+	idRecipient, _ := mailer.RecipientFromMessageID(messageID)
+
+	resolve := func(reported string) string {
+		switch {
+		case verpRecipient != "":
+			return verpRecipient
+		case idRecipient != "":
+			return idRecipient
+		default:
+			return reported
+		}
+	}
+
+	if report.kind == "feedback-report" {
+		fields := report.fields[0]
+		reported := fieldValue(fields.Get("Original-Rcpt-To"))
+		if reported == "" {
+			reported = firstAddress(report.original.Get("To"))
+		}
+		// Original-Mail-From carries the envelope sender, which is our VERP address.
+		if verpRecipient == "" {
+			verpRecipient, _ = mailer.RecipientFromVERP(fieldValue(fields.Get("Original-Mail-From")))
+		}
+		recipient := resolve(reported)
+		if recipient == "" {
+			return nil, fmt.Errorf("feedback report does not identify a recipient")
+		}
+		return []Event{{
+			Kind:         KindComplaint,
+			Recipient:    strings.ToLower(recipient),
+			FeedbackType: strings.ToLower(fields.Get("Feedback-Type")),
+			MessageID:    messageID,
+			Source:       "arf",
+		}}, nil
+	}
+
+	// The first block holds per-message fields, the rest are per-recipient.
+	var events []Event
+	for _, fields := range report.fields[1:] {
+		action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+		status := strings.TrimSpace(fields.Get("Status"))
+
+		var kind string
+		switch {
+		case action == "failed" && strings.HasPrefix(status, "5"):
+			kind = KindHardBounce
+		case action == "failed" || action == "delayed":
+			kind = KindSoftBounce
+		case action == "delivered" || action == "relayed" || action == "expanded":
+			kind = KindDelivered
+		default:
+			continue
+		}
+
+		reported := fieldValue(fields.Get("Final-Recipient"))
+		if reported == "" {
+			reported = fieldValue(fields.Get("Original-Recipient"))
+		}
+		recipient := resolve(reported)
+		if recipient == "" {
+			continue
+		}
+		events = append(events, Event{
+			Kind:       kind,
+			Recipient:  strings.ToLower(recipient),
+			Status:     status,
+			Diagnostic: fieldValue(fields.Get("Diagnostic-Code")),
+			MessageID:  messageID,
+			Source:     "dsn",
+		})
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("delivery status notification has no usable recipient")
+	}
+	return events, nil
+}
+
+type reportParts struct {
+	kind     string
+	fields   []textproto.MIMEHeader // field groups of the machine-readable part
+	original textproto.MIMEHeader   // headers of the returned message
+}
+
+// readReport walks the parts of a multipart/report body and collects the
+// machine-readable report and the headers of the original message.
+func readReport(body io.Reader, boundary, kind string) (*reportParts, error) {
+	report := &reportParts{kind: kind, original: textproto.MIMEHeader{}}
+	mr := multipart.NewReader(body, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read report part: %v", err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		content, err := io.ReadAll(decodePart(part))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read report part: %v", err)
+		}
+
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status", "message/feedback-report":
+			report.fields = readFieldGroups(content)
+		case "message/rfc822", "text/rfc822-headers", "message/rfc822-headers", "message/global", "message/global-headers":
+			report.original = readHeaderBlock(content)
+		}
+	}
+	return report, nil
+}
+
+func decodePart(part *multipart.Part) io.Reader {
+	switch strings.ToLower(part.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(part)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part)
+	}
+	return part
+}
+
+// readFieldGroups splits a delivery-status body into its blank-line
+// separated groups of header-style fields.
+func readFieldGroups(content []byte) []textproto.MIMEHeader {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	var groups []textproto.MIMEHeader
+	for _, block := range strings.Split(string(content), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		groups = append(groups, readHeaderBlock([]byte(block)))
+	}
+	return groups
+}
+
+func readHeaderBlock(content []byte) textproto.MIMEHeader {
+	content = append(bytes.TrimLeft(content, "\r\n"), "\r\n\r\n"...)
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(content))).ReadMIMEHeader()
+	if err != nil && h == nil {
+		return textproto.MIMEHeader{}
+	}
+	return h
+}
+
+// fieldValue strips the type prefix of DSN/ARF fields such as
+// "rfc822; jane@example.com" or "smtp; 550 5.1.1 User unknown".
+func fieldValue(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = strings.TrimSpace(v[i+1:])
+	}
+	return strings.Trim(v, "<>")
+}
+
+// firstAddress returns the first address in a header value, or "".
+func firstAddress(v string) string {
+	if v == "" {
+		return ""
+	}
+	addrs, err := mail.ParseAddressList(v)
+	if err != nil || len(addrs) == 0 {
+		return strings.Trim(strings.TrimSpace(v), "<>")
+	}
+	return addrs[0].Address
+}
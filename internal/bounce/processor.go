@@ -0,0 +1,311 @@
+package bounce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+const defaultSoftBounceLimit = 3
+
+// Processor applies bounce and complaint events to subscriber records.
+// Hard bounces and complaints disable an address immediately; soft bounces
+// do so once SoftBounceLimit of them have been seen without a successful
+// delivery in between.
+type Processor struct {
+	Store           store.Store
+	SoftBounceLimit int
+}
+
+func NewProcessor(s store.Store, softBounceLimit int) *Processor {
+	if softBounceLimit <= 0 {
+		softBounceLimit = defaultSoftBounceLimit
+	}
+	return &Processor{Store: s, SoftBounceLimit: softBounceLimit}
+}
+
+// Apply updates the subscriber an event belongs to. Events for addresses
+// that are not (or no longer) subscribed are ignored.
+func (p *Processor) Apply(e Event) error {
+	sub, err := p.Store.Get(e.Recipient)
+	if errors.Is(err, store.ErrNotFound) {
+		log.Printf("Bounce: ignoring %s event for unknown subscriber %s", e.Kind, e.Recipient)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reason := strings.TrimSpace(e.Status + " " + e.Diagnostic)
+	switch e.Kind {
+	case KindHardBounce:
+		sub.Status = store.StatusBounced
+		sub.StatusReason = reason
+	case KindSoftBounce:
+		sub.SoftBounces++
+		if sub.SoftBounces >= p.SoftBounceLimit {
+			sub.Status = store.StatusBounced
+			sub.StatusReason = fmt.Sprintf("%d soft bounces, last: %s", sub.SoftBounces, reason)
+		}
+	case KindComplaint:
+		sub.Status = store.StatusComplained
+		sub.StatusReason = "complaint"
+		if e.FeedbackType != "" {
+			sub.StatusReason = "complaint: " + e.FeedbackType
+		}
+	case KindDelivered:
+		if sub.SoftBounces == 0 {
+			return nil
+		}
+		sub.SoftBounces = 0
+	default:
+		return fmt.Errorf("unknown event kind %q", e.Kind)
+	}
+
+	if reason == "" {
+		reason = sub.StatusReason
+	}
+	log.Printf("Bounce: %s for %s (%s), status now %q", e.Kind, e.Recipient, reason, sub.Status)
+	return p.Store.Update(*sub)
+}
+
+// ProcessMessage parses a raw DSN/ARF message and applies its events.
+func (p *Processor) ProcessMessage(r io.Reader) ([]Event, error) {
+	events, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if err := p.Apply(e); err != nil {
+			return events, err
+		}
+	}
+	return events, nil
+}
+
+// ProcessMailbox processes every message in a Maildir (directory) or mbox
+// (file). Handled Maildir messages are moved from new/ to cur/. An mbox is
+// first moved aside to <path>.processing, so reports the MTA delivers in the
+// meantime land in a fresh mbox, and processed messages are dropped from
+// that copy as they are applied. Either way each report is applied once,
+// even when a run stops partway. Messages that are not reports are skipped.
+func (p *Processor) ProcessMailbox(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return p.processMaildir(path)
+	}
+	// A claimed mbox is gone until the MTA delivers the next report
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	return p.processMbox(path)
+}
+
+func (p *Processor) processMaildir(dir string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, "new", e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return processed, err
+		}
+		if err := p.processRaw(data); err != nil {
+			return processed, err
+		}
+		// Mark as seen so the next run skips it
+		if err := os.Rename(path, filepath.Join(dir, "cur", e.Name()+":2,S")); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+const (
+	processingSuffix = ".processing"
+	// A dot lock older than this was left behind by a crashed process
+	staleLockAge = 5 * time.Minute
+)
+
+// lockTimeout is how long to wait for the MTA to release the mbox.
+var lockTimeout = 5 * time.Second
+
+func (p *Processor) processMbox(path string) (int, error) {
+	claimed := path + processingSuffix
+
+	// Finish what an earlier run left before taking new reports
+	processed := 0
+	if fileExists(claimed) {
+		n, err := p.processClaimedMbox(claimed)
+		processed += n
+		if err != nil {
+			return processed, err
+		}
+	}
+
+	ok, err := claimMbox(path, claimed)
+	if err != nil || !ok {
+		return processed, err
+	}
+	n, err := p.processClaimedMbox(claimed)
+	return processed + n, err
+}
+
+// processClaimedMbox applies the messages in a claimed mbox, then removes
+// the ones it got through. On error the unprocessed rest is kept for the
+// next run.
+func (p *Processor) processClaimedMbox(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	messages := splitMbox(data)
+	done := 0
+	for i, m := range messages {
+		if err := p.processRaw(m.data); err != nil {
+			if dropErr := dropProcessed(path, done); dropErr != nil {
+				log.Printf("Bounce: unable to drop processed reports from %s: %v", path, dropErr)
+			}
+			return i, err
+		}
+		done = m.end
+	}
+	return len(messages), dropProcessed(path, len(data))
+}
+
+// claimMbox moves the mbox at path to claimed under a dot lock, the
+// locking convention MTAs follow when delivering to an mbox. It reports
+// false if there is no mbox.
+func claimMbox(path, claimed string) (bool, error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			log.Printf("Bounce: removing stale lock %s", lock)
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return false, fmt.Errorf("mbox %s is locked by another process", path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer os.Remove(lock)
+
+	if err := os.Rename(path, claimed); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// dropProcessed removes the first n bytes of the mbox at path, deleting it
+// once nothing is left. Anything written after the file was read is kept.
+func dropProcessed(path string, n int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if n >= len(data) {
+		return os.Remove(path)
+	}
+	if n == 0 {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data[n:], 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (p *Processor) processRaw(raw []byte) error {
+	events, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		// Auto-replies and malformed reports should not block the rest of the mailbox
+		if !errors.Is(err, ErrNotReport) {
+			log.Printf("Bounce: skipping unparseable message: %v", err)
+		}
+		return nil
+	}
+	for _, e := range events {
+		if err := p.Apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mboxMessage struct {
+	data []byte
+	// end is the offset in the mbox just past the message
+	end int
+}
+
+// splitMbox splits an mboxrd file into messages, dropping the "From " lines
+// and unescaping ">From " quoting.
+func splitMbox(data []byte) []mboxMessage {
+	var messages []mboxMessage
+	var current bytes.Buffer
+	inMessage := false
+
+	for offset := 0; offset < len(data); {
+		next := len(data)
+		if i := bytes.IndexByte(data[offset:], '\n'); i >= 0 {
+			next = offset + i + 1
+		}
+		line := strings.TrimRight(string(data[offset:next]), "\r\n")
+
+		if strings.HasPrefix(line, "From ") {
+			if inMessage {
+				messages = append(messages, mboxMessage{data: append([]byte(nil), current.Bytes()...), end: offset})
+				current.Reset()
+			}
+			inMessage = true
+		} else if inMessage {
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				line = line[1:]
+			}
+			current.WriteString(line)
+			current.WriteString("\r\n")
+		}
+		offset = next
+	}
+	if inMessage {
+		messages = append(messages, mboxMessage{data: current.Bytes(), end: len(data)})
+	}
+	return messages
+}
@@ -0,0 +1,178 @@
+package bounce
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// memStore is an in-memory store.Store whose Update can be made to fail for
+// one address.
+type memStore struct {
+	subs     map[string]store.Subscriber
+	failFor  string
+	failures int
+}
+
+func newMemStore(emails ...string) *memStore {
+	s := &memStore{subs: make(map[string]store.Subscriber)}
+	for _, e := range emails {
+		s.subs[e] = store.Subscriber{Email: e, Status: store.StatusActive}
+	}
+	return s
+}
+
+func (s *memStore) Add(email string) error {
+	if _, ok := s.subs[email]; !ok {
+		s.subs[email] = store.Subscriber{Email: email, Status: store.StatusActive}
+	}
+	return nil
+}
+func (s *memStore) Remove(email string) error { delete(s.subs, email); return nil }
+func (s *memStore) GetAll() ([]string, error) { return nil, nil }
+func (s *memStore) ListActive() ([]store.Subscriber, error) {
+	return nil, nil
+}
+func (s *memStore) Get(email string) (*store.Subscriber, error) {
+	sub, ok := s.subs[email]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &sub, nil
+}
+func (s *memStore) Update(sub store.Subscriber) error {
+	if sub.Email == s.failFor {
+		s.failures++
+		return errors.New("store unavailable")
+	}
+	s.subs[sub.Email] = sub
+	return nil
+}
+
+// softBounce is an mbox entry reporting a temporary failure for recipient.
+func softBounce(recipient string) string {
+	return fmt.Sprintf(`From MAILER-DAEMON Sun Oct 18 07:00:00 2026
+From: Mail Delivery System <MAILER-DAEMON@mx.example.org>
+To: news@example.com
+Subject: Delayed Mail
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b"
+
+--b
+Content-Type: text/plain
+
+Delivery is delayed.
+--b
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; %s
+Action: delayed
+Status: 4.2.2
+Diagnostic-Code: smtp; 452 4.2.2 Mailbox full
+
+--b--
+
+`, recipient)
+}
+
+func writeMbox(t *testing.T, path string, entries ...string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(entries, "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessMboxResumesAfterError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bounces.mbox")
+	writeMbox(t, path, softBounce("a@example.org"), softBounce("b@example.org"), softBounce("c@example.org"))
+
+	s := newMemStore("a@example.org", "b@example.org", "c@example.org")
+	s.failFor = "b@example.org"
+	p := NewProcessor(s, 3)
+
+	n, err := p.ProcessMailbox(path)
+	if err == nil {
+		t.Fatal("expected the store error")
+	}
+	if n != 1 {
+		t.Errorf("processed %d messages before the error, want 1", n)
+	}
+
+	// New reports arriving meanwhile go to a fresh mbox
+	writeMbox(t, path, softBounce("c@example.org"))
+
+	s.failFor = ""
+	n, err = p.ProcessMailbox(path)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("second run processed %d messages, want 3", n)
+	}
+
+	for email, want := range map[string]int{"a@example.org": 1, "b@example.org": 1, "c@example.org": 2} {
+		if got := s.subs[email].SoftBounces; got != want {
+			t.Errorf("%s has %d soft bounces, want %d", email, got, want)
+		}
+	}
+	if fileExists(path) || fileExists(path+processingSuffix) {
+		t.Error("processed mbox files were left behind")
+	}
+
+	// Nothing left to do
+	if n, err := p.ProcessMailbox(path); err != nil || n != 0 {
+		t.Errorf("third run = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestProcessMboxWaitsForLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bounces.mbox")
+	writeMbox(t, path, softBounce("a@example.org"))
+	if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(d time.Duration) { lockTimeout = d }(lockTimeout)
+	lockTimeout = 200 * time.Millisecond
+
+	p := NewProcessor(newMemStore("a@example.org"), 3)
+	if _, err := p.ProcessMailbox(path); err == nil {
+		t.Fatal("processed an mbox locked by the MTA")
+	}
+	if !fileExists(path) {
+		t.Error("locked mbox was moved")
+	}
+}
+
+func TestDropProcessedKeepsLaterReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bounces.mbox.processing")
+	first := softBounce("a@example.org")
+	writeMbox(t, path, first)
+
+	// The MTA appended another report after the file was read
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(softBounce("b@example.org"))
+	f.Close()
+
+	if err := dropProcessed(path, len(first)); err != nil {
+		t.Fatalf("dropProcessed: %v", err)
+	}
+	rest, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != softBounce("b@example.org") {
+		t.Errorf("remaining mbox = %q", rest)
+	}
+}
@@ -0,0 +1,268 @@
+package bounce
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SESWebhook receives SES bounce, complaint and delivery notifications
+// through an SNS HTTPS subscription. Every message is verified against the
+// SNS signing certificate, and subscription confirmations are answered
+// automatically.
+type SESWebhook struct {
+	// TopicARN, if set, rejects messages from any other topic.
+	TopicARN   string
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func NewSESWebhook(topicARN string) *SESWebhook {
+	return &SESWebhook{TopicARN: topicARN, HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type snsMessage struct {
+	Type             string
+	MessageId        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+type sesNotification struct {
+	EventType        string `json:"eventType"`
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		MessageID string `json:"messageId"`
+	} `json:"mail"`
+	Bounce struct {
+		BounceType        string `json:"bounceType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			Status         string `json:"status"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+	Delivery struct {
+		Recipients []string `json:"recipients"`
+	} `json:"delivery"`
+}
+
+func (wh *SESWebhook) Events(r *http.Request, body []byte) ([]Event, error) {
+	var msg snsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	if err := wh.verify(&msg); err != nil {
+		return nil, err
+	}
+	if wh.TopicARN != "" && msg.TopicArn != wh.TopicARN {
+		return nil, fmt.Errorf("%w: unexpected topic %s", ErrInvalidSignature, msg.TopicArn)
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		if _, err := wh.get(msg.SubscribeURL); err != nil {
+			return nil, fmt.Errorf("unable to confirm SNS subscription: %v", err)
+		}
+		log.Printf("Bounce: confirmed SNS subscription to %s", msg.TopicArn)
+		return nil, nil
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	var n sesNotification
+	if err := json.Unmarshal([]byte(msg.Message), &n); err != nil {
+		return nil, fmt.Errorf("unable to parse SES notification: %v", err)
+	}
+	kind := n.EventType
+	if kind == "" {
+		kind = n.NotificationType
+	}
+
+	var events []Event
+	switch kind {
+	case "Bounce":
+		k := KindSoftBounce
+		if n.Bounce.BounceType == "Permanent" {
+			k = KindHardBounce
+		}
+		for _, rcpt := range n.Bounce.BouncedRecipients {
+			events = append(events, Event{
+				Kind:       k,
+				Recipient:  rcpt.EmailAddress,
+				Status:     rcpt.Status,
+				Diagnostic: rcpt.DiagnosticCode,
+				MessageID:  n.Mail.MessageID,
+				Source:     "ses",
+			})
+		}
+	case "Complaint":
+		for _, rcpt := range n.Complaint.ComplainedRecipients {
+			events = append(events, Event{
+				Kind:         KindComplaint,
+				Recipient:    rcpt.EmailAddress,
+				FeedbackType: n.Complaint.ComplaintFeedbackType,
+				MessageID:    n.Mail.MessageID,
+				Source:       "ses",
+			})
+		}
+	case "Delivery":
+		for _, rcpt := range n.Delivery.Recipients {
+			events = append(events, Event{Kind: KindDelivered, Recipient: rcpt, MessageID: n.Mail.MessageID, Source: "ses"})
+		}
+	}
+	return events, nil
+}
+
+// verify checks the SNS signature as described in the SNS developer guide.
+func (wh *SESWebhook) verify(msg *snsMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSignature, msg.SignatureVersion)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: bad signature encoding", ErrInvalidSignature)
+	}
+	cert, err := wh.cert(msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: signing certificate is not RSA", ErrInvalidSignature)
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(snsStringToSign(msg)))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(snsStringToSign(msg)))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func snsStringToSign(msg *snsMessage) string {
+	var b strings.Builder
+	add := func(k, v string) {
+		b.WriteString(k + "\n" + v + "\n")
+	}
+	add("Message", msg.Message)
+	add("MessageId", msg.MessageId)
+	if msg.Type == "Notification" {
+		if msg.Subject != "" {
+			add("Subject", msg.Subject)
+		}
+	} else {
+		add("SubscribeURL", msg.SubscribeURL)
+	}
+	add("Timestamp", msg.Timestamp)
+	if msg.Type != "Notification" {
+		add("Token", msg.Token)
+	}
+	add("TopicArn", msg.TopicArn)
+	add("Type", msg.Type)
+	return b.String()
+}
+
+func (wh *SESWebhook) cert(rawURL string) (*x509.Certificate, error) {
+	wh.mu.Lock()
+	cert, ok := wh.certs[rawURL]
+	wh.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	data, err := wh.get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to fetch signing certificate: %v", ErrInvalidSignature, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: signing certificate is not PEM", ErrInvalidSignature)
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	wh.mu.Lock()
+	if wh.certs == nil {
+		wh.certs = make(map[string]*x509.Certificate)
+	}
+	wh.certs[rawURL] = cert
+	wh.mu.Unlock()
+	return cert, nil
+}
+
+// get fetches an SNS certificate or subscription URL, refusing anything
+// that isn't HTTPS on an SNS host so a forged message can't make the server
+// request arbitrary URLs.
+func (wh *SESWebhook) get(rawURL string) ([]byte, error) {
+	if !validSNSURL(rawURL) {
+		return nil, fmt.Errorf("refusing to fetch %q", rawURL)
+	}
+	client := wh.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func validSNSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	host := u.Hostname()
+	return strings.HasPrefix(host, "sns.") && (strings.HasSuffix(host, ".amazonaws.com") || strings.HasSuffix(host, ".amazonaws.com.cn"))
+}
@@ -0,0 +1,306 @@
+package bounce
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a webhook request fails verification.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// defaultWebhookMaxAge bounds how old a signed webhook timestamp may be, to
+// limit replays.
+const defaultWebhookMaxAge = 15 * time.Minute
+
+// Webhook verifies a provider's event webhook and normalizes its payload.
+// Events the processor doesn't care about (opens, deferrals, ...) are
+// dropped.
+type Webhook interface {
+	Events(r *http.Request, body []byte) ([]Event, error)
+}
+
+// WebhookHandler verifies, parses and applies provider webhook events.
+// Requests that fail verification get 401; store errors get 500 so the
+// provider retries.
+func (p *Processor) WebhookHandler(wh Webhook) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 5<<20))
+		if err != nil {
+			http.Error(w, "Unable to read request body", http.StatusBadRequest)
+			return
+		}
+
+		events, err := wh.Events(r, body)
+		if errors.Is(err, ErrInvalidSignature) {
+			log.Printf("Bounce: rejected webhook from %s: %v", r.RemoteAddr, err)
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("Bounce: unable to parse webhook: %v", err)
+			http.Error(w, "Unable to parse webhook", http.StatusBadRequest)
+			return
+		}
+
+		for _, e := range events {
+			if err := p.Apply(e); err != nil {
+				log.Printf("Bounce: failed to apply webhook event: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	})
+}
+
+// checkTimestamp rejects unix timestamps older (or further in the future)
+// than maxAge.
+func checkTimestamp(ts string, maxAge time.Duration) error {
+	if maxAge <= 0 {
+		maxAge = defaultWebhookMaxAge
+	}
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidSignature)
+	}
+	age := time.Since(time.Unix(secs, 0))
+	if age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: timestamp outside the allowed window", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// SendGridWebhook verifies SendGrid's signed Event Webhook (ECDSA P-256
+// over timestamp + body).
+type SendGridWebhook struct {
+	PublicKey *ecdsa.PublicKey
+	MaxAge    time.Duration
+}
+
+// NewSendGridWebhook takes the base64 verification key shown in the
+// SendGrid mail settings.
+func NewSendGridWebhook(verificationKey string) (*SendGridWebhook, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(verificationKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode SendGrid verification key: %v", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse SendGrid verification key: %v", err)
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("SendGrid verification key is not an ECDSA key")
+	}
+	return &SendGridWebhook{PublicKey: ecKey, MaxAge: defaultWebhookMaxAge}, nil
+}
+
+type sendGridEvent struct {
+	Email     string `json:"email"`
+	Event     string `json:"event"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Status    string `json:"status"`
+	MessageID string `json:"sg_message_id"`
+}
+
+func (wh *SendGridWebhook) Events(r *http.Request, body []byte) ([]Event, error) {
+	ts := r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil || ts == "" {
+		return nil, fmt.Errorf("%w: missing signature headers", ErrInvalidSignature)
+	}
+	digest := sha256.Sum256(append([]byte(ts), body...))
+	if !ecdsa.VerifyASN1(wh.PublicKey, digest[:], sig) {
+		return nil, ErrInvalidSignature
+	}
+	if err := checkTimestamp(ts, wh.MaxAge); err != nil {
+		return nil, err
+	}
+
+	var raw []sendGridEvent
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, e := range raw {
+		ev := Event{Recipient: e.Email, Status: e.Status, Diagnostic: e.Reason, MessageID: e.MessageID, Source: "sendgrid"}
+		switch e.Event {
+		case "delivered":
+			ev.Kind = KindDelivered
+		case "bounce":
+			// "blocked" is a reputation or content block, not a dead address
+			ev.Kind = KindHardBounce
+			if e.Type == "blocked" {
+				ev.Kind = KindSoftBounce
+			}
+		case "spamreport":
+			ev.Kind = KindComplaint
+			ev.FeedbackType = "abuse"
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// MailgunWebhook verifies Mailgun webhooks, which carry an HMAC-SHA256 of
+// timestamp + token keyed with the webhook signing key.
+type MailgunWebhook struct {
+	SigningKey string
+	MaxAge     time.Duration
+}
+
+func NewMailgunWebhook(signingKey string) *MailgunWebhook {
+	return &MailgunWebhook{SigningKey: signingKey, MaxAge: defaultWebhookMaxAge}
+}
+
+type mailgunPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event          string `json:"event"`
+		Severity       string `json:"severity"`
+		Recipient      string `json:"recipient"`
+		DeliveryStatus struct {
+			Code        int    `json:"code"`
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+		Message struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	} `json:"event-data"`
+}
+
+func (wh *MailgunWebhook) Events(r *http.Request, body []byte) ([]Event, error) {
+	var p mailgunPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(wh.SigningKey))
+	mac.Write([]byte(p.Signature.Timestamp + p.Signature.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(p.Signature.Signature))) {
+		return nil, ErrInvalidSignature
+	}
+	if err := checkTimestamp(p.Signature.Timestamp, wh.MaxAge); err != nil {
+		return nil, err
+	}
+
+	d := p.EventData
+	ev := Event{
+		Recipient:  d.Recipient,
+		Diagnostic: d.DeliveryStatus.Description,
+		MessageID:  d.Message.Headers.MessageID,
+		Source:     "mailgun",
+	}
+	if ev.Diagnostic == "" {
+		ev.Diagnostic = d.DeliveryStatus.Message
+	}
+	if d.DeliveryStatus.Code != 0 {
+		ev.Status = strconv.Itoa(d.DeliveryStatus.Code)
+	}
+	switch d.Event {
+	case "delivered":
+		ev.Kind = KindDelivered
+	case "failed":
+		ev.Kind = KindSoftBounce
+		if d.Severity == "permanent" {
+			ev.Kind = KindHardBounce
+		}
+	case "complained":
+		ev.Kind = KindComplaint
+		ev.FeedbackType = "abuse"
+	default:
+		return nil, nil
+	}
+	return []Event{ev}, nil
+}
+
+// PostmarkWebhook checks the HTTP basic auth credentials configured on the
+// Postmark webhook URL; Postmark does not sign its payloads.
+type PostmarkWebhook struct {
+	Username string
+	Password string
+}
+
+func NewPostmarkWebhook(username, password string) *PostmarkWebhook {
+	return &PostmarkWebhook{Username: username, Password: password}
+}
+
+type postmarkEvent struct {
+	RecordType  string
+	Type        string
+	Email       string
+	Recipient   string
+	Description string
+	Details     string
+	MessageID   string
+}
+
+func (wh *PostmarkWebhook) Events(r *http.Request, body []byte) ([]Event, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok ||
+		subtle.ConstantTimeCompare([]byte(user), []byte(wh.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(pass), []byte(wh.Password)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	var e postmarkEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	ev := Event{Recipient: e.Email, Diagnostic: strings.TrimSpace(e.Description + " " + e.Details), MessageID: e.MessageID, Source: "postmark"}
+	switch e.RecordType {
+	case "Delivery":
+		ev.Kind = KindDelivered
+		ev.Recipient = e.Recipient
+		ev.Diagnostic = ""
+	case "Bounce":
+		switch e.Type {
+		case "HardBounce", "BadEmailAddress", "ManuallyDeactivated":
+			ev.Kind = KindHardBounce
+		case "SoftBounce", "Transient", "DnsError", "Blocked":
+			ev.Kind = KindSoftBounce
+		case "SpamComplaint":
+			ev.Kind = KindComplaint
+			ev.FeedbackType = "abuse"
+		default:
+			// Auto-responders, subscription changes and the like
+			return nil, nil
+		}
+		ev.Status = e.Type
+	case "SpamComplaint":
+		ev.Kind = KindComplaint
+		ev.FeedbackType = "abuse"
+	default:
+		return nil, nil
+	}
+	return []Event{ev}, nil
+}
@@ -0,0 +1,391 @@
+package bounce
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+func TestSendGridWebhook(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh, err := NewSendGridWebhook(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatalf("NewSendGridWebhook: %v", err)
+	}
+
+	body := []byte(`[{"email":"a@example.org","event":"bounce","type":"bounce","status":"5.1.1","reason":"unknown user","sg_message_id":"m1"},
+{"email":"b@example.org","event":"bounce","type":"blocked","status":"5.7.1","reason":"blocked"},
+{"email":"c@example.org","event":"open"}]`)
+	request := func(ts string, body []byte, signedBody []byte) *http.Request {
+		digest := sha256.Sum256(append([]byte(ts), signedBody...))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/sendgrid", bytes.NewReader(body))
+		r.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", ts)
+		r.Header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(sig))
+		return r
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	events, err := wh.Events(request(now, body, body), body)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	want := []Event{
+		{Kind: KindHardBounce, Recipient: "a@example.org", Status: "5.1.1", Diagnostic: "unknown user", MessageID: "m1", Source: "sendgrid"},
+		{Kind: KindSoftBounce, Recipient: "b@example.org", Status: "5.7.1", Diagnostic: "blocked", Source: "sendgrid"},
+	}
+	assertEvents(t, events, want)
+
+	tampered := bytes.Replace(body, []byte("a@example.org"), []byte("x@example.org"), 1)
+	if _, err := wh.Events(request(now, tampered, body), tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v", err)
+	}
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if _, err := wh.Events(request(stale, body, body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("stale timestamp: err = %v", err)
+	}
+	unsigned := httptest.NewRequest(http.MethodPost, "/webhooks/sendgrid", bytes.NewReader(body))
+	if _, err := wh.Events(unsigned, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("missing signature: err = %v", err)
+	}
+}
+
+func TestMailgunWebhook(t *testing.T) {
+	wh := NewMailgunWebhook("signing-key")
+	payload := func(key string, ts int64) []byte {
+		token := "0123456789abcdef"
+		mac := hmac.New(sha256.New, []byte(key))
+		fmt.Fprintf(mac, "%d%s", ts, token)
+		return []byte(fmt.Sprintf(`{"signature":{"timestamp":"%d","token":"%s","signature":"%s"},
+"event-data":{"event":"failed","severity":"permanent","recipient":"a@example.org",
+"delivery-status":{"code":550,"message":"5.1.1 No such user"},"message":{"headers":{"message-id":"m1"}}}}`,
+			ts, token, hex.EncodeToString(mac.Sum(nil))))
+	}
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/mailgun", nil)
+
+	events, err := wh.Events(r, payload("signing-key", time.Now().Unix()))
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	assertEvents(t, events, []Event{
+		{Kind: KindHardBounce, Recipient: "a@example.org", Status: "550", Diagnostic: "5.1.1 No such user", MessageID: "m1", Source: "mailgun"},
+	})
+
+	if _, err := wh.Events(r, payload("other-key", time.Now().Unix())); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+	if _, err := wh.Events(r, payload("signing-key", time.Now().Add(-time.Hour).Unix())); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("stale timestamp: err = %v", err)
+	}
+	tampered := bytes.Replace(payload("signing-key", time.Now().Unix()), []byte(`"token":"0`), []byte(`"token":"1`), 1)
+	if _, err := wh.Events(r, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered token: err = %v", err)
+	}
+}
+
+func TestPostmarkWebhook(t *testing.T) {
+	wh := NewPostmarkWebhook("hook", "secret")
+	body := []byte(`{"RecordType":"Bounce","Type":"HardBounce","Email":"a@example.org","Description":"Unknown user","Details":"550 5.1.1","MessageID":"m1"}`)
+
+	for _, tc := range []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"hook", "secret", true},
+		{"hook", "wrong", false},
+		{"other", "secret", false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/postmark", nil)
+		r.SetBasicAuth(tc.user, tc.pass)
+		events, err := wh.Events(r, body)
+		if !tc.ok {
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s:%s: err = %v, want ErrInvalidSignature", tc.user, tc.pass, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Events: %v", err)
+		}
+		assertEvents(t, events, []Event{
+			{Kind: KindHardBounce, Recipient: "a@example.org", Status: "HardBounce", Diagnostic: "Unknown user 550 5.1.1", MessageID: "m1", Source: "postmark"},
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/postmark", nil)
+	if _, err := wh.Events(r, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("no credentials: err = %v", err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	s := newMemStore("a@example.org")
+	p := NewProcessor(s, 3)
+	h := p.WebhookHandler(NewPostmarkWebhook("hook", "secret"))
+	body := `{"RecordType":"SpamComplaint","Email":"a@example.org"}`
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/postmark", strings.NewReader(body))
+	r.SetBasicAuth("hook", "wrong")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized || s.subs["a@example.org"].Status != store.StatusActive {
+		t.Fatalf("unsigned request: status %d, subscriber %+v", rec.Code, s.subs["a@example.org"])
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/webhooks/postmark", strings.NewReader(body))
+	r.SetBasicAuth("hook", "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || s.subs["a@example.org"].Status != store.StatusComplained {
+		t.Errorf("signed request: status %d, subscriber %+v", rec.Code, s.subs["a@example.org"])
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/postmark", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+}
+
+const (
+	testTopic   = "arn:aws:sns:us-east-1:123456789012:ses-events"
+	testCertURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+)
+
+// snsFixture signs SNS messages with a throwaway certificate and serves it,
+// and the subscription confirmation URL, from fake SNS hosts.
+type snsFixture struct {
+	key       *rsa.PrivateKey
+	certPEM   []byte
+	fetched   []string
+	confirmed int
+}
+
+func newSNSFixture(t *testing.T) *snsFixture {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &snsFixture{key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (f *snsFixture) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.fetched = append(f.fetched, r.URL.String())
+	body := "not found"
+	status := http.StatusNotFound
+	switch {
+	case r.URL.String() == testCertURL:
+		body, status = string(f.certPEM), http.StatusOK
+	case r.URL.Query().Get("Action") == "ConfirmSubscription":
+		f.confirmed++
+		body, status = "<ConfirmSubscriptionResponse/>", http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(body)), Request: r}, nil
+}
+
+func (f *snsFixture) webhook() *SESWebhook {
+	wh := NewSESWebhook(testTopic)
+	wh.HTTPClient = &http.Client{Transport: f}
+	return wh
+}
+
+// sign fills in the signature fields and returns the JSON body SNS would
+// post.
+func (f *snsFixture) sign(t *testing.T, msg snsMessage) []byte {
+	t.Helper()
+	if msg.SignatureVersion == "" {
+		msg.SignatureVersion = "1"
+	}
+	if msg.SigningCertURL == "" {
+		msg.SigningCertURL = testCertURL
+	}
+	var hash crypto.Hash
+	var digest []byte
+	if msg.SignatureVersion == "1" {
+		sum := sha1.Sum([]byte(snsStringToSign(&msg)))
+		hash, digest = crypto.SHA1, sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(snsStringToSign(&msg)))
+		hash, digest = crypto.SHA256, sum[:]
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, hash, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func bounceNotification() snsMessage {
+	return snsMessage{
+		Type:      "Notification",
+		MessageId: "n1",
+		TopicArn:  testTopic,
+		Timestamp: "2026-10-18T07:00:00.000Z",
+		Message: `{"eventType":"Bounce","mail":{"messageId":"m1"},"bounce":{"bounceType":"Permanent",` +
+			`"bouncedRecipients":[{"emailAddress":"a@example.org","status":"5.1.1","diagnosticCode":"smtp; 550 5.1.1 user unknown"}]}}`,
+	}
+}
+
+func TestSESWebhookNotification(t *testing.T) {
+	for _, version := range []string{"1", "2"} {
+		t.Run("SignatureVersion"+version, func(t *testing.T) {
+			f := newSNSFixture(t)
+			msg := bounceNotification()
+			msg.SignatureVersion = version
+			events, err := f.webhook().Events(httptest.NewRequest(http.MethodPost, "/webhooks/ses", nil), f.sign(t, msg))
+			if err != nil {
+				t.Fatalf("Events: %v", err)
+			}
+			assertEvents(t, events, []Event{
+				{Kind: KindHardBounce, Recipient: "a@example.org", Status: "5.1.1", Diagnostic: "smtp; 550 5.1.1 user unknown", MessageID: "m1", Source: "ses"},
+			})
+		})
+	}
+}
+
+func TestSESWebhookRejectsInvalidMessages(t *testing.T) {
+	f := newSNSFixture(t)
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/ses", nil)
+
+	// Signed, then altered
+	var msg snsMessage
+	json.Unmarshal(f.sign(t, bounceNotification()), &msg)
+	msg.Message = strings.Replace(msg.Message, "a@example.org", "x@example.org", 1)
+	tampered, _ := json.Marshal(msg)
+	if _, err := f.webhook().Events(r, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered message: err = %v", err)
+	}
+
+	// Signed by someone else
+	other := newSNSFixture(t)
+	if _, err := f.webhook().Events(r, other.sign(t, bounceNotification())); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("foreign key: err = %v", err)
+	}
+
+	// A certificate outside SNS is never fetched
+	f.fetched = nil
+	offsite := bounceNotification()
+	offsite.SigningCertURL = "https://attacker.example.com/cert.pem"
+	if _, err := f.webhook().Events(r, f.sign(t, offsite)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("offsite certificate: err = %v", err)
+	}
+	if len(f.fetched) != 0 {
+		t.Errorf("fetched %v", f.fetched)
+	}
+
+	// Correctly signed, but for another topic
+	wrongTopic := bounceNotification()
+	wrongTopic.TopicArn = "arn:aws:sns:us-east-1:999999999999:other"
+	if _, err := f.webhook().Events(r, f.sign(t, wrongTopic)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong topic: err = %v", err)
+	}
+
+	unknown := bounceNotification()
+	unknown.SignatureVersion = "3"
+	if _, err := f.webhook().Events(r, f.sign(t, unknown)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unknown signature version: err = %v", err)
+	}
+}
+
+func TestSESWebhookSubscriptionConfirmation(t *testing.T) {
+	f := newSNSFixture(t)
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/ses", nil)
+	confirmation := snsMessage{
+		Type:         "SubscriptionConfirmation",
+		MessageId:    "c1",
+		Token:        "token",
+		TopicArn:     testTopic,
+		Message:      "You have chosen to subscribe to the topic.",
+		SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=" + testTopic + "&Token=token",
+		Timestamp:    "2026-10-18T07:00:00.000Z",
+	}
+
+	events, err := f.webhook().Events(r, f.sign(t, confirmation))
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if len(events) != 0 || f.confirmed != 1 {
+		t.Errorf("events = %v, confirmed %d times; want none and 1", events, f.confirmed)
+	}
+
+	// The subscribe URL is signed too, so it can't be swapped
+	var msg snsMessage
+	json.Unmarshal(f.sign(t, confirmation), &msg)
+	msg.SubscribeURL = strings.Replace(msg.SubscribeURL, "Token=token", "Token=other", 1)
+	swapped, _ := json.Marshal(msg)
+	if _, err := f.webhook().Events(r, swapped); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("swapped subscribe URL: err = %v", err)
+	}
+
+	// A signed confirmation still only follows SNS URLs
+	offsite := confirmation
+	offsite.SubscribeURL = "https://attacker.example.com/?Action=ConfirmSubscription"
+	if _, err := f.webhook().Events(r, f.sign(t, offsite)); err == nil || errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("offsite subscribe URL: err = %v, want a refusal", err)
+	}
+	if f.confirmed != 1 {
+		t.Errorf("confirmed %d times, want 1", f.confirmed)
+	}
+}
+
+func assertEvents(t *testing.T, got, want []Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %+v, want %+v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
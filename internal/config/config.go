@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -16,11 +18,141 @@ type Config struct {
 	Port         string
 	CronSecret   string
 	PublicURL    string
+
+	// SMTP connection pooling
+	SMTPMaxMessagesPerConn int
+	SMTPIdleTimeout        time.Duration
+	SMTPTimeout            time.Duration
+
+	// DKIM signing (all three must be set to enable it)
+	DKIMDomain         string
+	DKIMSelector       string
+	DKIMPrivateKeyFile string
+
+	// MailTransport is a comma-separated priority list of transports
+	// ("gmail", "smtp", "file"). Empty picks Gmail when credentials exist,
+	// falling back to SMTP.
+	MailTransport string
+	MailDir       string
+	MailDirFormat string // "eml" or "maildir"
+
+	// Circuit breaker for the transport failover chain
+	FailoverThreshold int
+	FailoverCooldown  time.Duration
+
+	// Bounce handling
+	BounceAddress   string // VERP base address for the SMTP envelope sender
+	BounceMailbox   string // mbox file or Maildir directory with DSN/ARF reports
+	BounceSoftLimit int
+
+	// Open and click tracking
+	TrackingEnabled bool
+	TrackingSecret  string
+
+	// Where the Gmail OAuth token lives: "file", "mongo" or "env". Empty
+	// picks env when GMAIL_TOKEN_JSON is set, then mongo, then file.
+	GmailTokenStore string
+	GmailTokenFile  string
+
+	// SMTPAuth is "password" (PLAIN or LOGIN) or "oauth2" (XOAUTH2 with the
+	// Google credentials used by the Gmail mailer)
+	SMTPAuth string
+
+	// HTTP API providers ("sendgrid", "mailgun", "postmark", "ses" in
+	// MAIL_TRANSPORT) and their event webhooks
+	SendGridAPIKey        string
+	SendGridWebhookKey    string
+	MailgunAPIKey         string
+	MailgunDomain         string
+	MailgunBaseURL        string
+	MailgunWebhookKey     string
+	PostmarkServerToken   string
+	PostmarkMessageStream string
+	PostmarkWebhookUser   string
+	PostmarkWebhookPass   string
+	SESRegion             string
+	SESAccessKeyID        string
+	SESSecretAccessKey    string
+	SESSessionToken       string
+	SESConfigurationSet   string
+	SESTopicARN           string
+
+	// NewsletterTemplate is an html/template file wrapping each issue;
+	// empty uses the built-in template
+	NewsletterTemplate string
+
+	// Daily send limits per transport, from MAIL_QUOTAS="gmail=500,ses=50000"
+	MailQuotas         map[string]int
+	MailQuotaWarnPct   int
+	DeferredCheckEvery time.Duration
+
+	// Canary send: the issue goes to SeedEmails first, then to everyone
+	// after CanaryWindow unless an admin holds or aborts it. A hold not
+	// released within CanaryMaxHold aborts the issue.
+	SeedEmails    []string
+	CanaryWindow  time.Duration
+	CanaryMaxHold time.Duration
+
+	// In-process schedule for the daily job, e.g. "0 7 * * *"; empty
+	// leaves it to an external cron calling /trigger-now
+	DailySchedule    string
+	ScheduleTimezone string
+
+	// LeaderLockTTL is how long the daily job's lock survives without
+	// renewal, e.g. after a crash
+	LeaderLockTTL time.Duration
+
+	// CatchUpPolicy decides what happens on startup when the last
+	// scheduled run was missed: "once" (the default), "skip", or a
+	// duration such as "6h" to catch up only if it's no later than that
+	CatchUpPolicy string
+
+	// Delivery windows: subscribers with a time zone get the issue at
+	// their delivery hour, or DefaultDeliveryHour if they haven't set one
+	DeliveryWindows     bool
+	DefaultDeliveryHour int
+
+	// EditorialCalendar is a JSON file with the topic rotation, themed
+	// weeks, date overrides and blackout dates; empty uses the built-in
+	// weekday rotation
+	EditorialCalendar string
+
+	// AIProvider is a comma-separated priority list of language model
+	// providers ("gemini", "openai"); later ones are fallbacks. Temperature
+	// and max tokens are left to the provider when unset, and so are the
+	// Gemini models (see ai.DefaultGeminiModel).
+	AIProvider        string
+	GeminiModel       string
+	GeminiTemperature *float32
+	GeminiMaxTokens   int
+	// OpenAI-compatible chat completions server, e.g. a local Ollama or
+	// llama.cpp
+	OpenAIBaseURL     string
+	OpenAIAPIKey      string
+	OpenAIModel       string
+	OpenAITemperature *float32
+	OpenAIMaxTokens   int
+	// StructuredOutput requests articles as schema-checked JSON rendered
+	// through our templates instead of free-form Markdown
+	StructuredOutput bool
+
+	// Topic dedup: a new article whose title is too close to one of the
+	// last DedupLookback issues is regenerated, up to DedupMaxAttempts
+	// tries in all. DedupEmbeddings names the provider ("gemini" or
+	// "openai") used to also compare topic embeddings; empty compares
+	// titles only.
+	DedupLookback           int
+	DedupMaxAttempts        int
+	DedupThreshold          float64
+	DedupEmbeddings         string
+	DedupEmbeddingThreshold float64
+	GeminiEmbeddingModel    string
+	OpenAIEmbeddingModel    string
 }
 
 func Load() *Config {
 	return &Config{
-		GeminiAPIKey: getEnvOrFatal("GEMINI_API_KEY"),
+		GeminiAPIKey: getEnvOrDefault("GEMINI_API_KEY", ""),
 		SMTPHost:     getEnvOrDefault("SMTP_HOST", ""),
 		SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
 		SMTPUser:     getEnvOrDefault("SMTP_USER", ""),
@@ -29,6 +161,90 @@ func Load() *Config {
 		Port:         getEnvOrDefault("PORT", "8080"),
 		CronSecret:   getEnvOrDefault("CRON_SECRET", os.Getenv("SMTP_PASS")), // Fallback to SMTP_PASS
 		PublicURL:    getEnvOrDefault("PUBLIC_URL", "https://system-design-email-sender.onrender.com"),
+
+		SMTPMaxMessagesPerConn: getEnvAsInt("SMTP_MAX_MESSAGES_PER_CONN", 100),
+		SMTPIdleTimeout:        getEnvAsDuration("SMTP_IDLE_TIMEOUT", 30*time.Second),
+		SMTPTimeout:            getEnvAsDuration("SMTP_TIMEOUT", time.Minute),
+
+		DKIMDomain:         getEnvOrDefault("DKIM_DOMAIN", ""),
+		DKIMSelector:       getEnvOrDefault("DKIM_SELECTOR", ""),
+		DKIMPrivateKeyFile: getEnvOrDefault("DKIM_PRIVATE_KEY_FILE", ""),
+
+		MailTransport: getEnvOrDefault("MAIL_TRANSPORT", ""),
+		MailDir:       getEnvOrDefault("MAIL_DIR", "./outbox"),
+		MailDirFormat: getEnvOrDefault("MAIL_DIR_FORMAT", "eml"),
+
+		FailoverThreshold: getEnvAsInt("MAIL_FAILOVER_THRESHOLD", 5),
+		FailoverCooldown:  getEnvAsDuration("MAIL_FAILOVER_COOLDOWN", 10*time.Minute),
+
+		BounceAddress:   getEnvOrDefault("BOUNCE_ADDRESS", ""),
+		BounceMailbox:   getEnvOrDefault("BOUNCE_MAILBOX", ""),
+		BounceSoftLimit: getEnvAsInt("BOUNCE_SOFT_LIMIT", 3),
+
+		TrackingEnabled: getEnvAsBool("TRACKING_ENABLED", false),
+		TrackingSecret:  getEnvOrDefault("TRACKING_SECRET", os.Getenv("CRON_SECRET")),
+
+		GmailTokenStore: getEnvOrDefault("GMAIL_TOKEN_STORE", ""),
+		GmailTokenFile:  getEnvOrDefault("GMAIL_TOKEN_FILE", "token.json"),
+
+		SMTPAuth: getEnvOrDefault("SMTP_AUTH", "password"),
+
+		SendGridAPIKey:        getEnvOrDefault("SENDGRID_API_KEY", ""),
+		SendGridWebhookKey:    getEnvOrDefault("SENDGRID_WEBHOOK_KEY", ""),
+		MailgunAPIKey:         getEnvOrDefault("MAILGUN_API_KEY", ""),
+		MailgunDomain:         getEnvOrDefault("MAILGUN_DOMAIN", ""),
+		MailgunBaseURL:        getEnvOrDefault("MAILGUN_BASE_URL", "https://api.mailgun.net"),
+		MailgunWebhookKey:     getEnvOrDefault("MAILGUN_WEBHOOK_SIGNING_KEY", ""),
+		PostmarkServerToken:   getEnvOrDefault("POSTMARK_SERVER_TOKEN", ""),
+		PostmarkMessageStream: getEnvOrDefault("POSTMARK_MESSAGE_STREAM", ""),
+		PostmarkWebhookUser:   getEnvOrDefault("POSTMARK_WEBHOOK_USER", ""),
+		PostmarkWebhookPass:   getEnvOrDefault("POSTMARK_WEBHOOK_PASS", ""),
+		SESRegion:             getEnvOrDefault("SES_REGION", getEnvOrDefault("AWS_REGION", "us-east-1")),
+		SESAccessKeyID:        getEnvOrDefault("AWS_ACCESS_KEY_ID", ""),
+		SESSecretAccessKey:    getEnvOrDefault("AWS_SECRET_ACCESS_KEY", ""),
+		SESSessionToken:       getEnvOrDefault("AWS_SESSION_TOKEN", ""),
+		SESConfigurationSet:   getEnvOrDefault("SES_CONFIGURATION_SET", ""),
+		SESTopicARN:           getEnvOrDefault("SES_TOPIC_ARN", ""),
+
+		NewsletterTemplate: getEnvOrDefault("NEWSLETTER_TEMPLATE", ""),
+
+		MailQuotas:         getEnvAsIntMap("MAIL_QUOTAS"),
+		MailQuotaWarnPct:   getEnvAsInt("MAIL_QUOTA_WARN_PERCENT", 80),
+		DeferredCheckEvery: getEnvAsDuration("DEFERRED_CHECK_INTERVAL", 15*time.Minute),
+
+		SeedEmails:    getEnvAsList("SEED_EMAILS"),
+		CanaryWindow:  getEnvAsDuration("CANARY_WINDOW", 30*time.Minute),
+		CanaryMaxHold: getEnvAsDuration("CANARY_MAX_HOLD", 4*time.Hour),
+
+		DailySchedule:    getEnvOrDefault("DAILY_SCHEDULE", ""),
+		ScheduleTimezone: getEnvOrDefault("SCHEDULE_TIMEZONE", "UTC"),
+
+		LeaderLockTTL: getEnvAsDuration("LEADER_LOCK_TTL", 2*time.Minute),
+		CatchUpPolicy: getEnvOrDefault("CATCHUP_POLICY", "once"),
+
+		DeliveryWindows:     getEnvAsBool("DELIVERY_WINDOWS", false),
+		DefaultDeliveryHour: getEnvAsInt("DEFAULT_DELIVERY_HOUR", 7),
+
+		EditorialCalendar: getEnvOrDefault("EDITORIAL_CALENDAR", ""),
+
+		AIProvider:        getEnvOrDefault("AI_PROVIDER", "gemini"),
+		StructuredOutput:  getEnvAsBool("AI_STRUCTURED_OUTPUT", true),
+		GeminiModel:       getEnvOrDefault("GEMINI_MODEL", ""),
+		GeminiTemperature: getEnvAsOptionalFloat("GEMINI_TEMPERATURE"),
+		GeminiMaxTokens:   getEnvAsInt("GEMINI_MAX_TOKENS", 0),
+		OpenAIBaseURL:     getEnvOrDefault("OPENAI_BASE_URL", "http://localhost:11434/v1"),
+		OpenAIAPIKey:      getEnvOrDefault("OPENAI_API_KEY", ""),
+		OpenAIModel:       getEnvOrDefault("OPENAI_MODEL", "llama3.1"),
+		OpenAITemperature: getEnvAsOptionalFloat("OPENAI_TEMPERATURE"),
+		OpenAIMaxTokens:   getEnvAsInt("OPENAI_MAX_TOKENS", 0),
+
+		DedupLookback:           getEnvAsInt("DEDUP_LOOKBACK", 90),
+		DedupMaxAttempts:        getEnvAsInt("DEDUP_MAX_ATTEMPTS", 3),
+		DedupThreshold:          getEnvAsFloat("DEDUP_THRESHOLD", 0.75),
+		DedupEmbeddings:         getEnvOrDefault("DEDUP_EMBEDDINGS", ""),
+		DedupEmbeddingThreshold: getEnvAsFloat("DEDUP_EMBEDDING_THRESHOLD", 0.85),
+		GeminiEmbeddingModel:    getEnvOrDefault("GEMINI_EMBEDDING_MODEL", ""),
+		OpenAIEmbeddingModel:    getEnvOrDefault("OPENAI_EMBEDDING_MODEL", "nomic-embed-text"),
 	}
 }
 
@@ -59,3 +275,86 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return value
 }
+
+func getEnvAsDuration(key string, fallback time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		log.Printf("Invalid duration for %s, using default: %s", key, fallback)
+		return fallback
+	}
+	return value
+}
+
+func getEnvAsFloat(key string, fallback float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s, using default: %g", key, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getEnvAsOptionalFloat returns nil when key is unset or invalid.
+func getEnvAsOptionalFloat(key string) *float32 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(valueStr, 32)
+	if err != nil {
+		log.Printf("Invalid number for %s, using the provider default", key)
+		return nil
+	}
+	f := float32(value)
+	return &f
+}
+
+func getEnvAsBool(key string, fallback bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Invalid boolean for %s, using default: %t", key, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getEnvAsIntMap parses "name=value,name=value" pairs, skipping bad entries.
+func getEnvAsIntMap(key string) map[string]int {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, valueStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(valueStr))
+		if err != nil {
+			log.Printf("Invalid integer for %s in %s, ignoring", name, key)
+			continue
+		}
+		result[strings.TrimSpace(name)] = value
+	}
+	return result
+}
+
+// getEnvAsList parses a comma-separated list, dropping empty entries.
+func getEnvAsList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
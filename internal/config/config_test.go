@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("SENDER_EMAIL", "newsletter@example.org")
+	t.Setenv("CATCHUP_POLICY", "")
+	t.Setenv("GEMINI_MODEL", "")
+	t.Setenv("GEMINI_EMBEDDING_MODEL", "")
+
+	cfg := Load()
+	if cfg.CatchUpPolicy != "once" {
+		t.Errorf("CatchUpPolicy = %q, want once", cfg.CatchUpPolicy)
+	}
+
+	// The ai package applies its own defaults
+	if cfg.GeminiModel != "" || cfg.GeminiEmbeddingModel != "" {
+		t.Errorf("Gemini models = %q, %q; want empty", cfg.GeminiModel, cfg.GeminiEmbeddingModel)
+	}
+
+	t.Setenv("CATCHUP_POLICY", "skip")
+	if cfg := Load(); cfg.CatchUpPolicy != "skip" {
+		t.Errorf("CatchUpPolicy = %q, want the configured skip", cfg.CatchUpPolicy)
+	}
+}
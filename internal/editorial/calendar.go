@@ -0,0 +1,257 @@
+// Package editorial decides what each day's issue is about from an
+// editorial calendar: weekday rules, themed weeks, date-specific overrides
+// and blackout dates.
+package editorial
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// DefaultCalendar is the rotation used without a calendar file: four days
+// of low-level design, two of high-level design and a Sunday case study.
+const DefaultCalendar = `{
+  "categories": {
+    "lld": "STRICTLY generate an article from CATEGORY 3: Low-Level Design (LLD), Patterns & SOLID. Focus on Design Patterns (Factory, Strategy, Observer) or SOLID principles.",
+    "hld": "STRICTLY generate an article from CATEGORY 2: High-Level System Design (HLD). Pick a standard system design interview question (e.g., Rate Limiter, Chat App).",
+    "case-study": "STRICTLY generate a 'Real-World System Breakdown' (Case Study). Explain how a specific company (like Uber, Netflix, Discord) solved a specific scaling problem."
+  },
+  "weekdays": {
+    "monday": "lld",
+    "tuesday": "lld",
+    "wednesday": "lld",
+    "thursday": "lld",
+    "friday": "hld",
+    "saturday": "hld",
+    "sunday": "case-study"
+  }
+}`
+
+// Entry sets the category and/or an extra instruction for a day.
+type Entry struct {
+	Category    string `json:"category,omitempty"`
+	Instruction string `json:"instruction,omitempty"`
+}
+
+// Theme applies to every day from Start to End inclusive, e.g. a week on
+// databases. Its Category, if set, replaces the weekday's and its
+// Instruction is added to the day's.
+type Theme struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Entry
+}
+
+// Blackout is a range of days with no issue. End defaults to Start.
+type Blackout struct {
+	Start  string `json:"start"`
+	End    string `json:"end,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Calendar is the editorial plan. Dates are YYYY-MM-DD and compared in the
+// time zone of the time they are looked up with.
+type Calendar struct {
+	// Categories maps a category name to the instruction given to the
+	// model.
+	Categories map[string]string `json:"categories"`
+	// Weekdays maps a lowercase weekday name to a category.
+	Weekdays  map[string]string `json:"weekdays"`
+	Themes    []Theme           `json:"themes,omitempty"`
+	Dates     map[string]Entry  `json:"dates,omitempty"`
+	Blackouts []Blackout        `json:"blackouts,omitempty"`
+}
+
+// Plan is what the calendar says about one day.
+type Plan struct {
+	Date     string `json:"date"`
+	Weekday  string `json:"weekday"`
+	Category string `json:"category,omitempty"`
+	Theme    string `json:"theme,omitempty"`
+	// Source is the rule that decided the day: "weekday", "theme", "date",
+	// "blackout", or empty when nothing applies.
+	Source string `json:"source,omitempty"`
+	// Instruction is passed to the model as the override instruction.
+	Instruction string `json:"instruction,omitempty"`
+	Blackout    bool   `json:"blackout,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// Load reads a calendar from a JSON file, or returns the default calendar
+// when path is empty.
+func Load(path string) (*Calendar, error) {
+	data := []byte(DefaultCalendar)
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read editorial calendar: %v", err)
+		}
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a calendar.
+func Parse(data []byte) (*Calendar, error) {
+	var c Calendar
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid editorial calendar: %v", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid editorial calendar: %v", err)
+	}
+	return &c, nil
+}
+
+func (c *Calendar) validate() error {
+	checkEntry := func(where string, e Entry) error {
+		if e.Category != "" {
+			if _, ok := c.Categories[e.Category]; !ok {
+				return fmt.Errorf("%s: unknown category %q", where, e.Category)
+			}
+		}
+		return nil
+	}
+	checkRange := func(where, start, end string) error {
+		s, err := time.Parse(dateLayout, start)
+		if err != nil {
+			return fmt.Errorf("%s: bad start date %q", where, start)
+		}
+		if end == "" {
+			return nil
+		}
+		e, err := time.Parse(dateLayout, end)
+		if err != nil {
+			return fmt.Errorf("%s: bad end date %q", where, end)
+		}
+		if e.Before(s) {
+			return fmt.Errorf("%s: ends before it starts", where)
+		}
+		return nil
+	}
+
+	weekdays := make(map[string]string, len(c.Weekdays))
+	for day, category := range c.Weekdays {
+		day = strings.ToLower(day)
+		if _, ok := parseWeekday(day); !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+		if err := checkEntry(day, Entry{Category: category}); err != nil {
+			return err
+		}
+		weekdays[day] = category
+	}
+	c.Weekdays = weekdays
+
+	for i, t := range c.Themes {
+		where := fmt.Sprintf("theme %q", t.Name)
+		if t.Name == "" {
+			where = fmt.Sprintf("theme %d", i+1)
+		}
+		if t.End == "" {
+			return fmt.Errorf("%s: missing end date", where)
+		}
+		if err := checkRange(where, t.Start, t.End); err != nil {
+			return err
+		}
+		if err := checkEntry(where, t.Entry); err != nil {
+			return err
+		}
+	}
+	for date, e := range c.Dates {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return fmt.Errorf("bad date %q", date)
+		}
+		if err := checkEntry(date, e); err != nil {
+			return err
+		}
+	}
+	for i, b := range c.Blackouts {
+		if err := checkRange(fmt.Sprintf("blackout %d", i+1), b.Start, b.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == name {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// For returns the plan for the day t falls on. Blackouts win over date
+// overrides, which win over themes, which win over weekday rules.
+func (c *Calendar) For(t time.Time) Plan {
+	date := t.Format(dateLayout)
+	p := Plan{Date: date, Weekday: t.Weekday().String()}
+
+	for _, b := range c.Blackouts {
+		if inRange(date, b.Start, b.End) {
+			p.Source, p.Blackout, p.Reason = "blackout", true, b.Reason
+			return p
+		}
+	}
+
+	var extra []string
+	if category, ok := c.Weekdays[strings.ToLower(p.Weekday)]; ok {
+		p.Category, p.Source = category, "weekday"
+	}
+	for _, th := range c.Themes {
+		if !inRange(date, th.Start, th.End) {
+			continue
+		}
+		p.Theme, p.Source = th.Name, "theme"
+		if th.Category != "" {
+			p.Category = th.Category
+		}
+		if th.Instruction != "" {
+			extra = append(extra, th.Instruction)
+		}
+		break
+	}
+	if e, ok := c.Dates[date]; ok {
+		p.Source = "date"
+		if e.Category != "" {
+			p.Category = e.Category
+		}
+		if e.Instruction != "" {
+			extra = append(extra, e.Instruction)
+		}
+	}
+
+	var parts []string
+	if p.Category != "" {
+		parts = append(parts, c.Categories[p.Category])
+	}
+	p.Instruction = strings.Join(append(parts, extra...), " ")
+	return p
+}
+
+// Upcoming returns the plans for days consecutive days starting with the
+// day of from.
+func (c *Calendar) Upcoming(from time.Time, days int) []Plan {
+	plans := make([]Plan, 0, days)
+	y, m, d := from.Date()
+	for i := 0; i < days; i++ {
+		plans = append(plans, c.For(time.Date(y, m, d+i, 12, 0, 0, 0, from.Location())))
+	}
+	return plans
+}
+
+// inRange compares YYYY-MM-DD dates as strings, which sort by date.
+func inRange(date, start, end string) bool {
+	if end == "" {
+		end = start
+	}
+	return date >= start && date <= end
+}
@@ -0,0 +1,96 @@
+package editorial
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = `{
+  "categories": {"lld": "Write about LLD.", "hld": "Write about HLD."},
+  "weekdays": {"Monday": "lld", "friday": "hld"},
+  "themes": [{"name": "Database week", "start": "2026-10-19", "end": "2026-10-25", "category": "hld", "instruction": "Focus on databases."}],
+  "dates": {"2026-10-23": {"instruction": "Cover write-ahead logs."}},
+  "blackouts": [{"start": "2026-12-24", "end": "2026-12-26", "reason": "Holidays"}]
+}`
+
+func TestCalendarFor(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		date        string
+		source      string
+		category    string
+		instruction string
+		blackout    bool
+	}{
+		{"2026-10-12", "weekday", "lld", "Write about LLD.", false},
+		{"2026-10-14", "", "", "", false},
+		{"2026-10-19", "theme", "hld", "Write about HLD. Focus on databases.", false},
+		{"2026-10-23", "date", "hld", "Write about HLD. Focus on databases. Cover write-ahead logs.", false},
+		{"2026-12-25", "blackout", "", "", true},
+		{"2026-12-26", "blackout", "", "", true},
+		{"2026-12-28", "weekday", "lld", "Write about LLD.", false},
+	}
+	for _, tt := range tests {
+		day, _ := time.Parse(dateLayout, tt.date)
+		p := c.For(day)
+		if p.Date != tt.date || p.Source != tt.source || p.Category != tt.category || p.Instruction != tt.instruction || p.Blackout != tt.blackout {
+			t.Errorf("For(%s) = %+v", tt.date, p)
+		}
+	}
+}
+
+func TestCalendarUsesTheTimeZoneGiven(t *testing.T) {
+	c, err := Parse([]byte(testCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Late Sunday in UTC is already Monday in Tokyo
+	now := time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC)
+	if p := c.For(now); p.Date != "2026-10-18" || p.Weekday != "Sunday" {
+		t.Errorf("For in UTC = %s %s", p.Date, p.Weekday)
+	}
+	if p := c.For(now.In(tokyo)); p.Date != "2026-10-19" || p.Theme != "Database week" {
+		t.Errorf("For in Tokyo = %s %q", p.Date, p.Theme)
+	}
+
+	plans := c.Upcoming(now.In(tokyo), 3)
+	if len(plans) != 3 || plans[0].Date != "2026-10-19" || plans[2].Date != "2026-10-21" {
+		t.Errorf("Upcoming in Tokyo = %+v", plans)
+	}
+}
+
+func TestParseRejectsBadCalendars(t *testing.T) {
+	tests := map[string]string{
+		"unknown category": `{"categories": {"lld": "x"}, "weekdays": {"monday": "hld"}}`,
+		"unknown weekday":  `{"categories": {"lld": "x"}, "weekdays": {"funday": "lld"}}`,
+		"bad start date":   `{"categories": {}, "blackouts": [{"start": "24/12/2026"}]}`,
+		"ends before it":   `{"categories": {}, "blackouts": [{"start": "2026-12-26", "end": "2026-12-24"}]}`,
+		"missing end date": `{"categories": {}, "themes": [{"name": "Databases", "start": "2026-10-19"}]}`,
+		"bad date":         `{"categories": {}, "dates": {"2026-13-01": {"instruction": "x"}}}`,
+	}
+	for want, data := range tests {
+		_, err := Parse([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%s) = %v, want an error about %q", data, err, want)
+		}
+	}
+}
+
+func TestDefaultCalendar(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sunday := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	if p := c.For(sunday); p.Category != "case-study" || p.Instruction == "" {
+		t.Errorf("default Sunday = %+v", p)
+	}
+}
@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HistoryStore persists runs so they survive restarts.
+type HistoryStore interface {
+	// Save inserts or replaces the run with st.ID.
+	Save(st Status) error
+	// Recent returns up to limit runs of the named job, newest first.
+	Recent(name string, limit int) ([]Status, error)
+}
+
+// MarkInterrupted marks every run of name still recorded as running, other
+// than the run exceptID, as interrupted. Only call it while holding the
+// job's lock, when no other instance can be running it.
+func MarkInterrupted(h HistoryStore, name, exceptID string) (int, error) {
+	runs, err := h.Recent(name, 50)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, st := range runs {
+		if st.Outcome != OutcomeRunning || st.ID == exceptID {
+			continue
+		}
+		st.Running = false
+		st.Outcome = OutcomeInterrupted
+		if err := h.Save(st); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RanSince reports whether a run of name other than exceptID started at or
+// after t and neither failed nor was interrupted. Skipped runs count: they
+// mean another instance held the lock. Dry runs don't, as they send
+// nothing.
+func RanSince(h HistoryStore, name, exceptID string, t time.Time) (bool, error) {
+	runs, err := h.Recent(name, 50)
+	if err != nil {
+		return false, err
+	}
+	for _, st := range runs {
+		if st.ID == exceptID || st.StartedAt.Before(t) || st.Outcome == OutcomeInterrupted || st.Outcome == OutcomeFailed {
+			continue
+		}
+		if st.Outcome == OutcomeSkipped && st.SkipReason == SkipNotDue || st.Trigger == TriggerDryRun {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// SkipNotDue is the skip reason of a catch-up run that found nothing missed;
+// such runs don't count as the scheduled run happening.
+const SkipNotDue = "no missed run"
+
+// TriggerDryRun is the trigger of a run that only renders an issue.
+const TriggerDryRun = "dry-run"
+
+// maxFileHistory is how many runs FileHistoryStore keeps.
+const maxFileHistory = 200
+
+// FileHistoryStore keeps recent runs in a JSON file.
+type FileHistoryStore struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewFileHistoryStore(filePath string) *FileHistoryStore {
+	return &FileHistoryStore{filePath: filePath}
+}
+
+func (s *FileHistoryStore) Save(st Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range all {
+		if all[i].ID == st.ID {
+			all[i] = st
+			replaced = true
+		}
+	}
+	if !replaced {
+		all = append(all, st)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].StartedAt.Before(all[j].StartedAt) })
+	if len(all) > maxFileHistory {
+		all = all[len(all)-maxFileHistory:]
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath, data, 0644)
+}
+
+func (s *FileHistoryStore) Recent(name string, limit int) ([]Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var runs []Status
+	for i := len(all) - 1; i >= 0 && len(runs) < limit; i-- {
+		if all[i].Name == name {
+			runs = append(runs, all[i])
+		}
+	}
+	return runs, nil
+}
+
+func (s *FileHistoryStore) load() ([]Status, error) {
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var all []Status
+	return all, json.Unmarshal(data, &all)
+}
+
+// MongoHistoryStore keeps one document per run in the job_runs collection.
+type MongoHistoryStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoHistoryStore(db *mongo.Database) *MongoHistoryStore {
+	return &MongoHistoryStore{collection: db.Collection("job_runs")}
+}
+
+func (s *MongoHistoryStore) Save(st Status) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": st.ID}, st, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoHistoryStore) Recent(name string, limit int) ([]Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"name": name},
+		options.Find().SetSort(bson.M{"started_at": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var runs []Status
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRanSinceIgnoresDryRuns(t *testing.T) {
+	h := NewFileHistoryStore(filepath.Join(t.TempDir(), "job_runs.json"))
+	scheduled := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	save := func(id, trigger, outcome string, started time.Time) {
+		t.Helper()
+		if err := h.Save(Status{ID: id, Name: "Daily job", Trigger: trigger, Outcome: outcome, StartedAt: started}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("1", "schedule", OutcomeSucceeded, scheduled.Add(-24*time.Hour))
+	save("2", TriggerDryRun, OutcomeSucceeded, scheduled.Add(time.Minute))
+	if ran, err := RanSince(h, "Daily job", "catch-up", scheduled); err != nil || ran {
+		t.Errorf("RanSince = %v, %v; a dry run is not the scheduled run", ran, err)
+	}
+
+	save("3", "manual", OutcomeSucceeded, scheduled.Add(2*time.Minute))
+	if ran, err := RanSince(h, "Daily job", "catch-up", scheduled); err != nil || !ran {
+		t.Errorf("RanSince = %v, %v; want the manual run counted", ran, err)
+	}
+}
+
+func TestRanSinceIgnoresFailedRuns(t *testing.T) {
+	h := NewFileHistoryStore(filepath.Join(t.TempDir(), "job_runs.json"))
+	scheduled := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	for i, outcome := range []string{OutcomeFailed, OutcomeInterrupted} {
+		st := Status{ID: fmt.Sprint(i), Name: "Daily job", Trigger: "schedule", Outcome: outcome, StartedAt: scheduled}
+		if err := h.Save(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ran, err := RanSince(h, "Daily job", "catch-up", scheduled); err != nil || ran {
+		t.Errorf("RanSince = %v, %v; a run that failed before a restart must not block catch-up", ran, err)
+	}
+
+	st := Status{ID: "2", Name: "Daily job", Trigger: "schedule", Outcome: OutcomeSkipped, SkipReason: "another instance holds the daily job lock", StartedAt: scheduled}
+	if err := h.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := RanSince(h, "Daily job", "catch-up", scheduled); err != nil || !ran {
+		t.Errorf("RanSince = %v, %v; want a run skipped for the lock counted", ran, err)
+	}
+}
@@ -0,0 +1,286 @@
+// Package jobs runs background jobs one at a time, reports what they are
+// doing and keeps a history of past runs.
+package jobs
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyRunning is returned when a run is requested while another is in
+// progress.
+var ErrAlreadyRunning = errors.New("job is already running")
+
+// Run outcomes.
+const (
+	OutcomeRunning   = "running"
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeSkipped   = "skipped"
+	// OutcomeInterrupted marks a run whose process died before it finished.
+	OutcomeInterrupted = "interrupted"
+)
+
+// Phase is one step of a run and how long it took.
+type Phase struct {
+	Name       string    `bson:"name" json:"name"`
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time `bson:"finished_at,omitempty" json:"finished_at,omitzero"`
+	Seconds    float64   `bson:"seconds" json:"seconds"`
+}
+
+// Counts are the recipient totals of a run that sent an issue.
+type Counts struct {
+	Recipients int `bson:"recipients" json:"recipients"`
+	Sent       int `bson:"sent" json:"sent"`
+	Failed     int `bson:"failed" json:"failed"`
+	Deferred   int `bson:"deferred" json:"deferred"`
+	Skipped    int `bson:"skipped" json:"skipped"`
+	// Scheduled recipients are queued for their local delivery hour.
+	Scheduled int `bson:"scheduled" json:"scheduled"`
+}
+
+// Status describes a run. The current run's status is live; finished runs
+// are kept in the runner's History.
+type Status struct {
+	ID         string    `bson:"_id" json:"id,omitempty"`
+	Name       string    `bson:"name" json:"name"`
+	Instance   string    `bson:"instance,omitempty" json:"instance,omitempty"`
+	Running    bool      `bson:"running" json:"running"`
+	Outcome    string    `bson:"outcome,omitempty" json:"outcome,omitempty"`
+	Trigger    string    `bson:"trigger,omitempty" json:"trigger,omitempty"`
+	Phase      string    `bson:"phase,omitempty" json:"phase,omitempty"`
+	Phases     []Phase   `bson:"phases,omitempty" json:"phases,omitempty"`
+	Done       int       `bson:"done" json:"done"`
+	Total      int       `bson:"total" json:"total"`
+	IssueID    string    `bson:"issue_id,omitempty" json:"issue_id,omitempty"`
+	Counts     *Counts   `bson:"counts,omitempty" json:"counts,omitempty"`
+	StartedAt  time.Time `bson:"started_at" json:"started_at,omitzero"`
+	FinishedAt time.Time `bson:"finished_at,omitempty" json:"finished_at,omitzero"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	// SkipReason explains an OutcomeSkipped run.
+	SkipReason string `bson:"skip_reason,omitempty" json:"skip_reason,omitempty"`
+}
+
+// Job is the work done by a run. It reports its phase and progress through
+// run.
+type Job func(run *Run) error
+
+// Runner guarantees at most one run of its job at a time, however it was
+// triggered.
+type Runner struct {
+	Name string
+	// Instance identifies this process in the history, if set.
+	Instance string
+	// History keeps every run; nil keeps only the latest in memory.
+	History HistoryStore
+
+	mu       sync.Mutex
+	status   Status
+	progress func() (done, total int)
+}
+
+func NewRunner(name string) *Runner {
+	return &Runner{Name: name, status: Status{Name: name}}
+}
+
+// Run is handed to a job so it can report what it's doing.
+type Run struct {
+	r *Runner
+}
+
+// ID identifies the run in the history.
+func (run *Run) ID() string {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	return run.r.status.ID
+}
+
+// SetPhase records the step the job has reached, e.g. "generating".
+func (run *Run) SetPhase(phase string) {
+	run.r.mu.Lock()
+	log.Printf("%s: phase %s", run.r.Name, phase)
+	now := time.Now()
+	run.r.endPhase(now)
+	run.r.status.Phase = phase
+	run.r.status.Phases = append(run.r.status.Phases, Phase{Name: phase, StartedAt: now})
+	run.r.status.Done, run.r.status.Total = 0, 0
+	run.r.progress = nil
+	st := run.r.snapshot()
+	run.r.mu.Unlock()
+
+	run.r.save(st)
+}
+
+// SetProgress records how far the current phase has got.
+func (run *Run) SetProgress(done, total int) {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	run.r.status.Done, run.r.status.Total = done, total
+}
+
+// TrackProgress makes Status read the current phase's progress from fn, for
+// work that already keeps its own count. It is cleared by the next SetPhase.
+func (run *Run) TrackProgress(fn func() (done, total int)) {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	run.r.progress = fn
+}
+
+// SetIssue records which issue the run produced or sent.
+func (run *Run) SetIssue(issueID string) {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	run.r.status.IssueID = issueID
+}
+
+// SetCounts records the recipient totals of the run.
+func (run *Run) SetCounts(c Counts) {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	run.r.status.Counts = &c
+}
+
+// Skip marks the run as having nothing to do. The job should return nil
+// afterwards.
+func (run *Run) Skip(reason string) {
+	run.r.mu.Lock()
+	defer run.r.mu.Unlock()
+	log.Printf("%s: skipped: %s", run.r.Name, reason)
+	run.r.status.Outcome = OutcomeSkipped
+	run.r.status.SkipReason = reason
+}
+
+// Start runs job in the background. It returns ErrAlreadyRunning without
+// running job if a run is in progress.
+func (r *Runner) Start(trigger string, job Job) error {
+	if err := r.begin(trigger); err != nil {
+		return err
+	}
+	go r.finish(job)
+	return nil
+}
+
+// RunNow runs job and waits for it to finish. It returns ErrAlreadyRunning
+// without running job if a run is in progress.
+func (r *Runner) RunNow(trigger string, job Job) error {
+	if err := r.begin(trigger); err != nil {
+		return err
+	}
+	return r.finish(job)
+}
+
+func (r *Runner) begin(trigger string) error {
+	r.mu.Lock()
+	if r.status.Running {
+		log.Printf("%s: %s trigger ignored, a %s run started at %s is still %s",
+			r.Name, trigger, r.status.Trigger, r.status.StartedAt.Format(time.RFC3339), r.status.Phase)
+		r.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	now := time.Now()
+	r.status = Status{
+		ID:        now.UTC().Format(time.RFC3339Nano),
+		Name:      r.Name,
+		Instance:  r.Instance,
+		Running:   true,
+		Outcome:   OutcomeRunning,
+		Trigger:   trigger,
+		Phase:     "starting",
+		StartedAt: now,
+	}
+	r.progress = nil
+	st := r.snapshot()
+	r.mu.Unlock()
+
+	log.Printf("%s: started (%s)", r.Name, trigger)
+	r.save(st)
+	return nil
+}
+
+func (r *Runner) finish(job Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("%s: panic: %v", r.Name, p)
+			err = errors.New("job panicked")
+		}
+
+		r.mu.Lock()
+		now := time.Now()
+		r.endPhase(now)
+		r.status.Running = false
+		r.status.FinishedAt = now
+		if r.progress != nil {
+			r.status.Done, r.status.Total = r.progress()
+			r.progress = nil
+		}
+		took := now.Sub(r.status.StartedAt).Round(time.Second)
+		switch {
+		case err != nil:
+			r.status.Outcome = OutcomeFailed
+			r.status.Error = err.Error()
+			log.Printf("%s: failed during %s after %s: %v", r.Name, r.status.Phase, took, err)
+		case r.status.Outcome == OutcomeSkipped:
+			log.Printf("%s: finished in %s (skipped)", r.Name, took)
+		default:
+			r.status.Outcome = OutcomeSucceeded
+			log.Printf("%s: finished in %s", r.Name, took)
+		}
+		st := r.snapshot()
+		r.mu.Unlock()
+
+		r.save(st)
+	}()
+	return job(&Run{r: r})
+}
+
+// endPhase sets the duration of the phase in progress. It must be called
+// with r.mu held.
+func (r *Runner) endPhase(now time.Time) {
+	if n := len(r.status.Phases); n > 0 && r.status.Phases[n-1].FinishedAt.IsZero() {
+		p := &r.status.Phases[n-1]
+		p.FinishedAt = now
+		p.Seconds = now.Sub(p.StartedAt).Seconds()
+	}
+}
+
+// snapshot copies the status so it can be used without r.mu. It must be
+// called with r.mu held.
+func (r *Runner) snapshot() Status {
+	st := r.status
+	st.Phases = append([]Phase(nil), r.status.Phases...)
+	if r.status.Counts != nil {
+		c := *r.status.Counts
+		st.Counts = &c
+	}
+	return st
+}
+
+func (r *Runner) save(st Status) {
+	if r.History == nil {
+		return
+	}
+	if err := r.History.Save(st); err != nil {
+		log.Printf("%s: unable to save run history: %v", r.Name, err)
+	}
+}
+
+// Status reports the current run, or the last one when idle.
+func (r *Runner) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.snapshot()
+	if st.Running && r.progress != nil {
+		st.Done, st.Total = r.progress()
+	}
+	return st
+}
+
+// Running reports whether a run is in progress.
+func (r *Runner) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status.Running
+}
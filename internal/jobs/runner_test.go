@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunnerRunsOneAtATime(t *testing.T) {
+	r := NewRunner("Daily job")
+	r.History = NewFileHistoryStore(filepath.Join(t.TempDir(), "job_runs.json"))
+
+	var runs atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	job := func(run *Run) error {
+		if runs.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return nil
+	}
+
+	// Triggers from every direction at once: only one gets to run
+	const triggers = 20
+	errs := make(chan error, triggers)
+	var wg sync.WaitGroup
+	for i := 0; i < triggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs <- r.Start("manual", job)
+			} else {
+				errs <- r.RunNow("schedule", job)
+			}
+		}(i)
+	}
+	<-started
+
+	rejected := 0
+	for rejected < triggers-1 {
+		err := <-errs
+		if errors.Is(err, ErrAlreadyRunning) {
+			rejected++
+		} else if err != nil {
+			t.Fatalf("trigger: %v", err)
+		}
+	}
+	if st := r.Status(); !st.Running || st.Outcome != OutcomeRunning {
+		t.Errorf("status while running = %+v", st)
+	}
+	close(release)
+	wg.Wait()
+	// The run may have been a background Start
+	deadline := time.Now().Add(time.Second)
+	for r.Running() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("job ran %d times, want once", n)
+	}
+
+	// Once it's done the next trigger runs
+	if err := r.RunNow("manual", func(run *Run) error { return nil }); err != nil {
+		t.Fatalf("RunNow after the run finished: %v", err)
+	}
+	runsSaved, err := r.History.Recent("Daily job", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runsSaved) != 2 {
+		t.Errorf("history has %d runs, want 2", len(runsSaved))
+	}
+}
+
+func TestRunnerRecordsOutcome(t *testing.T) {
+	r := NewRunner("Daily job")
+	tests := []struct {
+		job     Job
+		outcome string
+	}{
+		{func(run *Run) error { return nil }, OutcomeSucceeded},
+		{func(run *Run) error { run.Skip("no subscribers"); return nil }, OutcomeSkipped},
+		{func(run *Run) error { return errors.New("generation failed") }, OutcomeFailed},
+		{func(run *Run) error { panic("boom") }, OutcomeFailed},
+	}
+	for _, tt := range tests {
+		r.RunNow("manual", tt.job)
+		if st := r.Status(); st.Running || st.Outcome != tt.outcome {
+			t.Errorf("status = %+v, want %s", st, tt.outcome)
+		}
+	}
+}
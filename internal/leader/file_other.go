@@ -0,0 +1,32 @@
+//go:build !unix
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errFileLockUnsupported = errors.New("file locks are not supported on this platform; set MONGO_URI")
+
+// FileLocker is only available on Unix.
+type FileLocker struct {
+	Dir string
+}
+
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{Dir: dir}
+}
+
+func (f *FileLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error) {
+	return 0, errFileLockUnsupported
+}
+
+func (f *FileLocker) Renew(ctx context.Context, name, owner string, token int64, ttl time.Duration) error {
+	return errFileLockUnsupported
+}
+
+func (f *FileLocker) Release(ctx context.Context, name, owner string, token int64) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+//go:build unix
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLocker uses flock(2) on a file per lock in Dir, for instances sharing
+// a host. The kernel drops the lock if the process dies, so the TTL is not
+// needed. The file holds the last fencing token issued.
+type FileLocker struct {
+	Dir string
+
+	mu   sync.Mutex
+	held map[string]heldLock
+}
+
+type heldLock struct {
+	file  *os.File
+	owner string
+	token int64
+}
+
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{Dir: dir, held: make(map[string]heldLock)}
+}
+
+func (f *FileLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.held[name]; ok {
+		return 0, ErrNotAcquired
+	}
+
+	file, err := os.OpenFile(filepath.Join(f.Dir, name+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return 0, ErrNotAcquired
+		}
+		return 0, fmt.Errorf("unable to lock %s: %v", file.Name(), err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	last, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	token := last + 1
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.FormatInt(token, 10)+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("unable to record fencing token: %v", err)
+	}
+
+	f.held[name] = heldLock{file: file, owner: owner, token: token}
+	return token, nil
+}
+
+func (f *FileLocker) Renew(ctx context.Context, name, owner string, token int64, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if h, ok := f.held[name]; !ok || h.owner != owner || h.token != token {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (f *FileLocker) Release(ctx context.Context, name, owner string, token int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.held[name]
+	if !ok || h.owner != owner || h.token != token {
+		return nil
+	}
+	delete(f.held, name)
+	syscall.Flock(int(h.file.Fd()), syscall.LOCK_UN)
+	return h.file.Close()
+}
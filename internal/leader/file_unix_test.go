@@ -0,0 +1,81 @@
+//go:build unix
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFileLockerExclusive(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	// Two lockers on one directory stand in for two processes: flock
+	// locks belong to the open file, not the process
+	a, b := NewFileLocker(dir), NewFileLocker(dir)
+
+	token, err := a.Acquire(ctx, "daily-job", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Acquire(ctx, "daily-job", "b", time.Minute); !errors.Is(err, ErrNotAcquired) {
+		t.Fatalf("Acquire while held by another locker = %v, want ErrNotAcquired", err)
+	}
+	if _, err := a.Acquire(ctx, "daily-job", "a2", time.Minute); !errors.Is(err, ErrNotAcquired) {
+		t.Fatalf("Acquire while held by the same locker = %v, want ErrNotAcquired", err)
+	}
+	if _, err := b.Acquire(ctx, "deferred-sends", "b", time.Minute); err != nil {
+		t.Fatalf("Acquire of another lock: %v", err)
+	}
+
+	if err := a.Renew(ctx, "daily-job", "a", token, time.Minute); err != nil {
+		t.Errorf("Renew: %v", err)
+	}
+	if err := a.Renew(ctx, "daily-job", "a", token-1, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew with a stale token = %v, want ErrLeaseLost", err)
+	}
+	if err := a.Release(ctx, "daily-job", "a", token); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Renew(ctx, "daily-job", "a", token, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Renew after Release = %v, want ErrLeaseLost", err)
+	}
+
+	next, err := b.Acquire(ctx, "daily-job", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	if next != token+1 {
+		t.Errorf("fencing token after hand-off = %d, want %d", next, token+1)
+	}
+	// A stale holder releasing does nothing
+	if err := a.Release(ctx, "daily-job", "a", token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Acquire(ctx, "daily-job", "a", time.Minute); !errors.Is(err, ErrNotAcquired) {
+		t.Errorf("Acquire after a stale Release = %v, want ErrNotAcquired", err)
+	}
+}
+
+func TestFileLockerTokensSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	var last int64
+	for i := 0; i < 3; i++ {
+		// A new locker each time, as after a restart
+		l := NewFileLocker(dir)
+		token, err := l.Acquire(ctx, "daily-job", "a", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token <= last {
+			t.Errorf("token %d after %d", token, last)
+		}
+		last = token
+		if err := l.Release(ctx, "daily-job", "a", token); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package leader makes sure only one instance runs a job at a time, using
+// a lease that must be renewed while the job runs.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned by Acquire when another owner holds the
+	// lock.
+	ErrNotAcquired = errors.New("lock is held by another instance")
+	// ErrLeaseLost means the lease expired or was taken over, so the
+	// holder must stop.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Locker grants leases on named locks. Every successful Acquire returns a
+// fencing token larger than any issued before for that name, and Renew and
+// Release only succeed for the current token, so a holder that stalled past
+// its lease can't act on behalf of the new one.
+type Locker interface {
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (token int64, err error)
+	Renew(ctx context.Context, name, owner string, token int64, ttl time.Duration) error
+	Release(ctx context.Context, name, owner string, token int64) error
+}
+
+// Owner returns an identifier for this process, unique across hosts and
+// restarts.
+func Owner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Lease is a held lock, renewed in the background every TTL/3 until
+// Release.
+type Lease struct {
+	Name  string
+	Owner string
+	Token int64
+
+	locker Locker
+	ttl    time.Duration
+	onLost func(error)
+
+	mu      sync.Mutex
+	err     error
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Acquire takes the lock name for owner. onLost, if set, is called once if
+// the lease can't be renewed.
+func Acquire(ctx context.Context, locker Locker, name, owner string, ttl time.Duration, onLost func(error)) (*Lease, error) {
+	token, err := locker.Acquire(ctx, name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lease{
+		Name:    name,
+		Owner:   owner,
+		Token:   token,
+		locker:  locker,
+		ttl:     ttl,
+		onLost:  onLost,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	log.Printf("Leader: %s acquired %s (fencing token %d)", owner, name, token)
+	go l.renew()
+	return l, nil
+}
+
+func (l *Lease) renew() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.locker.Renew(ctx, l.Name, l.Owner, l.Token, l.ttl)
+			cancel()
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrLeaseLost) {
+				// A transient error; the lease is still ours until it expires
+				log.Printf("Leader: unable to renew %s: %v", l.Name, err)
+				continue
+			}
+			log.Printf("Leader: lost %s (fencing token %d)", l.Name, l.Token)
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			if l.onLost != nil {
+				l.onLost(err)
+			}
+			return
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Err returns ErrLeaseLost once the lease has been lost.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Check confirms with the locker that the lease is still held, for use
+// before an action that must not happen twice.
+func (l *Lease) Check(ctx context.Context) error {
+	if err := l.Err(); err != nil {
+		return err
+	}
+	return l.locker.Renew(ctx, l.Name, l.Owner, l.Token, l.ttl)
+}
+
+// Release stops renewal and gives up the lock. It is safe to call more
+// than once.
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.stopped
+		// Safe even after the lease was lost: the locker ignores stale tokens
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := l.locker.Release(ctx, l.Name, l.Owner, l.Token); err != nil {
+			log.Printf("Leader: unable to release %s: %v", l.Name, err)
+			return
+		}
+		log.Printf("Leader: %s released %s", l.Owner, l.Name)
+	})
+}
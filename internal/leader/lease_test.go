@@ -0,0 +1,174 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLocker is a Locker with the same rules as MongoLocker, kept in memory.
+type memLocker struct {
+	mu       sync.Mutex
+	locks    map[string]*memLock
+	renewErr error // returned by Renew instead of renewing, if set
+}
+
+type memLock struct {
+	owner   string
+	token   int64
+	expires time.Time
+}
+
+func newMemLocker() *memLocker {
+	return &memLocker{locks: make(map[string]*memLock)}
+}
+
+func (m *memLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.locks[name]
+	if !ok {
+		l = &memLock{}
+		m.locks[name] = l
+	}
+	if time.Now().Before(l.expires) {
+		return 0, ErrNotAcquired
+	}
+	l.owner, l.expires = owner, time.Now().Add(ttl)
+	l.token++
+	return l.token, nil
+}
+
+func (m *memLocker) Renew(ctx context.Context, name, owner string, token int64, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.renewErr != nil {
+		return m.renewErr
+	}
+	l, ok := m.locks[name]
+	if !ok || l.owner != owner || l.token != token || !time.Now().Before(l.expires) {
+		return ErrLeaseLost
+	}
+	l.expires = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *memLocker) Release(ctx context.Context, name, owner string, token int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.locks[name]; ok && l.owner == owner && l.token == token {
+		l.expires = time.Time{}
+	}
+	return nil
+}
+
+// expire ends the current lease on name early, as if its holder stalled
+// past the TTL.
+func (m *memLocker) expire(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locks[name].expires = time.Time{}
+}
+
+func (m *memLocker) setRenewErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewErr = err
+}
+
+func TestLeaseRenewsUntilReleased(t *testing.T) {
+	locker := newMemLocker()
+	ctx := context.Background()
+	lease, err := Acquire(ctx, locker, "daily-job", "a", 30*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Held well past its TTL because it keeps being renewed
+	time.Sleep(100 * time.Millisecond)
+	if err := lease.Check(ctx); err != nil {
+		t.Fatalf("Check after renewals: %v", err)
+	}
+	if _, err := Acquire(ctx, locker, "daily-job", "b", time.Second, nil); !errors.Is(err, ErrNotAcquired) {
+		t.Fatalf("second Acquire = %v, want ErrNotAcquired", err)
+	}
+
+	lease.Release()
+	lease.Release()
+	next, err := Acquire(ctx, locker, "daily-job", "b", time.Second, nil)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	defer next.Release()
+	if next.Token <= lease.Token {
+		t.Errorf("token after hand-off = %d, want more than %d", next.Token, lease.Token)
+	}
+}
+
+func TestLeaseLostToAnotherOwner(t *testing.T) {
+	locker := newMemLocker()
+	ctx := context.Background()
+	lost := make(chan error, 1)
+	stale, err := Acquire(ctx, locker, "daily-job", "a", 30*time.Millisecond, func(err error) { lost <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Release()
+
+	// a stalls past its lease and b takes over
+	locker.expire("daily-job")
+	current, err := Acquire(ctx, locker, "daily-job", "b", time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer current.Release()
+	if current.Token != stale.Token+1 {
+		t.Errorf("fencing token = %d, want %d", current.Token, stale.Token+1)
+	}
+
+	if err := stale.Check(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Check with the stale token = %v, want ErrLeaseLost", err)
+	}
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("onLost got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onLost not called")
+	}
+	if err := stale.Err(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Err = %v, want ErrLeaseLost", err)
+	}
+
+	// Releasing the stale lease leaves b's alone
+	stale.Release()
+	if err := current.Check(ctx); err != nil {
+		t.Errorf("Check of the new holder after the stale release: %v", err)
+	}
+}
+
+func TestLeaseSurvivesTransientRenewErrors(t *testing.T) {
+	locker := newMemLocker()
+	ctx := context.Background()
+	lost := make(chan error, 1)
+	lease, err := Acquire(ctx, locker, "daily-job", "a", 300*time.Millisecond, func(err error) { lost <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lease.Release()
+
+	locker.setRenewErr(errors.New("connection reset"))
+	time.Sleep(150 * time.Millisecond)
+	locker.setRenewErr(nil)
+	if err := lease.Check(ctx); err != nil {
+		t.Errorf("Check after a failed renewal: %v", err)
+	}
+	select {
+	case err := <-lost:
+		t.Errorf("onLost called after a transient error: %v", err)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+package leader
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLocker keeps one document per lock in the locks collection. A lock
+// is free once its expires_at has passed; documents are never deleted so
+// tokens keep increasing.
+type MongoLocker struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLocker(db *mongo.Database) *MongoLocker {
+	return &MongoLocker{collection: db.Collection("locks")}
+}
+
+func (m *MongoLocker) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	var doc struct {
+		Token int64 `bson:"token"`
+	}
+	err := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": name, "expires_at": bson.M{"$lt": now}},
+		bson.M{
+			"$set": bson.M{"owner": owner, "acquired_at": now, "expires_at": now.Add(ttl)},
+			"$inc": bson.M{"token": int64(1)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		// The document exists and hasn't expired, so the upsert tried to
+		// insert a second one
+		return 0, ErrNotAcquired
+	}
+	if err != nil {
+		return 0, err
+	}
+	return doc.Token, nil
+}
+
+func (m *MongoLocker) Renew(ctx context.Context, name, owner string, token int64, ttl time.Duration) error {
+	res, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": name, "owner": owner, "token": token, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(ttl)}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (m *MongoLocker) Release(ctx context.Context, name, owner string, token int64) error {
+	_, err := m.collection.UpdateOne(ctx,
+		bson.M{"_id": name, "owner": owner, "token": token},
+		bson.M{"$set": bson.M{"expires_at": time.Time{}}},
+	)
+	return err
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	senderName     = "System Design Daily"
+	apiTimeout     = 30 * time.Second
+	apiErrorLength = 1024
+)
+
+// APIError is a non-2xx response from an email provider's HTTP API.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+
+	// RecipientRejected is set when the provider refused the recipient
+	// address itself (invalid, inactive or suppressed) rather than the
+	// request as a whole.
+	RecipientRejected bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API returned %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// apiRequest builds the HTTP request that delivers one message. body already
+// includes the unsubscribe footer.
+type apiRequest func(recipient, subject, body string) (*http.Request, error)
+
+// recipientRejection reports whether a provider's error response is about
+// the recipient address, reading the provider's own error format.
+type recipientRejection func(status int, body []byte) bool
+
+// sendViaAPI sends one request per recipient, collecting failures the same
+// way the SMTP and Gmail mailers do.
+func sendViaAPI(client *http.Client, provider, publicURL string, to []string, subject, bodyHTML string, build apiRequest, rejected recipientRejection) error {
+	if client == nil {
+		client = &http.Client{Timeout: apiTimeout}
+	}
+
+	var sendErr *SendError
+	for _, recipient := range to {
+		fullBody := bodyHTML + unsubscribeFooter(publicURL, recipient)
+
+		req, err := build(recipient, subject, fullBody)
+		if err == nil {
+			_, err = doAPIRequest(client, provider, req)
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && rejected != nil {
+			apiErr.RecipientRejected = rejected(apiErr.StatusCode, []byte(apiErr.Body))
+		}
+		if err != nil {
+			log.Printf("Failed to send email to %s via %s: %v", recipient, provider, err)
+			recordFailure(&sendErr, len(to), recipient, err)
+			continue
+		}
+		log.Printf("Email sent successfully to %s via %s", recipient, provider)
+	}
+	return sendResult(sendErr)
+}
+
+// doAPIRequest performs req and returns the response body, or an *APIError
+// for non-2xx responses.
+func doAPIRequest(client *http.Client, provider string, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(body) > apiErrorLength {
+			body = body[:apiErrorLength]
+		}
+		return nil, &APIError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+// listUnsubscribeURL is advertised in the List-Unsubscribe header by the API
+// mailers, matching the link in the footer.
+func listUnsubscribeURL(publicURL, recipient string) string {
+	return fmt.Sprintf("<%s/unsubscribe?email=%s>", publicURL, url.QueryEscape(recipient))
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// GoogleMailScope grants SMTP (and IMAP) access to Gmail. It also covers
+// everything GmailSendScope does.
+const GoogleMailScope = "https://mail.google.com/"
+
+// XOAuth2Auth returns an smtp.Auth for the XOAUTH2 mechanism used by Gmail
+// and Microsoft 365. A fresh access token is taken from ts for every
+// session, so an oauth2 token source that refreshes itself keeps long-lived
+// pools working.
+func XOAuth2Auth(username string, ts oauth2.TokenSource, host string) smtp.Auth {
+	return &xoauth2Auth{username: username, ts: ts, host: host}
+}
+
+type xoauth2Auth struct {
+	username string
+	ts       oauth2.TokenSource
+	host     string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := requireTLS(server, a.host); err != nil {
+		return "", nil, err
+	}
+	tok, err := a.ts.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, tok.AccessToken)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// On failure the server sends a JSON error as a challenge and
+		// expects an empty response before it replies with the real error.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// LoginAuth returns an smtp.Auth for the LOGIN mechanism, for servers that
+// don't offer PLAIN (e.g. Microsoft 365).
+func LoginAuth(username, password, host string) smtp.Auth {
+	return &loginAuth{username: username, password: password, host: host}
+}
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := requireTLS(server, a.host); err != nil {
+		return "", nil, err
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+// requireTLS mirrors smtp.PlainAuth: credentials are only sent over TLS or
+// to localhost, and only to the host they were configured for.
+func requireTLS(server *smtp.ServerInfo, host string) error {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return errors.New("unencrypted connection")
+	}
+	if server.Name != host {
+		return errors.New("wrong host name")
+	}
+	return nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// smtpAuth picks a mechanism the server advertises: XOAUTH2 when a token
+// source is configured, otherwise PLAIN, falling back to LOGIN.
+func (m *SMTPMailer) smtpAuth(mechanisms string) (smtp.Auth, error) {
+	offered := make(map[string]bool)
+	for _, mech := range strings.Fields(strings.ToUpper(mechanisms)) {
+		offered[mech] = true
+	}
+
+	if m.TokenSource != nil {
+		if !offered["XOAUTH2"] {
+			return nil, errors.New("server does not support XOAUTH2")
+		}
+		return XOAuth2Auth(m.Username, m.TokenSource, m.Host), nil
+	}
+	if !offered["PLAIN"] && offered["LOGIN"] {
+		return LoginAuth(m.Username, m.Password, m.Host), nil
+	}
+	return smtp.PlainAuth("", m.Username, m.Password, m.Host), nil
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// countingTokenSource hands out a fixed access token and counts requests.
+type countingTokenSource struct {
+	mu     sync.Mutex
+	token  string
+	tokens int
+}
+
+func (ts *countingTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens++
+	return &oauth2.Token{AccessToken: ts.token, TokenType: "Bearer"}, nil
+}
+
+func TestSMTPMailerXOAuth2(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.Username, srv.AccessToken = "news@example.com", "ya29.valid"
+
+	ts := &countingTokenSource{token: "ya29.valid"}
+	m := newTestSMTPMailer(t, srv)
+	m.TokenSource = ts
+	if err := m.Send([]string{"a@example.org"}, "x", "y"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := srv.Messages()[0].Username; got != "news@example.com" {
+		t.Errorf("authenticated as %q", got)
+	}
+
+	// Every new session asks the token source again so refreshed tokens are used
+	m.Close()
+	if err := m.Send([]string{"b@example.org"}, "x", "y"); err != nil {
+		t.Fatalf("Send after reconnect: %v", err)
+	}
+	if ts.tokens != 2 {
+		t.Errorf("token source used %d times for 2 sessions", ts.tokens)
+	}
+}
+
+func TestSMTPMailerXOAuth2Rejected(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.Username, srv.AccessToken = "news@example.com", "ya29.valid"
+
+	// The server answers a bad token with a JSON challenge; the client has
+	// to send an empty line to get the final 535 instead of a 501.
+	m := newTestSMTPMailer(t, srv)
+	m.TokenSource = &countingTokenSource{token: "ya29.expired"}
+	assertSMTPCode(t, m.Send([]string{"a@example.org"}, "x", "y"), 535)
+	if len(srv.Messages()) != 0 {
+		t.Error("message accepted with a rejected token")
+	}
+}
+
+func TestSMTPMailerXOAuth2NotOffered(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.Username, srv.AccessToken = "news@example.com", "ya29.valid"
+	srv.Mechanisms = []string{"PLAIN", "LOGIN"}
+
+	m := newTestSMTPMailer(t, srv)
+	m.TokenSource = &countingTokenSource{token: "ya29.valid"}
+	err := m.Send([]string{"a@example.org"}, "x", "y")
+	if err == nil || !strings.Contains(err.Error(), "XOAUTH2") {
+		t.Errorf("err = %v, want XOAUTH2 unsupported", err)
+	}
+}
+
+func TestSMTPMailerLogin(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.Username, srv.Password = "user", "secret"
+	srv.Mechanisms = []string{"LOGIN"}
+
+	m := newTestSMTPMailer(t, srv)
+	if err := m.Send([]string{"a@example.org"}, "x", "y"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := srv.Messages()[0].Username; got != "user" {
+		t.Errorf("authenticated as %q", got)
+	}
+
+	bad := newTestSMTPMailer(t, srv)
+	bad.Password = "wrong"
+	assertSMTPCode(t, bad.Send([]string{"a@example.org"}, "x", "y"), 535)
+}
+
+func TestLoginAuthChallenges(t *testing.T) {
+	a := LoginAuth("user", "secret", "smtp.example.com")
+	for _, tc := range []struct {
+		challenge string
+		want      string
+	}{
+		{"Username:", "user"},
+		{"password:", "secret"},
+	} {
+		resp, err := a.Next([]byte(tc.challenge), true)
+		if err != nil || string(resp) != tc.want {
+			t.Errorf("Next(%q) = %q, %v; want %q", tc.challenge, resp, err, tc.want)
+		}
+	}
+	if _, err := a.Next([]byte("Token:"), true); err == nil {
+		t.Error("answered an unknown challenge")
+	}
+}
@@ -2,81 +2,242 @@ package mailer
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/gmail/v1"
 )
 
-// getClient retrieves a token, saves the token, then returns the generated client.
-func getClient(ctx context.Context, config *oauth2.Config) *http.Client {
-	// Try to get token from ENV first (Deployment friendly)
-	tokenStr := os.Getenv("GMAIL_TOKEN_JSON")
-	var tok *oauth2.Token
-	var err error
-
-	if tokenStr != "" {
-		tok = &oauth2.Token{}
-		if err := json.Unmarshal([]byte(tokenStr), tok); err != nil {
-			log.Printf("Warning: Could not unmarshal GMAIL_TOKEN_JSON: %v", err)
-			tok = nil
-		}
+// GmailSendScope is the scope the Gmail API mailer needs.
+const GmailSendScope = gmail.GmailSendScope
+
+// ErrReauthorizationRequired means there is no usable token and an admin has
+// to go through the consent flow again.
+var ErrReauthorizationRequired = errors.New("OAuth reauthorization required")
+
+const oauthStateLifetime = 10 * time.Minute
+
+// OAuthStatus reports whether the stored token is usable.
+type OAuthStatus struct {
+	Authorized           bool      `json:"authorized"`
+	NeedsReauthorization bool      `json:"needs_reauthorization"`
+	Expiry               time.Time `json:"expiry,omitzero"`
+	LastRefresh          time.Time `json:"last_refresh,omitzero"`
+	Error                string    `json:"error,omitempty"`
+}
+
+// OAuth owns the token for one OAuth client. It is an oauth2.TokenSource
+// that refreshes the token when it expires and writes every new token back to
+// Store. When the refresh token is missing or revoked it stops trying and
+// reports that reauthorization is needed instead of blocking.
+type OAuth struct {
+	Config *oauth2.Config
+	Store  TokenStore
+
+	mu          sync.Mutex
+	token       *oauth2.Token
+	needsReauth bool
+	lastErr     error
+	lastRefresh time.Time
+	states      map[string]time.Time
+}
+
+// NewOAuth loads the current token from store. A missing token is not an
+// error: the status just reports that authorization is needed.
+func NewOAuth(config *oauth2.Config, store TokenStore) (*OAuth, error) {
+	o := &OAuth{Config: config, Store: store, states: make(map[string]time.Time)}
+	tok, err := store.Load()
+	switch {
+	case errors.Is(err, ErrNoToken):
+		o.needsReauth = true
+		o.lastErr = err
+	case err != nil:
+		return nil, fmt.Errorf("unable to load OAuth token: %v", err)
+	default:
+		o.token = tok
 	}
+	return o, nil
+}
 
-	// If not in env, try local file (Local development friendly)
-	if tok == nil {
-		tok, err = tokenFromFile("token.json")
-		if err != nil {
-			// If no token, and we are interactive, we could ask for one.
-			// But for this setup, we'll assume the user will generate it locally first.
-			log.Println("No token found in ENV or token.json. You must generate one locally.")
-			tok = getTokenFromWeb(config)
-			saveToken("token.json", tok)
+// NewGoogleOAuth parses a Google client secret JSON ("web" or "installed"
+// app) and sends users back to redirectURL after consent.
+func NewGoogleOAuth(credentialsJSON []byte, redirectURL string, store TokenStore, scopes ...string) (*OAuth, error) {
+	config, err := google.ConfigFromJSON(credentialsJSON, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+	}
+	config.RedirectURL = redirectURL
+	return NewOAuth(config, store)
+}
+
+// Token returns a valid access token, refreshing and persisting it if needed.
+func (o *OAuth) Token() (*oauth2.Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.needsReauth {
+		return nil, fmt.Errorf("%w: %v", ErrReauthorizationRequired, o.lastErr)
+	}
+	if o.token.Valid() {
+		return o.token, nil
+	}
+	if o.token.RefreshToken == "" {
+		o.needsReauth = true
+		o.lastErr = errors.New("token expired and has no refresh token")
+		return nil, fmt.Errorf("%w: %v", ErrReauthorizationRequired, o.lastErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tok, err := o.Config.TokenSource(ctx, o.token).Token()
+	if err != nil {
+		o.lastErr = err
+		var re *oauth2.RetrieveError
+		if errors.As(err, &re) && re.ErrorCode == "invalid_grant" {
+			// The refresh token was revoked or expired; retrying won't help
+			o.needsReauth = true
+			log.Printf("OAuth refresh token rejected, reauthorization required: %v", err)
+			return nil, fmt.Errorf("%w: %v", ErrReauthorizationRequired, err)
 		}
+		return nil, fmt.Errorf("unable to refresh OAuth token: %v", err)
 	}
 
-	return config.Client(ctx, tok)
+	o.token = tok
+	o.lastErr = nil
+	o.lastRefresh = time.Now()
+	if err := o.Store.Save(tok); err != nil {
+		log.Printf("Warning: could not persist refreshed OAuth token: %v", err)
+	}
+	return tok, nil
 }
 
-// Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
+// Status reports the token state without triggering a refresh.
+func (o *OAuth) Status() OAuthStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+	status := OAuthStatus{
+		Authorized:           o.token != nil && !o.needsReauth,
+		NeedsReauthorization: o.needsReauth,
+		LastRefresh:          o.lastRefresh,
+	}
+	if o.token != nil {
+		status.Expiry = o.token.Expiry
+	}
+	if o.lastErr != nil {
+		status.Error = o.lastErr.Error()
 	}
+	return status
+}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+// Exchange trades an authorization code for a token and stores it.
+func (o *OAuth) Exchange(ctx context.Context, code string) error {
+	tok, err := o.Config.Exchange(ctx, code)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return fmt.Errorf("unable to exchange authorization code: %v", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Google only returns a refresh token on first consent; keep the old one
+	if tok.RefreshToken == "" && o.token != nil {
+		tok.RefreshToken = o.token.RefreshToken
+	}
+	if err := o.Store.Save(tok); err != nil {
+		return fmt.Errorf("unable to save OAuth token: %v", err)
 	}
-	return tok
+	o.token = tok
+	o.needsReauth = false
+	o.lastErr = nil
+	return nil
 }
 
-// Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, err
+// StartHandler redirects to the provider's consent screen. It must be
+// mounted behind admin authentication; the callback trusts any request that
+// carries a state issued here.
+func (o *OAuth) StartHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, err := o.newState()
+		if err != nil {
+			log.Printf("Failed to create OAuth state: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// Force the consent prompt so Google issues a fresh refresh token
+		authURL := o.Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// CallbackHandler completes the consent flow started by StartHandler.
+func (o *OAuth) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !o.consumeState(q.Get("state")) {
+			http.Error(w, "Invalid or expired OAuth state, start the authorization again", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "Authorization was not granted: "+e, http.StatusBadRequest)
+			return
+		}
+		code := q.Get("code")
+		if code == "" {
+			http.Error(w, "Missing authorization code", http.StatusBadRequest)
+			return
+		}
+
+		if err := o.Exchange(r.Context(), code); err != nil {
+			log.Printf("OAuth callback failed: %v", err)
+			http.Error(w, "Failed to complete authorization", http.StatusBadGateway)
+			return
+		}
+
+		log.Println("OAuth authorization completed")
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>Authorized</h1><p>The token has been saved. Token expires at %s.</p>",
+			html.EscapeString(o.Status().Expiry.Format(time.RFC1123)))
+	})
+}
+
+func (o *OAuth) newState() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	for s, issued := range o.states {
+		if now.Sub(issued) > oauthStateLifetime {
+			delete(o.states, s)
+		}
+	}
+	o.states[state] = now
+	return state, nil
 }
 
-// Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+// consumeState accepts each state once, within oauthStateLifetime.
+func (o *OAuth) consumeState(state string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	issued, ok := o.states[state]
+	if !ok {
+		return false
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	delete(o.states, state)
+	return time.Since(issued) <= oauthStateLifetime
 }
@@ -0,0 +1,239 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultDKIMHeaders are signed when present in the message.
+var defaultDKIMHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner adds a DKIM-Signature header (RFC 6376) to outgoing messages
+// using relaxed/relaxed canonicalization. RSA keys sign with rsa-sha256 and
+// Ed25519 keys with ed25519-sha256 (RFC 8463).
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Headers  []string
+
+	key       crypto.Signer
+	algorithm string
+}
+
+// NewDKIMSigner parses a PEM encoded PKCS#1 or PKCS#8 private key.
+func NewDKIMSigner(domain, selector string, keyPEM []byte) (*DKIMSigner, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("dkim: no PEM block found in private key")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: unable to parse private key: %v", err)
+	}
+
+	s := &DKIMSigner{
+		Domain:   domain,
+		Selector: selector,
+		Headers:  defaultDKIMHeaders,
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		s.key, s.algorithm = k, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = k, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", parsed)
+	}
+	return s, nil
+}
+
+// LoadDKIMSigner reads the private key from a PEM file.
+func LoadDKIMSigner(domain, selector, keyFile string) (*DKIMSigner, error) {
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: unable to read private key: %v", err)
+	}
+	return NewDKIMSigner(domain, selector, keyPEM)
+}
+
+// DNSRecord returns the TXT record to publish at <selector>._domainkey.<domain>.
+func (s *DKIMSigner) DNSRecord() string {
+	switch pub := s.key.Public().(type) {
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)
+	default:
+		der, _ := x509.MarshalPKIXPublicKey(pub)
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	}
+}
+
+// Sign returns msg with a DKIM-Signature header prepended. Bare LF line
+// endings are normalized to CRLF first since that is what goes on the wire.
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	msg = normalizeCRLF(msg)
+
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, fmt.Errorf("dkim: message has no header/body separator")
+	}
+	fields := splitHeaderFields(msg[:headerEnd+2])
+	body := msg[headerEnd+4:]
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	// Sign the last occurrence of each configured header that is present.
+	var signed []string
+	var hashInput bytes.Buffer
+	used := make(map[int]bool)
+	for _, name := range s.Headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fields[i].name, name) {
+				continue
+			}
+			used[i] = true
+			signed = append(signed, strings.ToLower(name))
+			hashInput.WriteString(relaxedHeader(fields[i].name, fields[i].value))
+			hashInput.WriteString("\r\n")
+			break
+		}
+	}
+	if len(signed) == 0 {
+		return nil, fmt.Errorf("dkim: none of the configured headers are present")
+	}
+
+	sigValue := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		s.algorithm, s.Domain, s.Selector, time.Now().Unix(),
+		strings.Join(signed, ":"), base64.StdEncoding.EncodeToString(bodyHash[:]))
+	hashInput.WriteString(relaxedHeader("DKIM-Signature", sigValue))
+
+	digest := sha256.Sum256(hashInput.Bytes())
+	var sig []byte
+	var err error
+	if s.algorithm == "ed25519-sha256" {
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	} else {
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: signing failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("DKIM-Signature: ")
+	out.WriteString(sigValue)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(sig)))
+	out.WriteString("\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+type headerField struct {
+	name  string
+	value string // raw value, may contain folded CRLFs
+}
+
+// splitHeaderFields splits a CRLF-terminated header block into fields,
+// keeping continuation lines attached to the field they belong to.
+func splitHeaderFields(header []byte) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		fields = append(fields, headerField{name: line[:colon], value: line[colon+1:]})
+	}
+	return fields
+}
+
+// relaxedHeader implements the "relaxed" header canonicalization algorithm
+// (RFC 6376 section 3.4.2), without the trailing CRLF.
+func relaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value
+}
+
+// relaxedBody implements the "relaxed" body canonicalization algorithm
+// (RFC 6376 section 3.4.4).
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		line = strings.TrimRightFunc(line, isWSP)
+		var b strings.Builder
+		prevWSP := false
+		for _, r := range line {
+			if isWSP(r) {
+				if !prevWSP {
+					b.WriteByte(' ')
+				}
+				prevWSP = true
+				continue
+			}
+			prevWSP = false
+			b.WriteRune(r)
+		}
+		lines[i] = b.String()
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// normalizeCRLF converts bare LF line endings to CRLF.
+func normalizeCRLF(msg []byte) []byte {
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+}
+
+// foldBase64 breaks a long signature into folded lines. Whitespace inside
+// the b= tag is ignored by verifiers.
+func foldBase64(s string) string {
+	const width = 72
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteString("\r\n\t")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
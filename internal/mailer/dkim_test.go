@@ -0,0 +1,315 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// A message with a folded header, runs of whitespace and trailing blank
+// lines, all of which relaxed canonicalization has to cope with.
+const dkimTestMessage = "From: System Design Daily <news@example.com>\r\n" +
+	"To:   jane@example.org\r\n" +
+	"Subject: Consistent hashing,\r\n" +
+	"\tpart two  \r\n" +
+	"Date: Sun, 18 Oct 2026 07:00:00 +0000\r\n" +
+	"Message-ID: <1.abc@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
+	"X-Not-Signed: anything\r\n" +
+	"\r\n" +
+	"<p>Hello   Jane,</p>  \r\n" +
+	"<p>Rings\tand   virtual nodes.</p>\r\n" +
+	"\r\n" +
+	"\r\n"
+
+func newRSASigner(t *testing.T) *DKIMSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	s, err := NewDKIMSigner("example.com", "mail", pemKey)
+	if err != nil {
+		t.Fatalf("NewDKIMSigner: %v", err)
+	}
+	return s
+}
+
+func newEd25519Signer(t *testing.T) *DKIMSigner {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDKIMSigner("example.com", "ed", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("NewDKIMSigner: %v", err)
+	}
+	return s
+}
+
+func TestDKIMSignVerifies(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		signer    func(*testing.T) *DKIMSigner
+		algorithm string
+	}{
+		{"rsa", newRSASigner, "rsa-sha256"},
+		{"ed25519", newEd25519Signer, "ed25519-sha256"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.signer(t)
+			signed, err := s.Sign([]byte(dkimTestMessage))
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			tags, err := verifyDKIM(signed, s.DNSRecord())
+			if err != nil {
+				t.Fatalf("verify: %v\n%s", err, signed)
+			}
+			if tags["a"] != tc.algorithm || tags["c"] != "relaxed/relaxed" || tags["d"] != "example.com" {
+				t.Errorf("unexpected tags %v", tags)
+			}
+			if strings.Contains(tags["h"], "x-not-signed") {
+				t.Errorf("signed an unconfigured header: h=%s", tags["h"])
+			}
+
+			// Changes relaxed canonicalization ignores keep the signature valid
+			relaxed := bytes.Replace(signed, []byte("Subject: Consistent hashing,\r\n\tpart two  \r\n"),
+				[]byte("subject:Consistent   hashing,\r\n part two\r\n"), 1)
+			relaxed = bytes.Replace(relaxed, []byte("<p>Hello   Jane,</p>  "), []byte("<p>Hello Jane,</p>"), 1)
+			relaxed = append(relaxed, "\r\n\r\n"...)
+			if _, err := verifyDKIM(relaxed, s.DNSRecord()); err != nil {
+				t.Errorf("relaxed-equivalent message failed: %v", err)
+			}
+
+			tampered := bytes.Replace(signed, []byte("virtual nodes"), []byte("virtual node"), 1)
+			if _, err := verifyDKIM(tampered, s.DNSRecord()); err == nil {
+				t.Error("tampered body verified")
+			}
+			tampered = bytes.Replace(signed, []byte("part two"), []byte("part three"), 1)
+			if _, err := verifyDKIM(tampered, s.DNSRecord()); err == nil {
+				t.Error("tampered header verified")
+			}
+			other := tc.signer(t)
+			if _, err := verifyDKIM(signed, other.DNSRecord()); err == nil {
+				t.Error("verified with another key")
+			}
+		})
+	}
+}
+
+func TestDKIMSignNormalizesLF(t *testing.T) {
+	s := newEd25519Signer(t)
+	lf := strings.ReplaceAll(dkimTestMessage, "\r\n", "\n")
+	signed, err := s.Sign([]byte(lf))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if bytes.Contains(bytes.ReplaceAll(signed, []byte("\r\n"), nil), []byte("\n")) {
+		t.Error("bare LF left in signed message")
+	}
+	if _, err := verifyDKIM(signed, s.DNSRecord()); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+func TestDKIMSignEmptyBody(t *testing.T) {
+	s := newRSASigner(t)
+	signed, err := s.Sign([]byte("From: a@example.com\r\nSubject: x\r\n\r\n\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	tags, err := verifyDKIM(signed, s.DNSRecord())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	// An empty body canonicalizes to nothing under relaxed
+	empty := sha256.Sum256(nil)
+	if tags["bh"] != base64.StdEncoding.EncodeToString(empty[:]) {
+		t.Errorf("bh = %s, want hash of the empty string", tags["bh"])
+	}
+}
+
+// verifyDKIM checks the first DKIM-Signature of msg against the public key
+// in a DNS TXT record, following RFC 6376 independently of the signer's own
+// helpers. It returns the signature's tags.
+func verifyDKIM(msg []byte, record string) (map[string]string, error) {
+	raw := string(msg)
+	end := strings.Index(raw, "\r\n\r\n")
+	if end < 0 {
+		return nil, errors.New("no header/body separator")
+	}
+	header, body := raw[:end+2], raw[end+4:]
+
+	// Split into unfolded fields, keeping the raw text of each
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	fieldName := func(f string) string { return strings.ToLower(strings.TrimSpace(f[:strings.IndexByte(f, ':')])) }
+
+	var sigField string
+	for _, f := range fields {
+		if fieldName(f) == "dkim-signature" {
+			sigField = f
+			break
+		}
+	}
+	if sigField == "" {
+		return nil, errors.New("no DKIM-Signature header")
+	}
+	tags := parseTags(sigField[strings.IndexByte(sigField, ':')+1:])
+
+	// Body hash
+	canonBody := canonBodyRelaxed(body)
+	bh := sha256.Sum256([]byte(canonBody))
+	if got := base64.StdEncoding.EncodeToString(bh[:]); got != tags["bh"] {
+		return tags, fmt.Errorf("body hash mismatch: computed %s, header says %s", got, tags["bh"])
+	}
+
+	// Header hash: signed fields bottom-up, then the signature without b=
+	var data strings.Builder
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && fieldName(fields[i]) == name {
+				used[i] = true
+				data.WriteString(canonHeaderRelaxed(fields[i]) + "\r\n")
+				break
+			}
+		}
+	}
+	data.WriteString(canonHeaderRelaxed(blankB(sigField)))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return tags, fmt.Errorf("bad b= tag: %v", err)
+	}
+	key, err := publicKeyFromRecord(record)
+	if err != nil {
+		return tags, err
+	}
+	digest := sha256.Sum256([]byte(data.String()))
+	switch tags["a"] {
+	case "rsa-sha256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return tags, errors.New("record is not an RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return tags, fmt.Errorf("signature: %v", err)
+		}
+	case "ed25519-sha256":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return tags, errors.New("record is not an Ed25519 key")
+		}
+		if !ed25519.Verify(pub, digest[:], sig) {
+			return tags, errors.New("signature: verification failed")
+		}
+	default:
+		return tags, fmt.Errorf("unknown algorithm %q", tags["a"])
+	}
+	return tags, nil
+}
+
+// parseTags reads a tag=value list, dropping all whitespace from values as
+// the b= and bh= tags may be folded.
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, value)
+		tags[strings.TrimSpace(name)] = value
+	}
+	return tags
+}
+
+// blankB empties the value of the b= tag, leaving every other tag alone.
+func blankB(field string) string {
+	parts := strings.Split(field, ";")
+	for i, part := range parts {
+		if name, _, ok := strings.Cut(part, "="); ok && strings.TrimSpace(name) == "b" {
+			parts[i] = part[:strings.Index(part, "=")+1]
+			if strings.HasSuffix(part, "\r\n") {
+				parts[i] += "\r\n"
+			}
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func canonHeaderRelaxed(field string) string {
+	colon := strings.IndexByte(field, ':')
+	name := strings.ToLower(strings.TrimSpace(field[:colon]))
+	value := strings.NewReplacer("\r\n", "").Replace(field[colon+1:])
+	value = regexp.MustCompile(`[ \t]+`).ReplaceAllString(value, " ")
+	return name + ":" + strings.TrimSpace(value)
+}
+
+func canonBodyRelaxed(body string) string {
+	lines := strings.Split(body, "\r\n")
+	ws := regexp.MustCompile(`[ \t]+`)
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(ws.ReplaceAllString(l, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func publicKeyFromRecord(record string) (crypto.PublicKey, error) {
+	tags := parseTags(record)
+	der, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, fmt.Errorf("bad p= tag: %v", err)
+	}
+	switch tags["k"] {
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(der), nil
+	case "rsa", "":
+		return x509.ParsePKIXPublicKey(der)
+	}
+	return nil, fmt.Errorf("unknown key type %q", tags["k"])
+}
@@ -0,0 +1,240 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultCooldown         = 10 * time.Minute
+	maxDeliveryLog          = 1000
+)
+
+// Transport is a named Mailer taking part in a FailoverMailer.
+type Transport struct {
+	Name   string
+	Mailer Mailer
+}
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"    // healthy, messages flow normally
+	CircuitOpen     = "open"      // failing, skipped until the cooldown ends
+	CircuitHalfOpen = "half-open" // cooldown over, one trial message allowed
+)
+
+// TransportHealth is a snapshot of a transport's health counters.
+type TransportHealth struct {
+	Name                string    `json:"name"`
+	State               string    `json:"state"`
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+}
+
+// Delivery records which transport delivered a message to a recipient.
+type Delivery struct {
+	Recipient string    `json:"recipient"`
+	Transport string    `json:"transport"`
+	Attempts  int       `json:"attempts"`
+	At        time.Time `json:"at"`
+}
+
+type transportState struct {
+	Transport
+	health   TransportHealth
+	trialing bool
+}
+
+// FailoverMailer tries its transports in priority order for every recipient
+// and moves on to the next one when a transport fails. Each transport has a
+// circuit breaker: after FailureThreshold consecutive failures it is skipped
+// for Cooldown, then a single trial message decides whether it is healthy
+// again. A rejected recipient (see IsRecipientError) is not a transport
+// failure: it is returned straight away and left out of the breaker's
+// counts.
+type FailoverMailer struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	// OnDelivery, if set, is called after every successful delivery.
+	OnDelivery func(Delivery)
+
+	mu         sync.Mutex
+	transports []*transportState
+	deliveries []Delivery
+}
+
+func NewFailoverMailer(transports ...Transport) *FailoverMailer {
+	f := &FailoverMailer{
+		FailureThreshold: defaultFailureThreshold,
+		Cooldown:         defaultCooldown,
+	}
+	for _, t := range transports {
+		f.transports = append(f.transports, &transportState{
+			Transport: t,
+			health:    TransportHealth{Name: t.Name, State: CircuitClosed},
+		})
+	}
+	return f
+}
+
+func (f *FailoverMailer) Send(to []string, subject, bodyHTML string) error {
+	var sendErr *SendError
+	for _, recipient := range to {
+		if err := f.sendOne(recipient, subject, bodyHTML); err != nil {
+			recordFailure(&sendErr, len(to), recipient, err)
+		}
+	}
+	return sendResult(sendErr)
+}
+
+func (f *FailoverMailer) sendOne(recipient, subject, bodyHTML string) error {
+	var lastErr error
+	var quotaErr *QuotaError
+	attempts := 0
+	for _, t := range f.transports {
+		if !f.allow(t) {
+			continue
+		}
+		attempts++
+		err := recipientError(t.Mailer.Send([]string{recipient}, subject, bodyHTML), recipient)
+
+		// An exhausted quota isn't a fault: spill over without tripping
+		// the breaker, remembering the earliest reset for deferral
+		var qe *QuotaError
+		if errors.As(err, &qe) {
+			f.release(t)
+			if quotaErr == nil || qe.ResetAt.Before(quotaErr.ResetAt) {
+				quotaErr = qe
+			}
+			continue
+		}
+
+		// The transport works, the address doesn't: other transports
+		// would refuse it too
+		if IsRecipientError(err) {
+			f.release(t)
+			log.Printf("Transport %s rejected recipient %s: %v", t.Name, recipient, err)
+			return err
+		}
+
+		f.record(t, err)
+		if err == nil {
+			d := Delivery{Recipient: recipient, Transport: t.Name, Attempts: attempts, At: time.Now()}
+			f.logDelivery(d)
+			return nil
+		}
+		log.Printf("Transport %s failed for %s: %v", t.Name, recipient, err)
+		lastErr = err
+	}
+	if quotaErr != nil {
+		// Trying again once the quota resets may succeed where the other
+		// transports failed
+		return quotaErr
+	}
+	if lastErr == nil {
+		lastErr = ErrNoTransport
+	}
+	return lastErr
+}
+
+// release ends a half-open trial that didn't tell whether the transport is
+// healthy.
+func (f *FailoverMailer) release(t *transportState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.trialing = false
+}
+
+// allow reports whether t may be used right now, moving an open breaker to
+// half-open once its cooldown has passed.
+func (f *FailoverMailer) allow(t *transportState) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch t.health.State {
+	case CircuitOpen:
+		if time.Now().Before(t.health.OpenUntil) {
+			return false
+		}
+		t.health.State = CircuitHalfOpen
+		log.Printf("Transport %s cooldown over, sending a trial message", t.Name)
+		fallthrough
+	case CircuitHalfOpen:
+		if t.trialing {
+			return false
+		}
+		t.trialing = true
+	}
+	return true
+}
+
+func (f *FailoverMailer) record(t *transportState, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t.trialing = false
+	if err == nil {
+		t.health.Successes++
+		t.health.ConsecutiveFailures = 0
+		if t.health.State != CircuitClosed {
+			log.Printf("Transport %s recovered, closing circuit", t.Name)
+		}
+		t.health.State = CircuitClosed
+		return
+	}
+
+	t.health.Failures++
+	t.health.ConsecutiveFailures++
+	t.health.LastError = err.Error()
+	t.health.LastFailure = time.Now()
+	if t.health.State == CircuitHalfOpen || t.health.ConsecutiveFailures >= f.FailureThreshold {
+		t.health.State = CircuitOpen
+		t.health.OpenUntil = time.Now().Add(f.Cooldown)
+		log.Printf("Transport %s opened circuit after %d consecutive failures, skipping until %s",
+			t.Name, t.health.ConsecutiveFailures, t.health.OpenUntil.Format(time.RFC3339))
+	}
+}
+
+func (f *FailoverMailer) logDelivery(d Delivery) {
+	log.Printf("Delivered to %s via %s (attempt %d)", d.Recipient, d.Transport, d.Attempts)
+
+	f.mu.Lock()
+	f.deliveries = append(f.deliveries, d)
+	if len(f.deliveries) > maxDeliveryLog {
+		f.deliveries = f.deliveries[len(f.deliveries)-maxDeliveryLog:]
+	}
+	onDelivery := f.OnDelivery
+	f.mu.Unlock()
+
+	if onDelivery != nil {
+		onDelivery(d)
+	}
+}
+
+// Health returns a snapshot of every transport in priority order.
+func (f *FailoverMailer) Health() []TransportHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]TransportHealth, len(f.transports))
+	for i, t := range f.transports {
+		out[i] = t.health
+	}
+	return out
+}
+
+// Deliveries returns the most recent deliveries, oldest first.
+func (f *FailoverMailer) Deliveries() []Delivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]Delivery, len(f.deliveries))
+	copy(out, f.deliveries)
+	return out
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+)
+
+// stubMailer fails every recipient with err and counts calls.
+type stubMailer struct {
+	err   error
+	calls int
+}
+
+func (m *stubMailer) Send(to []string, subject, bodyHTML string) error {
+	m.calls++
+	if m.err == nil {
+		return nil
+	}
+	var sendErr *SendError
+	for _, r := range to {
+		recordFailure(&sendErr, len(to), r, m.err)
+	}
+	return sendResult(sendErr)
+}
+
+func TestFailoverRecipientRejection(t *testing.T) {
+	primary := &stubMailer{err: &textproto.Error{Code: 550, Msg: "5.1.1 User unknown"}}
+	backup := &stubMailer{}
+	f := NewFailoverMailer(Transport{"primary", primary}, Transport{"backup", backup})
+
+	to := []string{"a@x.org", "b@x.org", "c@x.org", "d@x.org", "e@x.org", "f@x.org"}
+	err := f.Send(to, "s", "b")
+
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || len(sendErr.Failed) != len(to) {
+		t.Fatalf("err = %v, want every recipient rejected", err)
+	}
+	if backup.calls != 0 {
+		t.Errorf("rejected recipients were retried on the backup %d times", backup.calls)
+	}
+	h := f.Health()[0]
+	if h.State != CircuitClosed || h.ConsecutiveFailures != 0 || h.Failures != 0 {
+		t.Errorf("primary health = %+v, want closed with no failures", h)
+	}
+}
+
+func TestFailoverTransportFailureOpensBreaker(t *testing.T) {
+	primary := &stubMailer{err: &textproto.Error{Code: 421, Msg: "4.3.2 Service not available"}}
+	backup := &stubMailer{}
+	f := NewFailoverMailer(Transport{"primary", primary}, Transport{"backup", backup})
+	f.FailureThreshold = 3
+
+	to := []string{"a@x.org", "b@x.org", "c@x.org", "d@x.org", "e@x.org"}
+	if err := f.Send(to, "s", "b"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if primary.calls != 3 {
+		t.Errorf("primary tried %d times, want 3 before the breaker opened", primary.calls)
+	}
+	if backup.calls != 5 {
+		t.Errorf("backup used %d times, want 5", backup.calls)
+	}
+	if got := f.Health()[0].State; got != CircuitOpen {
+		t.Errorf("primary state = %s, want open", got)
+	}
+}
+
+func TestIsRecipientError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "5.1.1 The email account does not exist"}, true},
+		{&textproto.Error{Code: 552, Msg: "5.2.2 Mailbox full"}, true},
+		{&textproto.Error{Code: 450, Msg: "4.2.1 Mailbox busy"}, true},
+		{&textproto.Error{Code: 550, Msg: "No such user here"}, true},
+		{&textproto.Error{Code: 553, Msg: "Mailbox name not allowed"}, true},
+		{&textproto.Error{Code: 550, Msg: "5.7.1 Relaying denied"}, false},
+		{&textproto.Error{Code: 554, Msg: "Transaction failed"}, false},
+		{&textproto.Error{Code: 535, Msg: "5.7.8 Authentication failed"}, false},
+		{&textproto.Error{Code: 421, Msg: "Service not available"}, false},
+		{&APIError{Provider: "Postmark", StatusCode: 422, RecipientRejected: true}, true},
+		{&APIError{Provider: "SendGrid", StatusCode: 401}, false},
+		{&SendError{Total: 1, Failed: map[string]error{"a@x.org": &textproto.Error{Code: 551, Msg: "User not local"}}}, true},
+		{errors.New("connection reset by peer"), false},
+	} {
+		if got := IsRecipientError(tc.err); got != tc.want {
+			t.Errorf("IsRecipientError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every outgoing message to disk instead of delivering it,
+// so the whole daily job can be run offline. Messages are stored as plain
+// .eml files, or in Maildir layout (tmp/new/cur) when Maildir is set.
+type FileMailer struct {
+	Dir       string
+	Maildir   bool
+	Sender    string
+	PublicURL string
+
+	// DKIM signs every message before it is written, if set.
+	DKIM *DKIMSigner
+
+	// OnWrite, if set, is called with the path and size of every message
+	// written.
+	OnWrite func(recipient, path string, size int)
+}
+
+func NewFileMailer(dir string, maildir bool, sender, publicURL string) (*FileMailer, error) {
+	subdirs := []string{""}
+	if maildir {
+		subdirs = []string{"tmp", "new", "cur"}
+	}
+	for _, sub := range subdirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("unable to create mail directory: %v", err)
+		}
+	}
+
+	return &FileMailer{
+		Dir:       dir,
+		Maildir:   maildir,
+		Sender:    sender,
+		PublicURL: publicURL,
+	}, nil
+}
+
+func (m *FileMailer) Send(to []string, subject, bodyHTML string) error {
+	var sendErr *SendError
+	for _, recipient := range to {
+		fromHeader := fmt.Sprintf("System Design Daily <%s>", m.Sender)
+		fullBody := bodyHTML + unsubscribeFooter(m.PublicURL, recipient)
+
+		msg := composeMessage(fromHeader, recipient, subject, fullBody)
+		if m.DKIM != nil {
+			signed, err := m.DKIM.Sign(msg)
+			if err != nil {
+				log.Printf("Failed to DKIM sign email to %s: %v", recipient, err)
+				recordFailure(&sendErr, len(to), recipient, err)
+				continue
+			}
+			msg = signed
+		}
+
+		path, err := m.write(recipient, msg)
+		if err != nil {
+			log.Printf("Failed to write email to %s: %v", recipient, err)
+			recordFailure(&sendErr, len(to), recipient, err)
+			continue
+		}
+		log.Printf("Email to %s written to %s", recipient, path)
+		if m.OnWrite != nil {
+			m.OnWrite(recipient, path, len(msg))
+		}
+	}
+	return sendResult(sendErr)
+}
+
+func (m *FileMailer) write(recipient string, msg []byte) (string, error) {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	if !m.Maildir {
+		name := fmt.Sprintf("%s-%s-%s.eml",
+			time.Now().Format("20060102-150405"), sanitizeFileName(recipient), hex.EncodeToString(suffix))
+		path := filepath.Join(m.Dir, name)
+		return path, os.WriteFile(path, msg, 0644)
+	}
+
+	// Maildir delivery: write into tmp/ and atomically move into new/.
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%d_%s.%s", time.Now().UnixNano(), os.Getpid(), hex.EncodeToString(suffix), sanitizeFileName(host))
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, msg, 0644); err != nil {
+		return "", err
+	}
+	path := filepath.Join(m.Dir, "new", name)
+	return path, os.Rename(tmpPath, path)
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
 )
@@ -15,21 +14,18 @@ type GmailMailer struct {
 	Service   *gmail.Service
 	Sender    string
 	PublicURL string
-}
 
-func NewGmailMailer(ctx context.Context, senderEmail, publicURL string, credentialsJSON []byte) (*GmailMailer, error) {
-	// 1. Parse the credentials (looks for "web" or "installed" app in JSON)
-	config, err := google.ConfigFromJSON(credentialsJSON, gmail.GmailSendScope)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
-	}
+	// DKIM signs every message before it is handed to the API, if set.
+	DKIM *DKIMSigner
 
-	// 2. Retrieve the token from environment variable or file
-	// For server-side (Render), passing the token JSON via ENV is safest/easiest
-	// so we don't have to do an interactive login flow on the server.
-	client := getClient(ctx, config)
+	Auth *OAuth
+}
 
-	srv, err := gmail.NewService(ctx, option.WithHTTPClient(client))
+func NewGmailMailer(ctx context.Context, senderEmail, publicURL string, auth *OAuth) (*GmailMailer, error) {
+	// The token comes from auth, which refreshes and persists it. Without a
+	// token the mailer still starts; sends fail until an admin completes
+	// the consent flow at /admin/oauth/gmail.
+	srv, err := gmail.NewService(ctx, option.WithTokenSource(auth))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Gmail client: %v", err)
 	}
@@ -38,6 +34,7 @@ func NewGmailMailer(ctx context.Context, senderEmail, publicURL string, credenti
 		Service:   srv,
 		Sender:    senderEmail,
 		PublicURL: publicURL,
+		Auth:      auth,
 	},
 	nil
 }
@@ -47,35 +44,44 @@ func (m *GmailMailer) Send(to []string, subject, bodyHTML string) error {
 		return nil
 	}
 
+	var sendErr *SendError
+	if m.Auth != nil {
+		// Fail fast instead of making one doomed API call per recipient
+		if _, err := m.Auth.Token(); err != nil {
+			log.Printf("Gmail API unavailable: %v", err)
+			for _, recipient := range to {
+				recordFailure(&sendErr, len(to), recipient, err)
+			}
+			return sendResult(sendErr)
+		}
+	}
 	for _, recipient := range to {
 		var message gmail.Message
 
-		unsubscribeHTML := fmt.Sprintf(
-			`<br><br><hr><p style="font-size: 12px; color: #666; text-align: center;">
-			<a href="%s/unsubscribe?email=%s">Unsubscribe</a> from these emails.</p>`,
-			m.PublicURL, recipient,
-		)
-
-		fullBody := bodyHTML + unsubscribeHTML
+		fullBody := bodyHTML + unsubscribeFooter(m.PublicURL, recipient)
 
 		// Construct the email message (MIME)
-		emailContent := fmt.Sprintf("From: %s\r\n" +
-			"To: %s\r\n" +
-			"Subject: %s\r\n" +
-			"MIME-Version: 1.0\r\n" +
-			"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
-			"\r\n" +
-			"%s", m.Sender, recipient, subject, fullBody)
+		emailContent := composeMessage(m.Sender, recipient, subject, fullBody)
+		if m.DKIM != nil {
+			signed, err := m.DKIM.Sign(emailContent)
+			if err != nil {
+				log.Printf("Failed to DKIM sign email to %s: %v", recipient, err)
+				recordFailure(&sendErr, len(to), recipient, err)
+				continue
+			}
+			emailContent = signed
+		}
 
 		// Gmail API requires base64url encoding
-		message.Raw = base64.URLEncoding.EncodeToString([]byte(emailContent))
+		message.Raw = base64.URLEncoding.EncodeToString(emailContent)
 
 		_, err := m.Service.Users.Messages.Send("me", &message).Do()
 		if err != nil {
 			log.Printf("Failed to send email to %s via API: %v", recipient, err)
+			recordFailure(&sendErr, len(to), recipient, err)
 		} else {
 			log.Printf("Email sent successfully to %s via API", recipient)
 		}
 	}
-	return nil
+	return sendResult(sendErr)
 }
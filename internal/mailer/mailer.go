@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Mailer delivers an HTML message to each recipient individually.
+// Implementations keep going when a single recipient fails and report the
+// failures together as a *SendError.
+type Mailer interface {
+	Send(to []string, subject, bodyHTML string) error
+}
+
+// ErrNoTransport is returned when every transport is unavailable.
+var ErrNoTransport = errors.New("no healthy transport available")
+
+// SendError lists the recipients a Send call could not deliver to.
+type SendError struct {
+	Total  int
+	Failed map[string]error
+}
+
+func (e *SendError) Error() string {
+	recipients := make([]string, 0, len(e.Failed))
+	for r := range e.Failed {
+		recipients = append(recipients, r)
+	}
+	sort.Strings(recipients)
+	if len(recipients) == 1 {
+		return fmt.Sprintf("failed to send to %s: %v", recipients[0], e.Failed[recipients[0]])
+	}
+	return fmt.Sprintf("failed to send to %d of %d recipients: %s", len(recipients), e.Total, strings.Join(recipients, ", "))
+}
+
+// Unwrap exposes the per-recipient errors to errors.Is and errors.As.
+func (e *SendError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// recordFailure adds a failed recipient to *errp, creating the SendError on
+// first use.
+func recordFailure(errp **SendError, total int, recipient string, err error) {
+	if *errp == nil {
+		*errp = &SendError{Total: total, Failed: make(map[string]error)}
+	}
+	(*errp).Failed[recipient] = err
+}
+
+// sendResult converts an accumulated SendError into a plain error so that a
+// nil *SendError does not become a non-nil interface.
+func sendResult(sendErr *SendError) error {
+	if sendErr == nil {
+		return nil
+	}
+	return sendErr
+}
+
+// recipientError returns the underlying error for recipient when err is a
+// SendError, so wrapping mailers don't nest the same message.
+func recipientError(err error, recipient string) error {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		if inner, ok := sendErr.Failed[recipient]; ok {
+			return inner
+		}
+	}
+	return err
+}
+
+// IsRecipientError reports whether err rejects the recipient rather than the
+// transport: the mailbox is unknown, full or refused, or a provider API
+// turned down the address. Another transport would get the same answer.
+//
+// SMTP replies are judged by their enhanced status code when they have one
+// (x.1.x addressing and x.2.x mailbox problems), otherwise by the reply
+// code (450, 550, 551 and 553). Policy rejections such as "550 5.7.1" are
+// about the sender and so don't count.
+func IsRecipientError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RecipientRejected
+	}
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return false
+	}
+	if class, subject, ok := enhancedStatus(tpErr.Msg); ok {
+		return (class == '4' || class == '5') && (subject == '1' || subject == '2')
+	}
+	switch tpErr.Code {
+	case 450, 550, 551, 553:
+		return true
+	}
+	return false
+}
+
+// enhancedStatus returns the class and subject digits of an RFC 3463
+// enhanced status code at the start of an SMTP reply text, e.g. "5.1.1".
+func enhancedStatus(msg string) (class, subject byte, ok bool) {
+	code, _, _ := strings.Cut(strings.TrimSpace(msg), " ")
+	parts := strings.Split(code, ".")
+	if len(parts) != 3 || len(parts[0]) != 1 || len(parts[1]) == 0 || len(parts[2]) == 0 {
+		return 0, 0, false
+	}
+	for _, p := range parts {
+		for _, r := range p {
+			if r < '0' || r > '9' {
+				return 0, 0, false
+			}
+		}
+	}
+	return parts[0][0], parts[1][0], true
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const mailgunBaseURL = "https://api.mailgun.net"
+
+// MailgunMailer sends through the Mailgun messages API.
+type MailgunMailer struct {
+	APIKey    string
+	Domain    string
+	Sender    string
+	PublicURL string
+
+	// BaseURL overrides the API endpoint, e.g. https://api.eu.mailgun.net
+	// for EU domains or a test server.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewMailgunMailer(apiKey, domain, sender, publicURL string) *MailgunMailer {
+	return &MailgunMailer{
+		APIKey:    apiKey,
+		Domain:    domain,
+		Sender:    sender,
+		PublicURL: publicURL,
+		BaseURL:   mailgunBaseURL,
+	}
+}
+
+func (m *MailgunMailer) Send(to []string, subject, bodyHTML string) error {
+	return sendViaAPI(m.HTTPClient, "Mailgun", m.PublicURL, to, subject, bodyHTML,
+		func(recipient, subject, body string) (*http.Request, error) {
+			form := url.Values{}
+			form.Set("from", fmt.Sprintf("%s <%s>", senderName, m.Sender))
+			form.Set("to", recipient)
+			form.Set("subject", subject)
+			form.Set("html", body)
+			form.Set("h:List-Unsubscribe", listUnsubscribeURL(m.PublicURL, recipient))
+			// Lets webhook events be matched to a subscriber without parsing headers
+			form.Set("v:recipient", recipient)
+
+			endpoint := fmt.Sprintf("%s/v3/%s/messages", strings.TrimRight(m.BaseURL, "/"), url.PathEscape(m.Domain))
+			req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+			if err != nil {
+				return nil, err
+			}
+			req.SetBasicAuth("api", m.APIKey)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return req, nil
+		}, mailgunRejectsRecipient)
+}
+
+// mailgunRejectsRecipient spots a 400 about the "to" parameter, e.g.
+// "'to' parameter is not a valid address".
+func mailgunRejectsRecipient(status int, body []byte) bool {
+	if status != http.StatusBadRequest {
+		return false
+	}
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(resp.Message), "'to' parameter")
+}
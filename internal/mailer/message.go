@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// unsubscribeFooter is appended to every outgoing body so each recipient gets
+// a one-click link tied to their own address.
+func unsubscribeFooter(publicURL, recipient string) string {
+	return fmt.Sprintf(
+		`<br><br><hr><p style="font-size: 12px; color: #666; text-align: center;">
+			<a href="%s/unsubscribe?email=%s">Unsubscribe</a> from these emails.</p>`,
+		publicURL, url.QueryEscape(recipient),
+	)
+}
+
+// composeMessage builds a complete RFC 5322 message for a single recipient.
+// Lines end in CRLF and the HTML body is quoted-printable encoded so long
+// generated lines never exceed the SMTP line limit.
+func composeMessage(from, to, subject, bodyHTML string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", newMessageID(from, to))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(bodyHTML))
+	qp.Close()
+
+	return buf.Bytes()
+}
+
+// newMessageID returns a unique Message-ID on the sender's domain. The
+// recipient is embedded so that bounces quoting the original headers can be
+// traced back to the subscriber (see RecipientFromMessageID).
+func newMessageID(from, to string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimRight(from[at+1:], ">")
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s.r-%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b),
+		base64.RawURLEncoding.EncodeToString([]byte(to)), domain)
+}
+
+// RecipientFromMessageID extracts the recipient embedded by newMessageID.
+func RecipientFromMessageID(id string) (string, bool) {
+	id = strings.Trim(strings.TrimSpace(id), "<>")
+	at := strings.LastIndex(id, "@")
+	if at < 0 {
+		return "", false
+	}
+	for _, part := range strings.Split(id[:at], ".") {
+		if !strings.HasPrefix(part, "r-") {
+			continue
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(part[2:])
+		if err != nil || !strings.Contains(string(raw), "@") {
+			return "", false
+		}
+		return string(raw), true
+	}
+	return "", false
+}
+
+// VERPAddress encodes recipient into a variable envelope return path based on
+// bounceAddr, e.g. bounces@example.com and jane@mail.org become
+// bounces+jane=mail.org@example.com. Bounces are then delivered to an
+// address that identifies the original recipient.
+func VERPAddress(bounceAddr, recipient string) string {
+	at := strings.LastIndex(bounceAddr, "@")
+	rat := strings.LastIndex(recipient, "@")
+	if at < 0 || rat < 0 {
+		return bounceAddr
+	}
+	return bounceAddr[:at] + "+" + recipient[:rat] + "=" + recipient[rat+1:] + bounceAddr[at:]
+}
+
+// RecipientFromVERP reverses VERPAddress.
+func RecipientFromVERP(addr string) (string, bool) {
+	addr = strings.Trim(strings.TrimSpace(addr), "<>")
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return "", false
+	}
+	local := addr[:at]
+	plus := strings.Index(local, "+")
+	eq := strings.LastIndex(local, "=")
+	if plus < 0 || eq < plus {
+		return "", false
+	}
+	return local[plus+1:eq] + "@" + local[eq+1:], true
+}
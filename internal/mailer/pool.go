@@ -0,0 +1,212 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxMessagesPerConn = 100
+	defaultIdleTimeout        = 30 * time.Second
+	defaultMaxIdleConns       = 2
+	defaultSMTPTimeout        = time.Minute
+)
+
+// smtpPool keeps authenticated SMTP sessions open so that a batch of
+// messages goes out over a handful of connections instead of one per
+// recipient. Sessions are reused with RSET and retired after a fixed number
+// of messages or when they have been idle long enough for the server to have
+// dropped them. Every exchange with the server (connecting, sending one
+// message, closing) has to finish within timeout, so a half-dead socket
+// can't hold a session forever.
+type smtpPool struct {
+	dial        dialFunc
+	maxMessages int
+	idleTimeout time.Duration
+	timeout     time.Duration
+	maxIdle     int
+
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+// dialFunc opens an authenticated session that must be ready by deadline.
+// It returns the underlying connection as well so that later exchanges can
+// be given deadlines of their own.
+type dialFunc func(deadline time.Time) (net.Conn, *smtp.Client, error)
+
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	timeout  time.Duration
+	sent     int
+	lastUsed time.Time
+}
+
+func newSMTPPool(dial dialFunc, maxMessages int, idleTimeout, timeout time.Duration) *smtpPool {
+	if maxMessages <= 0 {
+		maxMessages = defaultMaxMessagesPerConn
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	return &smtpPool{
+		dial:        dial,
+		maxMessages: maxMessages,
+		idleTimeout: idleTimeout,
+		timeout:     timeout,
+		maxIdle:     defaultMaxIdleConns,
+	}
+}
+
+// Send delivers a single message over a pooled session. If a reused session
+// turns out to be dead the message is retried once on a fresh connection.
+func (p *smtpPool) Send(from string, to []string, msg []byte) error {
+	c, reused, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	err = c.send(from, to, msg)
+	if err != nil && reused && isConnError(err) {
+		log.Printf("SMTP session went away (%v), reconnecting", err)
+		c.client.Close()
+		c, err = p.connect()
+		if err != nil {
+			return err
+		}
+		err = c.send(from, to, msg)
+	}
+
+	if err != nil {
+		if isConnError(err) {
+			c.client.Close()
+		} else {
+			// The server rejected this transaction but the session is fine.
+			p.put(c)
+		}
+		return err
+	}
+
+	c.sent++
+	p.put(c)
+	return nil
+}
+
+// Close ends every idle session and stops the pool from keeping new ones.
+func (p *smtpPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.quit()
+	}
+	return nil
+}
+
+// get returns a ready session, preferring an idle one. Reused sessions are
+// probed with RSET, which also clears any state left by the last transaction.
+func (p *smtpPool) get() (*smtpConn, bool, error) {
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			c, err := p.connect()
+			return c, false, err
+		}
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(c.lastUsed) > p.idleTimeout {
+			c.quit()
+			continue
+		}
+		c.extendDeadline()
+		if err := c.client.Reset(); err != nil {
+			c.client.Close()
+			continue
+		}
+		return c, true, nil
+	}
+}
+
+func (p *smtpPool) put(c *smtpConn) {
+	c.lastUsed = time.Now()
+	if c.sent >= p.maxMessages {
+		c.quit()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.maxIdle {
+		p.mu.Unlock()
+		c.quit()
+		return
+	}
+	p.idle = append(p.idle, c)
+	p.mu.Unlock()
+}
+
+func (p *smtpPool) connect() (*smtpConn, error) {
+	conn, client, err := p.dial(time.Now().Add(p.timeout))
+	if err != nil {
+		return nil, err
+	}
+	return &smtpConn{conn: conn, client: client, timeout: p.timeout, lastUsed: time.Now()}, nil
+}
+
+// extendDeadline gives the next exchange on c its own timeout.
+func (c *smtpConn) extendDeadline() {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+}
+
+func (c *smtpConn) send(from string, to []string, msg []byte) error {
+	c.extendDeadline()
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (c *smtpConn) quit() {
+	c.extendDeadline()
+	if err := c.client.Quit(); err != nil {
+		c.client.Close()
+	}
+}
+
+// isConnError reports whether err means the session itself is unusable, as
+// opposed to the server answering with an SMTP error code. A 421 reply is the
+// server announcing that it is closing the connection.
+func isConnError(err error) bool {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code == 421
+	}
+	return true
+}
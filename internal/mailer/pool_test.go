@@ -0,0 +1,180 @@
+package mailer
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/mailer/smtptest"
+)
+
+func startSMTPServer(t *testing.T) *smtptest.Server {
+	t.Helper()
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func newTestSMTPMailer(t *testing.T, srv *smtptest.Server) *SMTPMailer {
+	t.Helper()
+	m := NewSMTPMailer(srv.Host(), srv.Port(), srv.Username, srv.Password, "news@example.com", "https://example.com")
+	m.TLSConfig = srv.ClientTLSConfig()
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func count(list []string, s string) int {
+	n := 0
+	for _, v := range list {
+		if v == s {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPoolReusesSession(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+
+	if err := m.Send([]string{"a@example.com", "b@example.com", "c@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := m.Send([]string{"d@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+	if got := len(srv.Messages()); got != 4 {
+		t.Errorf("messages = %d, want 4", got)
+	}
+	// Every message after the first starts with RSET on the reused session
+	if got := count(srv.Commands(), "RSET"); got != 3 {
+		t.Errorf("RSET sent %d times, want 3", got)
+	}
+}
+
+func TestPoolRotatesAfterMaxMessages(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+	m.MaxMessagesPerConn = 2
+
+	to := []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"}
+	if err := m.Send(to, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := srv.Connections(); got != 3 {
+		t.Errorf("connections = %d, want 3", got)
+	}
+	// The two full sessions are closed politely
+	if got := count(srv.Commands(), "QUIT"); got != 2 {
+		t.Errorf("QUIT sent %d times, want 2", got)
+	}
+}
+
+func TestPoolExpiresIdleSessions(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+	m.IdleTimeout = 50 * time.Millisecond
+
+	if err := m.Send([]string{"a@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := m.Send([]string{"b@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+	if got := count(srv.Commands(), "RSET"); got != 0 {
+		t.Errorf("expired session was probed with RSET %d times", got)
+	}
+}
+
+func TestPoolReconnectsAfterDrop(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+
+	if err := m.Send([]string{"a@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	srv.DropConnections()
+	if err := m.Send([]string{"b@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send after drop: %v", err)
+	}
+
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+	if got := len(srv.Messages()); got != 2 {
+		t.Errorf("messages = %d, want 2", got)
+	}
+}
+
+func TestPoolTimesOutStalledServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Greet, then never answer
+		conn.Write([]byte("220 stalled ESMTP\r\n"))
+		io.Copy(io.Discard, conn)
+	}()
+
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	m := NewSMTPMailer(host, port, "", "", "news@example.com", "https://example.com")
+	m.Timeout = 200 * time.Millisecond
+	defer m.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- m.Send([]string{"a@example.com"}, "Hi", "<p>x</p>") }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Send to a stalled server succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send blocked on a stalled server")
+	}
+}
+
+func TestPoolTimesOutHungSession(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+	m.Timeout = 200 * time.Millisecond
+
+	if err := m.Send([]string{"a@example.com"}, "Hi", "<p>x</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	srv.Hang("MAIL")
+
+	start := time.Now()
+	if err := m.Send([]string{"b@example.com"}, "Hi", "<p>x</p>"); err == nil {
+		t.Fatal("Send on a hung session succeeded")
+	}
+	// The reused session times out, and so does the retry on a fresh one
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v with a 200ms timeout", elapsed)
+	}
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const postmarkBaseURL = "https://api.postmarkapp.com"
+
+// PostmarkMailer sends through the Postmark email API.
+type PostmarkMailer struct {
+	ServerToken string
+	Sender      string
+	PublicURL   string
+
+	// MessageStream selects the Postmark stream; newsletters belong in a
+	// broadcast stream. Empty uses the server's default transactional stream.
+	MessageStream string
+
+	// BaseURL overrides the API endpoint, e.g. for a test server.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewPostmarkMailer(serverToken, sender, publicURL string) *PostmarkMailer {
+	return &PostmarkMailer{
+		ServerToken: serverToken,
+		Sender:      sender,
+		PublicURL:   publicURL,
+		BaseURL:     postmarkBaseURL,
+	}
+}
+
+type postmarkHeader struct {
+	Name  string
+	Value string
+}
+
+type postmarkRequest struct {
+	From          string
+	To            string
+	Subject       string
+	HtmlBody      string
+	MessageStream string `json:",omitempty"`
+	Headers       []postmarkHeader
+}
+
+func (m *PostmarkMailer) Send(to []string, subject, bodyHTML string) error {
+	return sendViaAPI(m.HTTPClient, "Postmark", m.PublicURL, to, subject, bodyHTML,
+		func(recipient, subject, body string) (*http.Request, error) {
+			data, err := json.Marshal(postmarkRequest{
+				From:          fmt.Sprintf("%s <%s>", senderName, m.Sender),
+				To:            recipient,
+				Subject:       subject,
+				HtmlBody:      body,
+				MessageStream: m.MessageStream,
+				Headers:       []postmarkHeader{{Name: "List-Unsubscribe", Value: listUnsubscribeURL(m.PublicURL, recipient)}},
+			})
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequest(http.MethodPost, strings.TrimRight(m.BaseURL, "/")+"/email", bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("X-Postmark-Server-Token", m.ServerToken)
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		}, postmarkRejectsRecipient)
+}
+
+// Postmark API error codes about the recipient.
+const (
+	postmarkInvalidEmail      = 300
+	postmarkInactiveRecipient = 406
+)
+
+// postmarkRejectsRecipient spots a 422 with an invalid or inactive
+// (bounced, complained or unsubscribed) recipient error code.
+func postmarkRejectsRecipient(status int, body []byte) bool {
+	if status != http.StatusUnprocessableEntity {
+		return false
+	}
+	var resp struct {
+		ErrorCode int
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return resp.ErrorCode == postmarkInvalidEmail || resp.ErrorCode == postmarkInactiveRecipient
+}
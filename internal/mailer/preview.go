@@ -0,0 +1,242 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PreviewHandler is a small web viewer for messages written by FileMailer.
+// It lists the stored messages newest first and renders a single message's
+// HTML body in a sandboxed iframe.
+type PreviewHandler struct {
+	Dir    string
+	Prefix string // URL path the handler is mounted at, e.g. "/outbox/"
+}
+
+func NewPreviewHandler(dir, prefix string) *PreviewHandler {
+	return &PreviewHandler{Dir: dir, Prefix: prefix}
+}
+
+type storedMessage struct {
+	Name    string
+	path    string
+	ModTime time.Time
+	From    string
+	To      string
+	Subject string
+	Date    string
+}
+
+func (h *PreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, h.Prefix)
+	if name == "" {
+		h.serveList(w)
+		return
+	}
+
+	msgs, err := h.messages()
+	if err != nil {
+		http.Error(w, "Unable to read mail directory", http.StatusInternalServerError)
+		return
+	}
+	for _, m := range msgs {
+		if m.Name == name {
+			h.serveMessage(w, r, m)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (h *PreviewHandler) serveList(w http.ResponseWriter) {
+	msgs, err := h.messages()
+	if err != nil {
+		http.Error(w, "Unable to read mail directory", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	listTemplate.Execute(w, struct {
+		Prefix   string
+		Messages []storedMessage
+	}{h.Prefix, msgs})
+}
+
+func (h *PreviewHandler) serveMessage(w http.ResponseWriter, r *http.Request, m storedMessage) {
+	raw, err := os.ReadFile(m.path)
+	if err != nil {
+		http.Error(w, "Unable to read message", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("raw") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(raw)
+		return
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		http.Error(w, "Unable to parse message", http.StatusInternalServerError)
+		return
+	}
+	body, err := htmlBody(msg.Header, msg.Body)
+	if err != nil {
+		http.Error(w, "Unable to decode message body", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	messageTemplate.Execute(w, struct {
+		Prefix  string
+		Message storedMessage
+		Body    string
+	}{h.Prefix, m, body})
+}
+
+// messages returns every stored message, newest first. Maildir folders are
+// searched in new/ and cur/, plain folders directly.
+func (h *PreviewHandler) messages() ([]storedMessage, error) {
+	var msgs []storedMessage
+	for _, sub := range []string{"", "new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(h.Dir, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || (sub == "" && !strings.HasSuffix(e.Name(), ".eml")) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			m := storedMessage{Name: e.Name(), path: filepath.Join(h.Dir, sub, e.Name()), ModTime: info.ModTime()}
+			if f, err := os.Open(m.path); err == nil {
+				if msg, err := mail.ReadMessage(f); err == nil {
+					dec := new(mime.WordDecoder)
+					m.From = msg.Header.Get("From")
+					m.To = msg.Header.Get("To")
+					m.Date = msg.Header.Get("Date")
+					m.Subject, _ = dec.DecodeHeader(msg.Header.Get("Subject"))
+				}
+				f.Close()
+			}
+			msgs = append(msgs, m)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ModTime.After(msgs[j].ModTime) })
+	return msgs, nil
+}
+
+// htmlBody extracts the decoded text/html part of a message.
+func htmlBody(header mail.Header, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var fallback string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := htmlBody(mail.Header(part.Header), part)
+			if err != nil {
+				return "", err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "text/html" || strings.HasPrefix(partType, "multipart/") {
+				return text, nil
+			}
+			if fallback == "" {
+				fallback = text
+			}
+		}
+		return fallback, nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if mediaType != "text/html" {
+		return fmt.Sprintf("<pre>%s</pre>", template.HTMLEscapeString(string(b))), nil
+	}
+	return string(b), nil
+}
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Outbox</title>
+<style>
+	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; max-width: 1000px; margin: 0 auto; padding: 20px; color: #333; }
+	table { width: 100%; border-collapse: collapse; }
+	th, td { text-align: left; padding: 8px; border-bottom: 1px solid #eee; }
+	a { color: #2980b9; }
+</style>
+</head>
+<body>
+	<h1>Outbox</h1>
+	{{if not .Messages}}<p>No messages yet.</p>{{else}}
+	<table>
+		<tr><th>Date</th><th>To</th><th>Subject</th></tr>
+		{{range .Messages}}
+		<tr><td>{{.Date}}</td><td>{{.To}}</td><td><a href="{{$.Prefix}}{{.Name}}">{{.Subject}}</a></td></tr>
+		{{end}}
+	</table>
+	{{end}}
+</body>
+</html>`))
+
+var messageTemplate = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Message.Subject}}</title>
+<style>
+	body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; max-width: 1000px; margin: 0 auto; padding: 20px; color: #333; }
+	dl { display: grid; grid-template-columns: max-content auto; gap: 4px 12px; }
+	dt { font-weight: bold; }
+	iframe { width: 100%; height: 80vh; border: 1px solid #ddd; }
+	a { color: #2980b9; }
+</style>
+</head>
+<body>
+	<p><a href="{{.Prefix}}">&larr; Outbox</a> &middot; <a href="{{.Prefix}}{{.Message.Name}}?raw=1">Raw source</a></p>
+	<dl>
+		<dt>From</dt><dd>{{.Message.From}}</dd>
+		<dt>To</dt><dd>{{.Message.To}}</dd>
+		<dt>Subject</dt><dd>{{.Message.Subject}}</dd>
+		<dt>Date</dt><dd>{{.Message.Date}}</dd>
+	</dl>
+	<iframe sandbox="" srcdoc="{{.Body}}"></iframe>
+</body>
+</html>`))
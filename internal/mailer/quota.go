@@ -0,0 +1,269 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultQuotaWarnAt = 0.8
+
+// ErrQuotaExceeded matches every *QuotaError.
+var ErrQuotaExceeded = errors.New("sending quota exhausted")
+
+// QuotaError is returned for recipients that could not be sent because a
+// transport's quota for the current window is used up.
+type QuotaError struct {
+	Transport string
+	Limit     int
+	ResetAt   time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s daily quota of %d exhausted until %s", e.Transport, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// QuotaStore persists per-transport usage so limits survive restarts.
+type QuotaStore interface {
+	// Increment adds n (which may be negative) to the usage of name in
+	// window and returns the new total.
+	Increment(name, window string, n int) (int, error)
+	Usage(name, window string) (int, error)
+}
+
+// QuotaUsage is a snapshot of a transport's quota.
+type QuotaUsage struct {
+	Transport string    `json:"transport"`
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	Window    string    `json:"window"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// QuotaMailer enforces a daily send limit on a transport. Every message
+// counts against the quota once it is attempted. Recipients over the limit
+// fail with a *QuotaError without touching the transport, so a
+// FailoverMailer can spill them over to the next transport and the
+// newsletter sender can defer them to the next window.
+type QuotaMailer struct {
+	Name   string
+	Mailer Mailer
+	Limit  int
+	Store  QuotaStore
+
+	// WarnAt is the fraction of Limit at which a warning is logged.
+	WarnAt float64
+	// Location sets where the daily window starts; nil means UTC.
+	Location *time.Location
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func NewQuotaMailer(name string, m Mailer, limit int, store QuotaStore) *QuotaMailer {
+	return &QuotaMailer{
+		Name:   name,
+		Mailer: m,
+		Limit:  limit,
+		Store:  store,
+		WarnAt: defaultQuotaWarnAt,
+		warned: make(map[string]bool),
+	}
+}
+
+func (q *QuotaMailer) Send(to []string, subject, bodyHTML string) error {
+	var sendErr *SendError
+	for _, recipient := range to {
+		if err := q.reserve(); err != nil {
+			recordFailure(&sendErr, len(to), recipient, err)
+			continue
+		}
+		if err := q.Mailer.Send([]string{recipient}, subject, bodyHTML); err != nil {
+			recordFailure(&sendErr, len(to), recipient, recipientError(err, recipient))
+		}
+	}
+	return sendResult(sendErr)
+}
+
+// reserve claims one message from the current window's quota.
+func (q *QuotaMailer) reserve() error {
+	window, resetAt := q.window(time.Now())
+	used, err := q.Store.Increment(q.Name, window, 1)
+	if err != nil {
+		// Don't stop sending because the counter is unavailable
+		log.Printf("Quota: unable to update usage for %s: %v", q.Name, err)
+		return nil
+	}
+	if used > q.Limit {
+		if _, err := q.Store.Increment(q.Name, window, -1); err != nil {
+			log.Printf("Quota: unable to release usage for %s: %v", q.Name, err)
+		}
+		q.warnOnce(window+"/exhausted", "Quota: %s reached its daily limit of %d, deferring until %s", q.Name, q.Limit, resetAt.Format(time.RFC3339))
+		return &QuotaError{Transport: q.Name, Limit: q.Limit, ResetAt: resetAt}
+	}
+	if float64(used) >= q.WarnAt*float64(q.Limit) {
+		q.warnOnce(window+"/warn", "Quota: %s has used %d of %d messages today", q.Name, used, q.Limit)
+	}
+	return nil
+}
+
+func (q *QuotaMailer) warnOnce(key, format string, args ...interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.warned[key] {
+		return
+	}
+	if q.warned == nil || len(q.warned) > 100 {
+		q.warned = make(map[string]bool)
+	}
+	q.warned[key] = true
+	log.Printf(format, args...)
+}
+
+// window returns the key of the daily window containing t and when it ends.
+func (q *QuotaMailer) window(t time.Time) (string, time.Time) {
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+// Usage reports the current window's usage.
+func (q *QuotaMailer) Usage() QuotaUsage {
+	window, resetAt := q.window(time.Now())
+	used, err := q.Store.Usage(q.Name, window)
+	if err != nil {
+		log.Printf("Quota: unable to read usage for %s: %v", q.Name, err)
+	}
+	remaining := q.Limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return QuotaUsage{Transport: q.Name, Limit: q.Limit, Used: used, Remaining: remaining, Window: window, ResetAt: resetAt}
+}
+
+// FileQuotaStore keeps usage in a JSON file. Only the latest window of each
+// transport is kept.
+type FileQuotaStore struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewFileQuotaStore(filePath string) *FileQuotaStore {
+	return &FileQuotaStore{filePath: filePath}
+}
+
+type quotaRecord struct {
+	Window string `json:"window"`
+	Used   int    `json:"used"`
+}
+
+func (s *FileQuotaStore) Increment(name, window string, n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	rec := records[name]
+	if rec.Window != window {
+		rec = quotaRecord{Window: window}
+	}
+	rec.Used += n
+	if rec.Used < 0 {
+		rec.Used = 0
+	}
+	records[name] = rec
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return rec.Used, os.WriteFile(s.filePath, data, 0644)
+}
+
+func (s *FileQuotaStore) Usage(name, window string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	if rec := records[name]; rec.Window == window {
+		return rec.Used, nil
+	}
+	return 0, nil
+}
+
+func (s *FileQuotaStore) load() (map[string]quotaRecord, error) {
+	records := make(map[string]quotaRecord)
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return records, json.Unmarshal(data, &records)
+}
+
+// MongoQuotaStore keeps usage in the mail_quota collection, one document per
+// transport and window, updated atomically.
+type MongoQuotaStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoQuotaStore(db *mongo.Database) *MongoQuotaStore {
+	return &MongoQuotaStore{collection: db.Collection("mail_quota")}
+}
+
+func (s *MongoQuotaStore) Increment(name, window string, n int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Used int `bson:"used"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": name + "/" + window},
+		bson.M{
+			"$inc": bson.M{"used": n},
+			"$set": bson.M{"transport": name, "window": window, "updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	return doc.Used, err
+}
+
+func (s *MongoQuotaStore) Usage(name, window string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc struct {
+		Used int `bson:"used"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"_id": name + "/" + window}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return doc.Used, err
+}
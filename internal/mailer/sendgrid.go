@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const sendGridBaseURL = "https://api.sendgrid.com"
+
+// SendGridMailer sends through the SendGrid v3 Mail Send API.
+type SendGridMailer struct {
+	APIKey    string
+	Sender    string
+	PublicURL string
+
+	// BaseURL overrides the API endpoint, e.g. for a regional endpoint or a
+	// test server.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewSendGridMailer(apiKey, sender, publicURL string) *SendGridMailer {
+	return &SendGridMailer{
+		APIKey:    apiKey,
+		Sender:    sender,
+		PublicURL: publicURL,
+		BaseURL:   sendGridBaseURL,
+	}
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (m *SendGridMailer) Send(to []string, subject, bodyHTML string) error {
+	return sendViaAPI(m.HTTPClient, "SendGrid", m.PublicURL, to, subject, bodyHTML,
+		func(recipient, subject, body string) (*http.Request, error) {
+			payload := sendGridRequest{
+				Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: recipient}}}},
+				From:             sendGridAddress{Email: m.Sender, Name: senderName},
+				Subject:          subject,
+				Content:          []sendGridContent{{Type: "text/html", Value: body}},
+				Headers:          map[string]string{"List-Unsubscribe": listUnsubscribeURL(m.PublicURL, recipient)},
+			}
+
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequest(http.MethodPost, strings.TrimRight(m.BaseURL, "/")+"/v3/mail/send", bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+m.APIKey)
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		}, sendGridRejectsRecipient)
+}
+
+// sendGridRejectsRecipient spots a 400 whose errors point at the "to"
+// address, e.g. field "personalizations.0.to.0.email".
+func sendGridRejectsRecipient(status int, body []byte) bool {
+	if status != http.StatusBadRequest {
+		return false
+	}
+	var resp struct {
+		Errors []struct {
+			Field string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	for _, e := range resp.Errors {
+		if strings.HasPrefix(e.Field, "personalizations") && strings.Contains(e.Field, ".to") {
+			return true
+		}
+	}
+	return false
+}
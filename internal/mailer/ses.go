@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SESMailer sends through the Amazon SES v2 SendEmail API. Requests are
+// signed with AWS Signature Version 4, so no AWS SDK is needed.
+type SESMailer struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // for temporary credentials, optional
+	Sender          string
+	PublicURL       string
+
+	// ConfigurationSet routes bounce, complaint and delivery events to the
+	// SNS topic the webhook subscribes to.
+	ConfigurationSet string
+
+	// Endpoint overrides https://email.<region>.amazonaws.com, e.g. for a
+	// test server.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+func NewSESMailer(region, accessKeyID, secretAccessKey, sender, publicURL string) *SESMailer {
+	return &SESMailer{
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Sender:          sender,
+		PublicURL:       publicURL,
+		Endpoint:        fmt.Sprintf("https://email.%s.amazonaws.com", region),
+	}
+}
+
+type sesContent struct {
+	Data    string
+	Charset string `json:",omitempty"`
+}
+
+type sesHeader struct {
+	Name  string
+	Value string
+}
+
+type sesRequest struct {
+	FromEmailAddress string
+	Destination      struct {
+		ToAddresses []string
+	}
+	Content struct {
+		Simple struct {
+			Subject sesContent
+			Body    struct {
+				Html sesContent
+			}
+			Headers []sesHeader `json:",omitempty"`
+		}
+	}
+	ConfigurationSetName string `json:",omitempty"`
+}
+
+func (m *SESMailer) Send(to []string, subject, bodyHTML string) error {
+	return sendViaAPI(m.HTTPClient, "SES", m.PublicURL, to, subject, bodyHTML,
+		func(recipient, subject, body string) (*http.Request, error) {
+			var payload sesRequest
+			payload.FromEmailAddress = fmt.Sprintf("%s <%s>", senderName, m.Sender)
+			payload.Destination.ToAddresses = []string{recipient}
+			payload.Content.Simple.Subject = sesContent{Data: subject, Charset: "UTF-8"}
+			payload.Content.Simple.Body.Html = sesContent{Data: body, Charset: "UTF-8"}
+			payload.Content.Simple.Headers = []sesHeader{{Name: "List-Unsubscribe", Value: listUnsubscribeURL(m.PublicURL, recipient)}}
+			payload.ConfigurationSetName = m.ConfigurationSet
+
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequest(http.MethodPost, strings.TrimRight(m.Endpoint, "/")+"/v2/email/outbound-emails", bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			signV4(req, data, m.AccessKeyID, m.SecretAccessKey, m.SessionToken, m.Region, "ses", time.Now())
+			return req, nil
+		}, sesRejectsRecipient)
+}
+
+// sesRejectsRecipient spots a 400 about a malformed destination address.
+// Other rejections, such as an unverified sender, concern the account.
+func sesRejectsRecipient(status int, body []byte) bool {
+	if status != http.StatusBadRequest {
+		return false
+	}
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	msg := strings.ToLower(resp.Message)
+	return strings.Contains(msg, "illegal address") || strings.Contains(msg, "missing final '@domain'") ||
+		strings.Contains(msg, "invalid address")
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req.
+func signV4(req *http.Request, payload []byte, accessKeyID, secretAccessKey, sessionToken, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	// Canonical headers: lowercase names, sorted, trimmed values
+	var names []string
+	headers := make(map[string]string)
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
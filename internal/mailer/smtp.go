@@ -3,9 +3,18 @@ package mailer
 import (
 	"crypto/tls"
 	"fmt"
+	"log"
+	"net"
 	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
 )
 
+const smtpDialTimeout = 30 * time.Second
+
 type SMTPMailer struct {
 	Host      string
 	Port      int
@@ -13,6 +22,37 @@ type SMTPMailer struct {
 	Password  string
 	Sender    string
 	PublicURL string
+
+	// MaxMessagesPerConn caps how many messages are sent over one session
+	// before it is retired. IdleTimeout is how long an unused session is
+	// trusted to still be open. Zero values fall back to sane defaults.
+	MaxMessagesPerConn int
+	IdleTimeout        time.Duration
+
+	// Timeout bounds each exchange with the server: connecting and
+	// authenticating, sending one message, or closing. Defaults to a minute.
+	Timeout time.Duration
+
+	// ImplicitTLS starts TLS before the SMTP greeting. It is implied for
+	// port 465.
+	ImplicitTLS bool
+
+	// TLSConfig overrides the TLS settings used for implicit TLS and
+	// STARTTLS, e.g. to trust a private CA. ServerName defaults to Host.
+	TLSConfig *tls.Config
+
+	// BounceAddress, if set, is used as a VERP envelope sender so bounces
+	// identify the recipient they belong to (see VERPAddress).
+	BounceAddress string
+
+	// DKIM signs every message before it is handed to the server, if set.
+	DKIM *DKIMSigner
+
+	// TokenSource, if set, authenticates with XOAUTH2 instead of Password.
+	TokenSource oauth2.TokenSource
+
+	poolOnce sync.Once
+	pool     *smtpPool
 }
 
 func NewSMTPMailer(host string, port int, user, pass, sender, publicURL string) *SMTPMailer {
@@ -31,90 +71,107 @@ func (m *SMTPMailer) Send(to []string, subject, bodyHTML string) error {
 		return nil
 	}
 
-	auth := smtp.PlainAuth("", m.Username, m.Password, m.Host)
-	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
-
-	// Headers
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	pool := m.connPool()
 
+	var sendErr *SendError
 	for _, recipient := range to {
 		// Use a display name + the sender email address
 		fromHeader := fmt.Sprintf("System Design Daily <%s>", m.Sender)
 
-		unsubscribeHTML := fmt.Sprintf(
-			`<br><br><hr><p style="font-size: 12px; color: #666; text-align: center;">
-			<a href="%s/unsubscribe?email=%s">Unsubscribe</a> from these emails.</p>`,
-			m.PublicURL, recipient,
-		)
-
-		fullBody := bodyHTML + unsubscribeHTML
-
-		msg := []byte(fmt.Sprintf("To: %s\r\n"+
-			"From: %s\r\n"+
-			"Subject: %s\r\n"+
-			"%s"+
-			"%s", recipient, fromHeader, subject, mime, fullBody))
-
-		var err error
-		if m.Port == 465 {
-			// Implicit TLS
-			fmt.Println("Using Implicit TLS (Port 465) for email sending...")
-			err = m.sendMailTLS(addr, auth, recipient, msg)
-		} else {
-			// Standard SMTP (likely STARTTLS or plain)
-			fmt.Printf("Using Standard SMTP (Port %d) for email sending...\n", m.Port)
-			err = smtp.SendMail(addr, auth, m.Sender, []string{recipient}, msg)
+		fullBody := bodyHTML + unsubscribeFooter(m.PublicURL, recipient)
+
+		msg := composeMessage(fromHeader, recipient, subject, fullBody)
+		if m.DKIM != nil {
+			signed, err := m.DKIM.Sign(msg)
+			if err != nil {
+				log.Printf("Failed to DKIM sign email to %s: %v", recipient, err)
+				recordFailure(&sendErr, len(to), recipient, err)
+				continue
+			}
+			msg = signed
 		}
 
-		if err != nil {
-			fmt.Printf("Failed to send email to %s: %v\n", recipient, err)
+		envelopeFrom := m.Sender
+		if m.BounceAddress != "" {
+			envelopeFrom = VERPAddress(m.BounceAddress, recipient)
+		}
+
+		if err := pool.Send(envelopeFrom, []string{recipient}, msg); err != nil {
+			log.Printf("Failed to send email to %s: %v", recipient, err)
+			recordFailure(&sendErr, len(to), recipient, err)
 		}
 	}
 
-	return nil
+	return sendResult(sendErr)
 }
 
-func (m *SMTPMailer) sendMailTLS(addr string, auth smtp.Auth, to string, msg []byte) error {
-	// TLS config
-	tlsconfig := &tls.Config{
-		InsecureSkipVerify: false,
-		ServerName:         m.Host,
-	}
+// Close ends any pooled SMTP sessions.
+func (m *SMTPMailer) Close() error {
+	return m.connPool().Close()
+}
 
-	conn, err := tls.Dial("tcp", addr, tlsconfig)
-	if err != nil {
-		return err
+func (m *SMTPMailer) connPool() *smtpPool {
+	m.poolOnce.Do(func() {
+		m.pool = newSMTPPool(m.dial, m.MaxMessagesPerConn, m.IdleTimeout, m.Timeout)
+	})
+	return m.pool
+}
+
+// dial opens a new authenticated session. Port 465 (or ImplicitTLS) uses
+// implicit TLS; otherwise the session starts in plain text and upgrades with
+// STARTTLS when offered. The whole handshake has to finish by deadline.
+func (m *SMTPMailer) dial(deadline time.Time) (net.Conn, *smtp.Client, error) {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	tlsconfig := &tls.Config{}
+	if m.TLSConfig != nil {
+		tlsconfig = m.TLSConfig.Clone()
+	}
+	if tlsconfig.ServerName == "" {
+		tlsconfig.ServerName = m.Host
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, m.Host)
+	implicitTLS := m.ImplicitTLS || m.Port == 465
+
+	dialer := &net.Dialer{Timeout: smtpDialTimeout, Deadline: deadline}
+	conn, err := dialer.Dial("tcp", addr)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	// We handle Close() via defer conn.Close(), forcing Quit might be redundant or fail if connection closed,
-	// but standard practice is to try Quit.
-	defer client.Quit()
+	// Deadlines set on the raw connection also cover TLS on top of it
+	conn.SetDeadline(deadline)
 
-	if err = client.Auth(auth); err != nil {
-		return err
-	}
-	if err = client.Mail(m.Sender); err != nil {
-		return err
+	var session net.Conn = conn
+	if implicitTLS {
+		session = tls.Client(conn, tlsconfig)
 	}
-	if err = client.Rcpt(to); err != nil {
-		return err
-	}
-	w, err := client.Data()
+	client, err := smtp.NewClient(session, m.Host)
 	if err != nil {
-		return err
+		conn.Close()
+		return nil, nil, err
 	}
-	_, err = w.Write(msg)
-	if err != nil {
-		return err
+
+	if !implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsconfig); err != nil {
+				client.Close()
+				return nil, nil, err
+			}
+		}
 	}
-	err = w.Close()
-	if err != nil {
-		return err
+
+	if m.Username != "" {
+		if ok, mechanisms := client.Extension("AUTH"); ok {
+			auth, err := m.smtpAuth(mechanisms)
+			if err != nil {
+				client.Close()
+				return nil, nil, err
+			}
+			if err := client.Auth(auth); err != nil {
+				client.Close()
+				return nil, nil, err
+			}
+		}
 	}
-	return nil
-}
\ No newline at end of file
+
+	return conn, client, nil
+}
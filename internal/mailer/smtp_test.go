@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/drumil/system-design-mailer/internal/mailer/smtptest"
+)
+
+func TestSMTPMailerTransports(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		server  func() (*smtptest.Server, error)
+		plain   bool
+		wantTLS bool
+	}{
+		{"plain", smtptest.NewServer, true, false},
+		{"starttls", smtptest.NewServer, false, true},
+		{"implicit tls", smtptest.NewTLSServer, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, err := tc.server()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Close()
+			srv.DisableSTARTTLS = tc.plain
+			srv.Username, srv.Password = "user", "secret"
+
+			m := newTestSMTPMailer(t, srv)
+			m.ImplicitTLS = tc.name == "implicit tls"
+			if err := m.Send([]string{"jane@example.org"}, "Hello", "<p>Hi</p>"); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			msgs := srv.Messages()
+			if len(msgs) != 1 {
+				t.Fatalf("got %d messages, want 1", len(msgs))
+			}
+			if msgs[0].TLS != tc.wantTLS {
+				t.Errorf("TLS = %v, want %v", msgs[0].TLS, tc.wantTLS)
+			}
+			if msgs[0].Username != "user" {
+				t.Errorf("authenticated as %q, want user", msgs[0].Username)
+			}
+			if usedSTARTTLS := count(srv.Commands(), "STARTTLS") > 0; usedSTARTTLS != (tc.name == "starttls") {
+				t.Errorf("STARTTLS used = %v in %s mode", usedSTARTTLS, tc.name)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerMessage(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+	m.BounceAddress = "bounces@example.com"
+
+	// A line starting with a dot must be stuffed on the wire and arrive intact
+	body := "<p>Hi</p>\n.hidden\n..two\n"
+	if err := m.Send([]string{"jane@example.org"}, "Caching 101", body); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg := srv.Messages()[0]
+	if msg.From != "bounces+jane=example.org@example.com" {
+		t.Errorf("envelope sender = %q", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "jane@example.org" {
+		t.Errorf("recipients = %v", msg.To)
+	}
+	data := string(msg.Data)
+	for _, want := range []string{
+		"From: System Design Daily <news@example.com>\r\n",
+		"To: jane@example.org\r\n",
+		"Subject: Caching 101\r\n",
+		"Content-Transfer-Encoding: quoted-printable\r\n",
+		"\r\n.hidden\r\n..two\r\n",
+		"unsubscribe?email=3Djane%40example.org",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("data is missing %q:\n%s", want, data)
+		}
+	}
+	if !bytes.Contains(msg.Raw, []byte("\r\n..hidden\r\n...two\r\n")) {
+		t.Errorf("dot-stuffing missing on the wire:\n%s", msg.Raw)
+	}
+	if bytes.Count(msg.Data, []byte("\n")) != bytes.Count(msg.Data, []byte("\r\n")) {
+		t.Error("data has bare LF line endings")
+	}
+}
+
+func TestSMTPPoolMultipleRecipients(t *testing.T) {
+	srv := startSMTPServer(t)
+	m := newTestSMTPMailer(t, srv)
+
+	msg := []byte("Subject: x\r\n\r\nbody\r\n")
+	if err := m.connPool().Send("news@example.com", []string{"a@example.org", "b@example.org", "c@example.org"}, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := srv.Messages()
+	if len(got) != 1 || strings.Join(got[0].To, ",") != "a@example.org,b@example.org,c@example.org" {
+		t.Fatalf("messages = %+v", got)
+	}
+	if count(srv.Commands(), "RCPT") != 3 {
+		t.Errorf("commands = %v", srv.Commands())
+	}
+	if string(got[0].Data) != string(msg) {
+		t.Errorf("data = %q, want %q", got[0].Data, msg)
+	}
+}
+
+func TestSMTPMailerAuthPlain(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.Username, srv.Password = "user", "secret"
+	srv.Mechanisms = []string{"PLAIN"}
+
+	m := newTestSMTPMailer(t, srv)
+	if err := m.Send([]string{"a@example.org"}, "x", "y"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := srv.Messages()[0].Username; got != "user" {
+		t.Errorf("authenticated as %q", got)
+	}
+
+	bad := newTestSMTPMailer(t, srv)
+	bad.Password = "wrong"
+	assertSMTPCode(t, bad.Send([]string{"a@example.org"}, "x", "y"), 535)
+}
+
+func TestSMTPMailerRejections(t *testing.T) {
+	for _, verb := range []string{"EHLO", "STARTTLS", "AUTH", "MAIL", "RCPT", "DATA", "."} {
+		for _, code := range []int{451, 554} {
+			t.Run(fmt.Sprintf("%s/%d", verb, code), func(t *testing.T) {
+				srv := startSMTPServer(t)
+				srv.Username, srv.Password = "user", "secret"
+				srv.FailCommand(verb, code, "no")
+				if verb == "EHLO" {
+					// net/smtp falls back to HELO when EHLO is refused
+					srv.FailCommand("HELO", code, "no")
+				}
+
+				m := newTestSMTPMailer(t, srv)
+				err := m.Send([]string{"a@example.org"}, "x", "y")
+				assertSMTPCode(t, err, code)
+				if len(srv.Messages()) != 0 {
+					t.Error("message accepted despite the rejection")
+				}
+			})
+		}
+	}
+}
+
+func TestSMTPMailerRejectedRecipientKeepsSession(t *testing.T) {
+	srv := startSMTPServer(t)
+	srv.FailRecipient("gone@example.org", 550, "No such user")
+	m := newTestSMTPMailer(t, srv)
+
+	err := m.Send([]string{"a@example.org", "gone@example.org", "b@example.org"}, "x", "y")
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || len(sendErr.Failed) != 1 || sendErr.Total != 3 {
+		t.Fatalf("err = %v, want one failed recipient of 3", err)
+	}
+	assertSMTPCode(t, sendErr.Failed["gone@example.org"], 550)
+	if got := len(srv.Messages()); got != 2 {
+		t.Errorf("delivered %d messages, want 2", got)
+	}
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+}
+
+func assertSMTPCode(t *testing.T, err error, code int) {
+	t.Helper()
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		t.Fatalf("err = %v, want an SMTP %d reply", err, code)
+	}
+	if tpErr.Code != code {
+		t.Errorf("SMTP code = %d, want %d", tpErr.Code, code)
+	}
+}
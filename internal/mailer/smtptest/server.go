@@ -0,0 +1,576 @@
+// Package smtptest provides an in-process SMTP server for exercising the
+// SMTP mailer without a real mail provider. It speaks enough of RFC 5321 for
+// net/smtp: EHLO, STARTTLS, AUTH PLAIN/LOGIN/XOAUTH2, MAIL, RCPT, DATA, RSET, NOOP
+// and QUIT, records every accepted message and can be told to reject
+// specific recipients or commands.
+package smtptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message accepted by the server.
+type Message struct {
+	From string
+	To   []string
+	// Data is the message as the client meant it, with dot-stuffing
+	// undone. Raw is what went over the wire between DATA and the final
+	// ".", still dot-stuffed. Both keep CRLF line endings.
+	Data     []byte
+	Raw      []byte
+	Username string // authenticated user, empty if the session did not AUTH
+	TLS      bool   // whether the session was encrypted
+}
+
+// Reply is an SMTP reply injected for a recipient.
+type Reply struct {
+	Code    int
+	Message string
+}
+
+// Server is a fake SMTP server listening on a random loopback port.
+type Server struct {
+	// Username and Password, when set, are required before MAIL is accepted.
+	Username string
+	Password string
+
+	// AccessToken, when set, is the bearer token XOAUTH2 accepts for
+	// Username.
+	AccessToken string
+
+	// Mechanisms overrides the advertised AUTH mechanisms
+	// (default PLAIN, LOGIN and XOAUTH2).
+	Mechanisms []string
+
+	// DisableSTARTTLS stops a plain-text server from offering STARTTLS.
+	DisableSTARTTLS bool
+
+	implicitTLS bool
+	tlsConfig   *tls.Config
+	certPool    *x509.CertPool
+	ln          net.Listener
+
+	mu          sync.Mutex
+	messages    []Message
+	commands    []string
+	failures    map[string]Reply
+	commandErrs map[string]Reply
+	hangs       map[string]bool
+	conns       map[net.Conn]bool
+	connections int
+	wg          sync.WaitGroup
+}
+
+// NewServer starts a plain-text server that offers STARTTLS.
+func NewServer() (*Server, error) {
+	return newServer(false)
+}
+
+// NewTLSServer starts a server that expects TLS from the first byte, like
+// submission on port 465.
+func NewTLSServer() (*Server, error) {
+	return newServer(true)
+}
+
+func newServer(implicitTLS bool) (*Server, error) {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	var ln net.Listener
+	if implicitTLS {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		implicitTLS: implicitTLS,
+		tlsConfig:   tlsConfig,
+		certPool:    pool,
+		ln:          ln,
+		failures:    make(map[string]Reply),
+		commandErrs: make(map[string]Reply),
+		hangs:       make(map[string]bool),
+		conns:       make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Host returns the listening host.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the listening port.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// ClientTLSConfig returns a client configuration that trusts the server's
+// self-signed certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.certPool, ServerName: s.Host()}
+}
+
+// FailRecipient makes RCPT TO for addr fail with the given reply. Use a 4xx
+// code for a temporary failure and 5xx for a permanent one.
+func (s *Server) FailRecipient(addr string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[strings.ToLower(addr)] = Reply{Code: code, Message: message}
+}
+
+// FailCommand makes every command with the given verb (e.g. "MAIL",
+// "DATA") fail with the given reply. The verb "." rejects messages after
+// their data has been received instead of the DATA command itself.
+func (s *Server) FailCommand(verb string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commandErrs[strings.ToUpper(verb)] = Reply{Code: code, Message: message}
+}
+
+// Hang makes the server stop answering once it receives verb (e.g. "MAIL"),
+// like a half-dead connection. The session stays open until the client or
+// Close ends it.
+func (s *Server) Hang(verb string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hangs[strings.ToUpper(verb)] = true
+}
+
+// Messages returns a copy of every message accepted so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Message, len(s.messages))
+	copy(out, s.messages)
+	return out
+}
+
+// Commands returns the verb of every command received so far, in order,
+// e.g. "EHLO", "MAIL", "RSET".
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.commands))
+	copy(out, s.commands)
+	return out
+}
+
+// Connections returns how many client connections have been accepted.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// DropConnections closes every open session without a reply, the way a
+// provider does when a connection has been idle too long.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close stops the listener and waits for open sessions to end.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.connections++
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+type session struct {
+	conn     net.Conn
+	tp       *textproto.Conn
+	tls      bool
+	username string
+	from     string
+	to       []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{conn: conn, tp: textproto.NewConn(conn), tls: s.implicitTLS}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sess.conn)
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	sess.reply(220, "smtptest ESMTP ready")
+	for {
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		hang := s.hangs[verb]
+		fail, failed := s.commandErrs[verb]
+		s.mu.Unlock()
+		if hang {
+			io.Copy(io.Discard, sess.conn)
+			return
+		}
+		if failed {
+			sess.reply(fail.Code, fail.Message)
+			continue
+		}
+		switch verb {
+		case "EHLO":
+			lines := []string{"smtptest greets " + arg}
+			if !sess.tls && !s.DisableSTARTTLS {
+				lines = append(lines, "STARTTLS")
+			}
+			mechanisms := s.Mechanisms
+			if len(mechanisms) == 0 {
+				mechanisms = []string{"PLAIN", "LOGIN", "XOAUTH2"}
+			}
+			lines = append(lines, "AUTH "+strings.Join(mechanisms, " "), "8BITMIME")
+			sess.replyMulti(250, lines)
+		case "HELO":
+			sess.reply(250, "smtptest")
+		case "STARTTLS":
+			if sess.tls || s.DisableSTARTTLS {
+				sess.reply(503, "TLS not available")
+				continue
+			}
+			sess.reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(sess.conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			delete(s.conns, sess.conn)
+			s.conns[tlsConn] = true
+			s.mu.Unlock()
+			sess.conn = tlsConn
+			sess.tp = textproto.NewConn(tlsConn)
+			sess.tls = true
+			sess.reset()
+		case "AUTH":
+			s.auth(sess, arg)
+		case "MAIL":
+			if s.Username != "" && sess.username == "" {
+				sess.reply(530, "Authentication required")
+				continue
+			}
+			sess.reset()
+			sess.from = extractAddress(arg)
+			sess.reply(250, "OK")
+		case "RCPT":
+			if sess.from == "" {
+				sess.reply(503, "Need MAIL first")
+				continue
+			}
+			rcpt := extractAddress(arg)
+			s.mu.Lock()
+			fail, ok := s.failures[strings.ToLower(rcpt)]
+			s.mu.Unlock()
+			if ok {
+				sess.reply(fail.Code, fail.Message)
+				continue
+			}
+			sess.to = append(sess.to, rcpt)
+			sess.reply(250, "OK")
+		case "DATA":
+			if len(sess.to) == 0 {
+				sess.reply(503, "Need RCPT first")
+				continue
+			}
+			sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+			raw, data, err := sess.readData()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			fail, failed := s.commandErrs["."]
+			if !failed {
+				s.messages = append(s.messages, Message{
+					From:     sess.from,
+					To:       sess.to,
+					Data:     data,
+					Raw:      raw,
+					Username: sess.username,
+					TLS:      sess.tls,
+				})
+			}
+			s.mu.Unlock()
+			sess.reset()
+			if failed {
+				sess.reply(fail.Code, fail.Message)
+				continue
+			}
+			sess.reply(250, "OK: queued")
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "QUIT":
+			sess.reply(221, "Bye")
+			return
+		default:
+			sess.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *Server) auth(sess *session, arg string) {
+	mech, initial, _ := strings.Cut(arg, " ")
+	var user, pass string
+
+	if len(s.Mechanisms) > 0 && !containsFold(s.Mechanisms, mech) {
+		sess.reply(504, "Unrecognized authentication type")
+		return
+	}
+
+	switch strings.ToUpper(mech) {
+	case "PLAIN":
+		if initial == "" {
+			sess.reply(334, "")
+			var err error
+			if initial, err = sess.tp.ReadLine(); err != nil {
+				return
+			}
+		}
+		raw, err := base64.StdEncoding.DecodeString(initial)
+		if err != nil {
+			sess.reply(501, "Malformed AUTH input")
+			return
+		}
+		parts := strings.Split(string(raw), "\x00")
+		if len(parts) != 3 {
+			sess.reply(501, "Malformed AUTH input")
+			return
+		}
+		user, pass = parts[1], parts[2]
+	case "LOGIN":
+		var ok bool
+		if user, ok = sess.challenge("Username:", initial); !ok {
+			return
+		}
+		if pass, ok = sess.challenge("Password:", ""); !ok {
+			return
+		}
+	case "XOAUTH2":
+		s.xoauth2(sess, initial)
+		return
+	default:
+		sess.reply(504, "Unrecognized authentication type")
+		return
+	}
+
+	if s.Username != "" && (user != s.Username || pass != s.Password) {
+		sess.reply(535, "Authentication credentials invalid")
+		return
+	}
+	sess.username = user
+	sess.reply(235, "Authentication successful")
+}
+
+// xoauth2 checks "user=...\x01auth=Bearer ...\x01\x01". A rejected token
+// gets a JSON error challenge first, as Gmail does, which the client must
+// answer with an empty line.
+func (s *Server) xoauth2(sess *session, initial string) {
+	if initial == "" {
+		sess.reply(334, "")
+		var err error
+		if initial, err = sess.tp.ReadLine(); err != nil {
+			return
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		sess.reply(501, "Malformed AUTH input")
+		return
+	}
+	var user, token string
+	for _, field := range strings.Split(string(raw), "\x01") {
+		if v, ok := strings.CutPrefix(field, "user="); ok {
+			user = v
+		}
+		if v, ok := strings.CutPrefix(field, "auth=Bearer "); ok {
+			token = v
+		}
+	}
+
+	if s.AccessToken == "" || user != s.Username || token != s.AccessToken {
+		sess.reply(334, base64.StdEncoding.EncodeToString([]byte(`{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`)))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		if line != "" {
+			sess.reply(501, "Expected an empty response to the error challenge")
+			return
+		}
+		sess.reply(535, "Username and token not accepted")
+		return
+	}
+	sess.username = user
+	sess.reply(235, "Authentication successful")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// challenge runs one step of AUTH LOGIN. If the client already sent the
+// answer as an initial response, no prompt is issued.
+func (sess *session) challenge(prompt, initial string) (string, bool) {
+	if initial == "" {
+		sess.reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		initial = line
+	}
+	raw, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		sess.reply(501, "Malformed AUTH input")
+		return "", false
+	}
+	return string(raw), true
+}
+
+// readData reads message lines up to the terminating ".", returning them as
+// sent and with the leading dot of stuffed lines removed.
+func (sess *session) readData() (raw, data []byte, err error) {
+	for {
+		line, err := sess.tp.R.ReadString('\n')
+		if err != nil {
+			return nil, nil, err
+		}
+		if line == ".\r\n" {
+			return raw, data, nil
+		}
+		raw = append(raw, line...)
+		data = append(data, strings.TrimPrefix(line, ".")...)
+	}
+}
+
+func (sess *session) reset() {
+	sess.from = ""
+	sess.to = nil
+}
+
+func (sess *session) reply(code int, msg string) {
+	sess.tp.PrintfLine("%d %s", code, msg)
+}
+
+func (sess *session) replyMulti(code int, lines []string) {
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		sess.tp.PrintfLine("%d%s%s", code, sep, l)
+	}
+}
+
+// extractAddress pulls the address out of "FROM:<a@b>" / "TO:<a@b> SIZE=..".
+func extractAddress(arg string) string {
+	if i := strings.IndexByte(arg, '<'); i >= 0 {
+		if j := strings.IndexByte(arg[i:], '>'); j >= 0 {
+			return arg[i+1 : i+j]
+		}
+	}
+	_, addr, _ := strings.Cut(arg, ":")
+	return strings.TrimSpace(addr)
+}
+
+// selfSignedCert creates a throwaway certificate for 127.0.0.1/localhost and
+// a pool that trusts it.
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	return cert, pool, nil
+}
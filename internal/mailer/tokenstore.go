@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by a TokenStore that has no token saved yet.
+var ErrNoToken = errors.New("no OAuth token stored")
+
+// TokenStore persists an OAuth token so refreshes and new consents survive
+// restarts.
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(tok *oauth2.Token) error
+}
+
+// FileTokenStore keeps the token as JSON in a local file.
+type FileTokenStore struct {
+	mu   sync.Mutex
+	Path string
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (s *FileTokenStore) Load() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(data, tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+func (s *FileTokenStore) Save(tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so a crash never leaves a truncated token
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// EnvTokenStore reads the token from an environment variable (e.g.
+// GMAIL_TOKEN_JSON on Render). Environment variables can't be written back,
+// so saved tokens are only kept in memory until the next restart.
+type EnvTokenStore struct {
+	mu    sync.Mutex
+	Var   string
+	saved *oauth2.Token
+}
+
+func NewEnvTokenStore(name string) *EnvTokenStore {
+	return &EnvTokenStore{Var: name}
+}
+
+func (s *EnvTokenStore) Load() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saved != nil {
+		return s.saved, nil
+	}
+	value := os.Getenv(s.Var)
+	if value == "" {
+		return nil, ErrNoToken
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal([]byte(value), tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+func (s *EnvTokenStore) Save(tok *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saved = tok
+	return nil
+}
+
+// MongoTokenStore keeps tokens in the oauth_tokens collection, one document
+// per Name.
+type MongoTokenStore struct {
+	collection *mongo.Collection
+	Name       string
+}
+
+func NewMongoTokenStore(db *mongo.Database, name string) *MongoTokenStore {
+	return &MongoTokenStore{collection: db.Collection("oauth_tokens"), Name: name}
+}
+
+type tokenDocument struct {
+	Name      string    `bson:"_id"`
+	Token     string    `bson:"token"` // JSON, so every oauth2.Token field round-trips
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (s *MongoTokenStore) Load() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc tokenDocument
+	err := s.collection.FindOne(ctx, bson.M{"_id": s.Name}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal([]byte(doc.Token), tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+func (s *MongoTokenStore) Save(tok *oauth2.Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	doc := tokenDocument{Name: s.Name, Token: string(data), UpdatedAt: time.Now()}
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": s.Name}, doc, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,699 @@
+package newsletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// Broadcast states.
+const (
+	BroadcastIdle      = "idle"
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCancelled = "cancelled"
+	BroadcastDone      = "done"
+)
+
+// ErrBroadcastCancelled stops a send that an admin cancelled.
+var ErrBroadcastCancelled = errors.New("broadcast cancelled")
+
+// errBroadcastPaused stops a send that mustn't wait out a pause.
+var errBroadcastPaused = errors.New("broadcast paused")
+
+// BroadcastProgress is the persisted record of a broadcast. Delivered lists
+// every recipient already sent to and Queued every one handed to the
+// deferred queue, for a later delivery window or quota, so a resumed
+// broadcast skips both.
+type BroadcastProgress struct {
+	Issue     Issue     `bson:"issue" json:"issue"`
+	State     string    `bson:"state" json:"state"`
+	Total     int       `bson:"total" json:"total"`
+	Delivered []string  `bson:"delivered" json:"delivered"`
+	Queued    []string  `bson:"queued,omitempty" json:"queued,omitempty"`
+	StartedAt time.Time `bson:"started_at" json:"started_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Unfinished reports whether the broadcast stopped before reaching everyone,
+// either paused or interrupted by a restart.
+func (p BroadcastProgress) Unfinished() bool {
+	return p.State == BroadcastRunning || p.State == BroadcastPaused
+}
+
+// ProgressStore persists broadcast progress across restarts.
+type ProgressStore interface {
+	// Start marks the issue's broadcast running, keeping the recipients
+	// delivered by an earlier attempt, and returns the record.
+	Start(issue Issue, total int) (*BroadcastProgress, error)
+	MarkDelivered(issueID, email string) error
+	MarkQueued(issueID string, emails []string) error
+	SetState(issueID, state string) error
+	// Latest returns the most recently started broadcast, or nil.
+	Latest() (*BroadcastProgress, error)
+}
+
+// BroadcastStatus is a snapshot of the current or last broadcast.
+type BroadcastStatus struct {
+	IssueID   string    `json:"issue_id,omitempty"`
+	State     string    `json:"state"`
+	Total     int       `json:"total"`
+	Delivered int       `json:"delivered"`
+	Queued    int       `json:"queued"`
+	Remaining int       `json:"remaining"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// BroadcastControl lets an admin pause, resume or cancel the broadcast in
+// progress. The Sender checks it before every recipient.
+type BroadcastControl struct {
+	Store ProgressStore
+
+	mu        sync.Mutex
+	issueID   string
+	state     string
+	total     int
+	delivered map[string]bool
+	queued    map[string]bool
+	startedAt time.Time
+	updatedAt time.Time
+	changed   chan struct{} // closed and replaced on every state change
+	stopped   chan struct{} // closed once the send loop honours a pause
+}
+
+func NewBroadcastControl(store ProgressStore) *BroadcastControl {
+	return &BroadcastControl{
+		Store:   store,
+		state:   BroadcastIdle,
+		changed: make(chan struct{}),
+	}
+}
+
+// Begin starts tracking issue's broadcast to total recipients. Recipients
+// delivered or queued by an earlier attempt of the same issue are skipped.
+func (c *BroadcastControl) Begin(issue Issue, total int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == BroadcastRunning || c.state == BroadcastPaused {
+		return fmt.Errorf("broadcast of issue %s is already %s", c.issueID, c.state)
+	}
+
+	c.issueID, c.total = issue.ID, total
+	c.delivered = make(map[string]bool)
+	c.queued = make(map[string]bool)
+	c.startedAt, c.updatedAt = time.Now(), time.Now()
+	if c.Store != nil {
+		p, err := c.Store.Start(issue, total)
+		if err != nil {
+			return fmt.Errorf("unable to record broadcast progress: %v", err)
+		}
+		for _, email := range p.Delivered {
+			c.delivered[email] = true
+		}
+		for _, email := range p.Queued {
+			c.queued[email] = true
+		}
+		c.startedAt = p.StartedAt
+		if len(p.Delivered) > 0 || len(p.Queued) > 0 {
+			log.Printf("Broadcast: resuming issue %s, %d recipients already delivered, %d queued", issue.ID, len(p.Delivered), len(p.Queued))
+		}
+	}
+	c.setState(BroadcastRunning)
+	return nil
+}
+
+// End records that the broadcast finished, or was cancelled if err is
+// ErrBroadcastCancelled.
+func (c *BroadcastControl) End(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != BroadcastRunning && c.state != BroadcastPaused {
+		return
+	}
+	if errors.Is(err, ErrBroadcastCancelled) {
+		c.setState(BroadcastCancelled)
+	} else {
+		c.setState(BroadcastDone)
+	}
+	c.ackStop()
+}
+
+// Pause stops the broadcast before the next recipient. The message being
+// sent, if any, still goes out; PauseAndWait waits for it.
+func (c *BroadcastControl) Pause() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != BroadcastRunning {
+		return fmt.Errorf("no running broadcast to pause (state %s)", c.state)
+	}
+	c.stopped = make(chan struct{})
+	c.setState(BroadcastPaused)
+	return nil
+}
+
+// PauseAndWait pauses the broadcast, or takes an existing pause, and waits
+// until the send loop has stopped, so no message is in flight and every
+// delivery so far is recorded. It returns ctx's error if the loop doesn't
+// stop in time.
+func (c *BroadcastControl) PauseAndWait(ctx context.Context) error {
+	c.mu.Lock()
+	switch c.state {
+	case BroadcastRunning:
+		c.stopped = make(chan struct{})
+		c.setState(BroadcastPaused)
+	case BroadcastPaused:
+	default:
+		c.mu.Unlock()
+		return fmt.Errorf("no running broadcast to pause (state %s)", c.state)
+	}
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped == nil {
+		// Already acknowledged
+		return nil
+	}
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ackStop tells PauseAndWait the send loop is no longer sending. It must be
+// called with c.mu held.
+func (c *BroadcastControl) ackStop() {
+	if c.stopped != nil {
+		close(c.stopped)
+		c.stopped = nil
+	}
+}
+
+func (c *BroadcastControl) Resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != BroadcastPaused {
+		return fmt.Errorf("no paused broadcast to resume (state %s)", c.state)
+	}
+	c.setState(BroadcastRunning)
+	return nil
+}
+
+// Cancel stops the broadcast before the next recipient.
+func (c *BroadcastControl) Cancel() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != BroadcastRunning && c.state != BroadcastPaused {
+		return fmt.Errorf("no broadcast to cancel (state %s)", c.state)
+	}
+	c.setState(BroadcastCancelled)
+	return nil
+}
+
+// Active reports whether a broadcast is running or paused in this process.
+func (c *BroadcastControl) Active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == BroadcastRunning || c.state == BroadcastPaused
+}
+
+// Status reports the broadcast in this process, or the latest persisted one
+// after a restart.
+func (c *BroadcastControl) Status() BroadcastStatus {
+	c.mu.Lock()
+	if c.issueID != "" || c.Store == nil {
+		defer c.mu.Unlock()
+		return BroadcastStatus{
+			IssueID:   c.issueID,
+			State:     c.state,
+			Total:     c.total,
+			Delivered: len(c.delivered),
+			Queued:    len(c.queued),
+			Remaining: max(c.total-len(c.delivered)-len(c.queued), 0),
+			StartedAt: c.startedAt,
+			UpdatedAt: c.updatedAt,
+		}
+	}
+	c.mu.Unlock()
+
+	p, err := c.Store.Latest()
+	if err != nil {
+		log.Printf("Broadcast: unable to load progress: %v", err)
+	}
+	if p == nil {
+		return BroadcastStatus{State: BroadcastIdle}
+	}
+	return BroadcastStatus{
+		IssueID:   p.Issue.ID,
+		State:     p.State,
+		Total:     p.Total,
+		Delivered: len(p.Delivered),
+		Queued:    len(p.Queued),
+		Remaining: max(p.Total-len(p.Delivered)-len(p.Queued), 0),
+		StartedAt: p.StartedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// Unfinished returns the latest persisted broadcast if it was paused or
+// interrupted and isn't running in this process.
+func (c *BroadcastControl) Unfinished() (*BroadcastProgress, error) {
+	if c.Store == nil || c.Active() {
+		return nil, nil
+	}
+	p, err := c.Store.Latest()
+	if err != nil || p == nil || !p.Unfinished() {
+		return nil, err
+	}
+	return p, nil
+}
+
+// wait blocks while the broadcast of issueID is paused, or with block unset
+// returns errBroadcastPaused, and returns ErrBroadcastCancelled once it is
+// cancelled. Sends of other issues are not affected.
+func (c *BroadcastControl) wait(issueID string, block bool) error {
+	if c == nil {
+		return nil
+	}
+	for {
+		c.mu.Lock()
+		state, changed, current := c.state, c.changed, c.issueID == issueID
+		c.mu.Unlock()
+
+		if !current {
+			return nil
+		}
+		switch state {
+		case BroadcastCancelled:
+			return ErrBroadcastCancelled
+		case BroadcastPaused:
+			if !block {
+				return errBroadcastPaused
+			}
+			c.mu.Lock()
+			if c.changed == changed {
+				c.ackStop()
+			}
+			c.mu.Unlock()
+			<-changed
+		default:
+			return nil
+		}
+	}
+}
+
+// halted returns BroadcastPaused or BroadcastCancelled if the broadcast of
+// issueID is stopped, or "" if it isn't. Until a broadcast begins in this
+// process it goes by the persisted record, so a cancel outlives a restart.
+func (c *BroadcastControl) halted(issueID string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	current, state := c.issueID, c.state
+	c.mu.Unlock()
+	if current == "" && c.Store != nil {
+		p, err := c.Store.Latest()
+		if err != nil {
+			log.Printf("Broadcast: unable to load progress: %v", err)
+		} else if p != nil {
+			current, state = p.Issue.ID, p.State
+		}
+	}
+	if current == issueID && (state == BroadcastPaused || state == BroadcastCancelled) {
+		return state
+	}
+	return ""
+}
+
+// sent reports whether email already received the issue being broadcast.
+func (c *BroadcastControl) sent(issueID, email string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.issueID == issueID && c.delivered[email]
+}
+
+// Pending returns the subscribers the broadcast of issueID has neither
+// delivered to nor queued.
+func (c *BroadcastControl) Pending(issueID string, subscribers []store.Subscriber) []store.Subscriber {
+	if c == nil {
+		return subscribers
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.issueID != issueID {
+		return subscribers
+	}
+	pending := subscribers[:0:0]
+	for _, sub := range subscribers {
+		if !c.delivered[sub.Email] && !c.queued[sub.Email] {
+			pending = append(pending, sub)
+		}
+	}
+	return pending
+}
+
+// Queue records that emails were handed to the deferred queue, so resuming
+// the broadcast doesn't send or queue them again.
+func (c *BroadcastControl) Queue(issueID string, emails []string) {
+	if c == nil || len(emails) == 0 {
+		return
+	}
+	c.mu.Lock()
+	if c.issueID != issueID || (c.state != BroadcastRunning && c.state != BroadcastPaused) {
+		c.mu.Unlock()
+		return
+	}
+	for _, email := range emails {
+		c.queued[email] = true
+	}
+	c.updatedAt = time.Now()
+	c.mu.Unlock()
+
+	if c.Store != nil {
+		if err := c.Store.MarkQueued(issueID, emails); err != nil {
+			log.Printf("Broadcast: unable to record %d queued recipients: %v", len(emails), err)
+		}
+	}
+}
+
+func (c *BroadcastControl) record(issueID, email string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.issueID != issueID || (c.state != BroadcastRunning && c.state != BroadcastPaused) {
+		c.mu.Unlock()
+		return
+	}
+	c.delivered[email] = true
+	c.updatedAt = time.Now()
+	c.mu.Unlock()
+
+	if c.Store != nil {
+		if err := c.Store.MarkDelivered(issueID, email); err != nil {
+			log.Printf("Broadcast: unable to record delivery to %s: %v", email, err)
+		}
+	}
+}
+
+// setState must be called with c.mu held.
+func (c *BroadcastControl) setState(state string) {
+	log.Printf("Broadcast: issue %s %s -> %s (%d/%d delivered)", c.issueID, c.state, state, len(c.delivered), c.total)
+	c.state = state
+	c.updatedAt = time.Now()
+	close(c.changed)
+	c.changed = make(chan struct{})
+	if c.Store != nil {
+		if err := c.Store.SetState(c.issueID, state); err != nil {
+			log.Printf("Broadcast: unable to persist state %s: %v", state, err)
+		}
+	}
+}
+
+// maxBroadcastHistory is how many broadcasts FileProgressStore keeps.
+const maxBroadcastHistory = 30
+
+// FileProgressStore keeps recent broadcasts in a JSON file. Deliveries are
+// appended to a log next to it, filePath + ".delivered", so recording one
+// doesn't rewrite the whole file; the log is folded into the file whenever
+// a broadcast starts or changes state.
+type FileProgressStore struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewFileProgressStore(filePath string) *FileProgressStore {
+	return &FileProgressStore{filePath: filePath}
+}
+
+// deliveryRecord is one line of the delivery log.
+type deliveryRecord struct {
+	IssueID string `json:"issue_id"`
+	Email   string `json:"email"`
+	Queued  bool   `json:"queued,omitempty"`
+}
+
+func (s *FileProgressStore) logPath() string {
+	return s.filePath + ".delivered"
+}
+
+func (s *FileProgressStore) Start(issue Issue, total int) (*BroadcastProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range all {
+		if all[i].Issue.ID == issue.ID {
+			all[i].State, all[i].Total, all[i].UpdatedAt = BroadcastRunning, total, now
+			p := all[i]
+			return &p, s.save(all)
+		}
+	}
+	p := BroadcastProgress{Issue: issue, State: BroadcastRunning, Total: total, StartedAt: now, UpdatedAt: now}
+	all = append(all, p)
+	return &p, s.save(all)
+}
+
+func (s *FileProgressStore) MarkDelivered(issueID, email string) error {
+	return s.appendLog(deliveryRecord{IssueID: issueID, Email: email})
+}
+
+func (s *FileProgressStore) MarkQueued(issueID string, emails []string) error {
+	records := make([]deliveryRecord, len(emails))
+	for i, email := range emails {
+		records[i] = deliveryRecord{IssueID: issueID, Email: email, Queued: true}
+	}
+	return s.appendLog(records...)
+}
+
+func (s *FileProgressStore) appendLog(records ...deliveryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.logPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func (s *FileProgressStore) SetState(issueID, state string) error {
+	return s.update(issueID, func(p *BroadcastProgress) { p.State = state })
+}
+
+func (s *FileProgressStore) Latest() (*BroadcastProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil || len(all) == 0 {
+		return nil, err
+	}
+	return &all[len(all)-1], nil
+}
+
+func (s *FileProgressStore) update(issueID string, apply func(*BroadcastProgress)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range all {
+		if all[i].Issue.ID == issueID {
+			apply(&all[i])
+			all[i].UpdatedAt = time.Now()
+			return s.save(all)
+		}
+	}
+	return fmt.Errorf("no broadcast recorded for issue %s", issueID)
+}
+
+// load returns the broadcasts ordered by start time, including the
+// deliveries logged since the file was last saved.
+func (s *FileProgressStore) load() ([]BroadcastProgress, error) {
+	var all []BroadcastProgress
+	data, err := os.ReadFile(s.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+	}
+
+	delivered, queued, err := s.loadLog()
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if emails := delivered[all[i].Issue.ID]; len(emails) > 0 {
+			all[i].Delivered = mergeEmails(all[i].Delivered, emails)
+		}
+		if emails := queued[all[i].Issue.ID]; len(emails) > 0 {
+			all[i].Queued = mergeEmails(all[i].Queued, emails)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].StartedAt.Before(all[j].StartedAt) })
+	return all, nil
+}
+
+// loadLog reads the delivery log, delivered and queued recipients grouped
+// by issue. A torn last line from a crash mid-write is ignored.
+func (s *FileProgressStore) loadLog() (delivered, queued map[string][]string, err error) {
+	f, err := os.Open(s.logPath())
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	delivered, queued = make(map[string][]string), make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r deliveryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Queued {
+			queued[r.IssueID] = append(queued[r.IssueID], r.Email)
+		} else {
+			delivered[r.IssueID] = append(delivered[r.IssueID], r.Email)
+		}
+	}
+	return delivered, queued, scanner.Err()
+}
+
+// save writes all, which must come from load, and then drops the delivery
+// log it already contains.
+func (s *FileProgressStore) save(all []BroadcastProgress) error {
+	if len(all) > maxBroadcastHistory {
+		all = all[len(all)-maxBroadcastHistory:]
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.filePath); err != nil {
+		return err
+	}
+	if err := os.Remove(s.logPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MongoProgressStore keeps one document per issue in the broadcasts
+// collection.
+type MongoProgressStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoProgressStore(db *mongo.Database) *MongoProgressStore {
+	return &MongoProgressStore{collection: db.Collection("broadcasts")}
+}
+
+func (s *MongoProgressStore) Start(issue Issue, total int) (*BroadcastProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var p BroadcastProgress
+	err := s.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": issue.ID},
+		bson.M{
+			"$set":         bson.M{"issue": issue, "state": BroadcastRunning, "total": total, "updated_at": now},
+			"$setOnInsert": bson.M{"started_at": now, "delivered": []string{}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *MongoProgressStore) MarkDelivered(issueID, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": issueID}, bson.M{
+		"$addToSet": bson.M{"delivered": email},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
+	return err
+}
+
+func (s *MongoProgressStore) MarkQueued(issueID string, emails []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": issueID}, bson.M{
+		"$addToSet": bson.M{"queued": bson.M{"$each": emails}},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
+	return err
+}
+
+func (s *MongoProgressStore) SetState(issueID, state string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": issueID}, bson.M{
+		"$set": bson.M{"state": state, "updated_at": time.Now()},
+	})
+	return err
+}
+
+func (s *MongoProgressStore) Latest() (*BroadcastProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var p BroadcastProgress
+	err := s.collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"started_at": -1})).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
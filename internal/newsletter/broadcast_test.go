@@ -0,0 +1,226 @@
+package newsletter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+func TestFileProgressStoreAppendsDeliveries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broadcasts.json")
+	s := NewFileProgressStore(path)
+	issue := Issue{ID: "2026-10-18", Subject: "Caching"}
+	if _, err := s.Start(issue, 3); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"a@example.org", "b@example.org", "a@example.org"} {
+		if err := s.MarkDelivered(issue.ID, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("recording a delivery rewrote the progress file")
+	}
+
+	p, err := s.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Delivered) != "[a@example.org b@example.org]" {
+		t.Errorf("delivered = %v", p.Delivered)
+	}
+
+	// A state change folds the log into the file
+	if err := s.SetState(issue.ID, BroadcastPaused); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".delivered"); !os.IsNotExist(err) {
+		t.Errorf("delivery log still present: %v", err)
+	}
+	p, err = s.Start(issue, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Delivered) != 2 {
+		t.Errorf("restart sees %v delivered", p.Delivered)
+	}
+}
+
+// blockingMailer holds every send until release is closed.
+type blockingMailer struct {
+	sending chan string
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(to []string, subject, bodyHTML string) error {
+	m.sending <- to[0]
+	<-m.release
+	return nil
+}
+
+func TestPauseAndWaitWaitsForMessageInFlight(t *testing.T) {
+	control := NewBroadcastControl(NewFileProgressStore(filepath.Join(t.TempDir(), "broadcasts.json")))
+	m := &blockingMailer{sending: make(chan string, 1), release: make(chan struct{})}
+	s := &Sender{Mailer: m, Control: control}
+	issue := Issue{ID: "2026-10-18", Subject: "Caching", HTML: "<p>Hi</p>"}
+	subs := []store.Subscriber{{Email: "a@example.org"}, {Email: "b@example.org"}}
+	if err := control.Begin(issue, len(subs)); err != nil {
+		t.Fatal(err)
+	}
+	go s.Send(issue, subs)
+	<-m.sending
+
+	paused := make(chan error, 1)
+	go func() { paused <- control.PauseAndWait(context.Background()) }()
+	select {
+	case err := <-paused:
+		t.Fatalf("PauseAndWait returned %v with a message in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(m.release)
+	if err := <-paused; err != nil {
+		t.Fatalf("PauseAndWait: %v", err)
+	}
+	if st := control.Status(); st.State != BroadcastPaused || st.Delivered != 1 {
+		t.Errorf("status = %+v, want paused after 1 delivery", st)
+	}
+	select {
+	case email := <-m.sending:
+		t.Errorf("sent to %s while paused", email)
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := control.PauseAndWait(ctx); err != nil {
+		t.Errorf("PauseAndWait on a stopped broadcast: %v", err)
+	}
+	control.Cancel()
+}
+
+// countingMailer counts the messages each recipient gets and calls
+// afterSend after each one.
+type countingMailer struct {
+	mu        sync.Mutex
+	got       map[string]int
+	afterSend func()
+}
+
+func (m *countingMailer) Send(to []string, subject, bodyHTML string) error {
+	m.mu.Lock()
+	m.got[to[0]]++
+	m.mu.Unlock()
+	if m.afterSend != nil {
+		m.afterSend()
+	}
+	return nil
+}
+
+func TestResumedBroadcastSendsEveryoneOnce(t *testing.T) {
+	dir := t.TempDir()
+	subs, err := store.NewFileStore(filepath.Join(dir, "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nine := 9
+	for _, email := range []string{"a@example.org", "b@example.org", "c@example.org", "d@example.org"} {
+		if err := subs.Add(email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, email := range []string{"c@example.org", "d@example.org"} {
+		sub, _ := subs.Get(email)
+		sub.TimeZone, sub.DeliveryHour = "UTC", &nine
+		if err := subs.Update(*sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	everyone, err := subs.ListActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := Issue{ID: "2026-10-18", Subject: "Caching", HTML: "<p>Hi</p>"}
+	progressPath := filepath.Join(dir, "broadcasts.json")
+	deferred := NewFileDeferredStore(filepath.Join(dir, "deferred.json"))
+	m := &countingMailer{got: make(map[string]int)}
+	now := time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+
+	// The first attempt queues c and d for 09:00 and is paused after one
+	// of the two due now
+	control := NewBroadcastControl(NewFileProgressStore(progressPath))
+	s := &Sender{Mailer: m, Deferred: deferred, Control: control}
+	if err := control.Begin(issue, len(everyone)); err != nil {
+		t.Fatal(err)
+	}
+	due := s.Schedule(issue, control.Pending(issue.ID, everyone), now, 8)
+	if len(due) != 2 {
+		t.Fatalf("due now = %v, want a and b", due)
+	}
+	paused := make(chan struct{})
+	m.afterSend = func() {
+		control.Pause()
+		close(paused)
+	}
+	go s.Send(issue, due)
+	<-paused
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := control.PauseAndWait(ctx); err != nil {
+		t.Fatalf("PauseAndWait: %v", err)
+	}
+	m.afterSend = nil
+	defer control.Cancel()
+
+	// After a restart the 09:00 batch waits for the paused broadcast,
+	// which is resumed at 10:00
+	resumed := NewBroadcastControl(NewFileProgressStore(progressPath))
+	s = &Sender{Mailer: m, Deferred: deferred, Control: resumed}
+	if err := s.SendDeferred(subs, now.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.got["c@example.org"]; n != 0 {
+		t.Errorf("deferred batch sent while the broadcast was paused")
+	}
+	p, err := resumed.Unfinished()
+	if err != nil || p == nil {
+		t.Fatalf("Unfinished = %v, %v, want the paused broadcast", p, err)
+	}
+	if err := resumed.Begin(p.Issue, len(everyone)); err != nil {
+		t.Fatal(err)
+	}
+	due = s.Schedule(p.Issue, resumed.Pending(issue.ID, everyone), now.Add(4*time.Hour), 8)
+	result := s.Send(p.Issue, due)
+	resumed.End(nil)
+	if result.Sent != 1 {
+		t.Errorf("resume sent %d, want the one left of a and b", result.Sent)
+	}
+	if st := resumed.Status(); st.Delivered != 2 || st.Queued != 2 || st.Remaining != 0 {
+		t.Errorf("status = %+v, want 2 delivered and 2 queued", st)
+	}
+	if err := s.SendDeferred(subs, now.Add(4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is left for the next day
+	if err := s.SendDeferred(subs, now.Add(27*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range everyone {
+		if n := m.got[sub.Email]; n != 1 {
+			t.Errorf("%s got the issue %d times, want once", sub.Email, n)
+		}
+	}
+}
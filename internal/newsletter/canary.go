@@ -0,0 +1,170 @@
+package newsletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Canary states.
+const (
+	CanaryIdle     = "idle"
+	CanaryWaiting  = "waiting"  // seed list sent, broadcast starts at the deadline
+	CanaryHeld     = "held"     // waiting for release or abort, aborted at the deadline
+	CanaryReleased = "released" // broadcast proceeding
+	CanaryAborted  = "aborted"  // broadcast cancelled
+)
+
+// defaultCanaryMaxHold applies when Canary.MaxHold is not set.
+const defaultCanaryMaxHold = 4 * time.Hour
+
+// ErrBroadcastAborted is returned by Wait when an admin aborts the issue.
+var ErrBroadcastAborted = errors.New("broadcast aborted")
+
+// CanaryStatus is a snapshot of the canary gate.
+type CanaryStatus struct {
+	State    string    `json:"state"`
+	IssueID  string    `json:"issue_id,omitempty"`
+	Deadline time.Time `json:"deadline,omitzero"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Canary holds a broadcast after the seed list has received it. Unless an
+// admin holds or aborts it within Window, the broadcast proceeds on its own.
+// A hold that nobody releases within MaxHold aborts the issue, so a
+// forgotten hold can't block the daily job forever.
+type Canary struct {
+	Window  time.Duration
+	MaxHold time.Duration
+
+	mu      sync.Mutex
+	status  CanaryStatus
+	changed chan struct{} // closed and replaced on every state change
+}
+
+func NewCanary(window, maxHold time.Duration) *Canary {
+	return &Canary{
+		Window:  window,
+		MaxHold: maxHold,
+		status:  CanaryStatus{State: CanaryIdle},
+		changed: make(chan struct{}),
+	}
+}
+
+// Begin starts the window for issueID, after the seed list has been sent.
+func (c *Canary) Begin(issueID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(CanaryStatus{State: CanaryWaiting, IssueID: issueID, Deadline: time.Now().Add(c.Window)}, "seed list sent")
+}
+
+// Hold stops the countdown until Release, Abort or MaxHold has passed.
+func (c *Canary) Hold(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status.State != CanaryWaiting {
+		return fmt.Errorf("cannot hold a broadcast that is %s", c.status.State)
+	}
+	maxHold := c.MaxHold
+	if maxHold <= 0 {
+		maxHold = defaultCanaryMaxHold
+	}
+	st := c.status
+	st.State, st.Deadline, st.Reason = CanaryHeld, time.Now().Add(maxHold), reason
+	c.set(st, reason)
+	return nil
+}
+
+// Release lets a waiting or held broadcast proceed immediately.
+func (c *Canary) Release(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status.State != CanaryWaiting && c.status.State != CanaryHeld {
+		return fmt.Errorf("cannot release a broadcast that is %s", c.status.State)
+	}
+	st := c.status
+	st.State, st.Deadline, st.Reason = CanaryReleased, time.Time{}, reason
+	c.set(st, reason)
+	return nil
+}
+
+// Abort cancels a waiting or held broadcast.
+func (c *Canary) Abort(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status.State != CanaryWaiting && c.status.State != CanaryHeld {
+		return fmt.Errorf("cannot abort a broadcast that is %s", c.status.State)
+	}
+	st := c.status
+	st.State, st.Deadline, st.Reason = CanaryAborted, time.Time{}, reason
+	c.set(st, reason)
+	return nil
+}
+
+// Wait blocks until the broadcast may proceed. It returns
+// ErrBroadcastAborted if an admin aborts it, or ctx's error.
+func (c *Canary) Wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		st, changed := c.status, c.changed
+		c.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		switch st.State {
+		case CanaryReleased:
+			return nil
+		case CanaryAborted:
+			return ErrBroadcastAborted
+		case CanaryWaiting, CanaryHeld:
+			timer = time.NewTimer(time.Until(st.Deadline))
+			timeout = timer.C
+		default:
+			return fmt.Errorf("no canary window in progress")
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			c.mu.Lock()
+			if c.status == st {
+				next := c.status
+				next.Deadline = time.Time{}
+				if st.State == CanaryWaiting {
+					next.State = CanaryReleased
+					c.set(next, "window elapsed")
+				} else {
+					next.State, next.Reason = CanaryAborted, "hold expired"
+					c.set(next, "hold expired")
+				}
+			}
+			c.mu.Unlock()
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Status reports the current state.
+func (c *Canary) Status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// set must be called with c.mu held.
+func (c *Canary) set(st CanaryStatus, why string) {
+	log.Printf("Canary: issue %s %s -> %s (%s)", st.IssueID, c.status.State, st.State, why)
+	c.status = st
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
@@ -0,0 +1,60 @@
+package newsletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCanaryHoldExpires(t *testing.T) {
+	c := NewCanary(time.Hour, 50*time.Millisecond)
+	c.Begin("2026-10-18")
+	if err := c.Hold("checking links"); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+	if st := c.Status(); st.Deadline.IsZero() {
+		t.Error("held canary has no deadline")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); !errors.Is(err, ErrBroadcastAborted) {
+		t.Fatalf("Wait = %v, want the broadcast aborted when the hold expires", err)
+	}
+	if st := c.Status(); st.State != CanaryAborted || st.Reason != "hold expired" {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestCanaryReleaseDuringHold(t *testing.T) {
+	c := NewCanary(time.Hour, time.Hour)
+	c.Begin("2026-10-18")
+	if err := c.Hold("checking links"); err != nil {
+		t.Fatalf("Hold: %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.Release("looks fine")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("Wait = %v, want the released broadcast to proceed", err)
+	}
+}
+
+func TestCanaryWindowElapses(t *testing.T) {
+	c := NewCanary(20*time.Millisecond, time.Hour)
+	c.Begin("2026-10-18")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+	if st := c.Status(); st.State != CanaryReleased {
+		t.Errorf("state = %s, want released", st.State)
+	}
+}
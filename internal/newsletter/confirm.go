@@ -0,0 +1,40 @@
+package newsletter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// ResubscribeToken signs the link that lets a subscriber disabled by
+// bounces confirm they want the newsletter again. The token covers the
+// record's status and last update, so it stops working once the record
+// changes, e.g. after a later complaint.
+func ResubscribeToken(secret string, sub store.Subscriber) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "resubscribe\x00%s\x00%s\x00%d", strings.ToLower(sub.Email), sub.Status, sub.UpdatedAt.UnixNano())
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// ValidResubscribeToken reports whether token was made by ResubscribeToken
+// for sub as it is now.
+func ValidResubscribeToken(secret string, sub store.Subscriber, token string) bool {
+	return secret != "" && hmac.Equal([]byte(token), []byte(ResubscribeToken(secret, sub)))
+}
+
+// ResubscribeEmail is the confirmation message sent when a disabled address
+// subscribes again.
+func ResubscribeEmail(publicURL, secret string, sub store.Subscriber) (subject, body string) {
+	link := fmt.Sprintf("%s/subscribe/confirm?email=%s&token=%s",
+		strings.TrimRight(publicURL, "/"), url.QueryEscape(sub.Email), ResubscribeToken(secret, sub))
+	body = fmt.Sprintf(`<p>Someone, hopefully you, asked to subscribe %s to System Design Daily again.</p>
+<p>Earlier issues to this address could not be delivered, so we paused it. <a href="%s">Confirm your subscription</a> to start receiving the newsletter again.</p>
+<p>If you didn't ask for this, ignore this email.</p>`, html.EscapeString(sub.Email), html.EscapeString(link))
+	return "Confirm your System Design Daily subscription", body
+}
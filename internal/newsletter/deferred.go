@@ -0,0 +1,199 @@
+package newsletter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Deferred is part of an issue's audience held back until NotBefore, either
+// because every transport's quota was used up or because it's not yet their
+// delivery time.
+type Deferred struct {
+	Issue     Issue     `bson:"issue" json:"issue"`
+	Emails    []string  `bson:"emails" json:"emails"`
+	NotBefore time.Time `bson:"not_before" json:"not_before"`
+}
+
+// DeferredStore keeps deferred recipients until they are due. An issue can
+// have several batches, one per NotBefore.
+type DeferredStore interface {
+	// Defer adds emails to the issue's batch due at notBefore.
+	Defer(issue Issue, emails []string, notBefore time.Time) error
+	Pending() ([]Deferred, error)
+	// Remove drops emails from the issue's batch due at notBefore.
+	Remove(issueID string, notBefore time.Time, emails []string) error
+}
+
+// FileDeferredStore keeps the pending lists in a JSON file.
+type FileDeferredStore struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewFileDeferredStore(filePath string) *FileDeferredStore {
+	return &FileDeferredStore{filePath: filePath}
+}
+
+func (s *FileDeferredStore) Defer(issue Issue, emails []string, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range all {
+		if all[i].Issue.ID == issue.ID && all[i].NotBefore.Equal(notBefore) {
+			all[i].Emails = mergeEmails(all[i].Emails, emails)
+			found = true
+		}
+	}
+	if !found {
+		all = append(all, Deferred{Issue: issue, Emails: mergeEmails(nil, emails), NotBefore: notBefore})
+	}
+	return s.save(all)
+}
+
+func (s *FileDeferredStore) Pending() ([]Deferred, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *FileDeferredStore) Remove(issueID string, notBefore time.Time, emails []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	kept := all[:0]
+	for _, d := range all {
+		if d.Issue.ID == issueID && d.NotBefore.Equal(notBefore) {
+			d.Emails = removeEmails(d.Emails, emails)
+			if len(d.Emails) == 0 {
+				continue
+			}
+		}
+		kept = append(kept, d)
+	}
+	return s.save(kept)
+}
+
+func (s *FileDeferredStore) load() ([]Deferred, error) {
+	data, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var all []Deferred
+	return all, json.Unmarshal(data, &all)
+}
+
+func (s *FileDeferredStore) save(all []Deferred) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath, data, 0644)
+}
+
+func mergeEmails(existing, add []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		seen[e] = true
+	}
+	for _, e := range add {
+		if !seen[e] {
+			seen[e] = true
+			existing = append(existing, e)
+		}
+	}
+	sort.Strings(existing)
+	return existing
+}
+
+func removeEmails(list, remove []string) []string {
+	drop := make(map[string]bool, len(remove))
+	for _, e := range remove {
+		drop[e] = true
+	}
+	kept := list[:0]
+	for _, e := range list {
+		if !drop[e] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// MongoDeferredStore keeps one document per issue and batch time in the
+// deferred_sends collection.
+type MongoDeferredStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoDeferredStore(db *mongo.Database) *MongoDeferredStore {
+	return &MongoDeferredStore{collection: db.Collection("deferred_sends")}
+}
+
+func (s *MongoDeferredStore) Defer(issue Issue, emails []string, notBefore time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": deferredID(issue.ID, notBefore)},
+		bson.M{
+			"$set":      bson.M{"issue": issue, "not_before": notBefore},
+			"$addToSet": bson.M{"emails": bson.M{"$each": emails}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoDeferredStore) Pending() ([]Deferred, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var all []Deferred
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func (s *MongoDeferredStore) Remove(issueID string, notBefore time.Time, emails []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id := deferredID(issueID, notBefore)
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$pullAll": bson.M{"emails": emails}})
+	if err != nil {
+		return err
+	}
+	_, err = s.collection.DeleteOne(ctx, bson.M{"_id": id, "emails": bson.M{"$size": 0}})
+	return err
+}
+
+func deferredID(issueID string, notBefore time.Time) string {
+	return issueID + "/" + notBefore.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,65 @@
+package newsletter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// DeliveryBatch is the subscribers whose local delivery hour starts at At.
+type DeliveryBatch struct {
+	At          time.Time
+	Subscribers []store.Subscriber
+}
+
+// PlanDelivery groups subscribers by when they should get an issue produced
+// at now: the next start of their delivery hour in their time zone, within
+// the coming day. Subscribers without a time zone, or already in their
+// delivery hour, are due at now. defaultHour applies to subscribers with a
+// time zone but no hour of their own. Batches are sorted by At, so the
+// first is the one to send straight away if its At is now.
+func PlanDelivery(subscribers []store.Subscriber, now time.Time, defaultHour int) []DeliveryBatch {
+	byTime := make(map[time.Time][]store.Subscriber)
+	for _, sub := range subscribers {
+		at := DeliveryTime(sub, now, defaultHour)
+		byTime[at] = append(byTime[at], sub)
+	}
+
+	batches := make([]DeliveryBatch, 0, len(byTime))
+	for at, subs := range byTime {
+		batches = append(batches, DeliveryBatch{At: at, Subscribers: subs})
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].At.Before(batches[j].At) })
+	return batches
+}
+
+// DeliveryTime is when sub should get an issue produced at now.
+func DeliveryTime(sub store.Subscriber, now time.Time, defaultHour int) time.Time {
+	if sub.TimeZone == "" {
+		return now
+	}
+	loc, err := time.LoadLocation(sub.TimeZone)
+	if err != nil {
+		return now
+	}
+	hour := defaultHour
+	if sub.DeliveryHour != nil {
+		hour = *sub.DeliveryHour
+	}
+
+	local := now.In(loc)
+	if local.Hour() == hour {
+		return now
+	}
+	at := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if !at.After(now) {
+		at = time.Date(local.Year(), local.Month(), local.Day()+1, hour, 0, 0, 0, loc)
+	}
+	return at.UTC()
+}
+
+// ValidDeliveryHour reports whether hour can be used as a delivery hour.
+func ValidDeliveryHour(hour int) bool {
+	return hour >= 0 && hour <= 23
+}
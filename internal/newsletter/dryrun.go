@@ -0,0 +1,104 @@
+package newsletter
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/mailer"
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// DryRunOptions configures a dry run.
+type DryRunOptions struct {
+	// Sample is how many subscribers to render; 0 or less renders all.
+	Sample    int
+	OutputDir string
+	Sender    string
+	PublicURL string
+	// DKIM signs the saved messages as the real transport would, if set.
+	DKIM *mailer.DKIMSigner
+}
+
+// DryRunMessage describes one rendered message.
+type DryRunMessage struct {
+	Email string `json:"email"`
+	File  string `json:"file"`
+	Size  int    `json:"size"`
+}
+
+// DryRunReport summarizes what a real send of the issue would look like.
+type DryRunReport struct {
+	IssueID    string          `json:"issue_id"`
+	Subject    string          `json:"subject"`
+	Recipients int             `json:"recipients"`
+	Messages   []DryRunMessage `json:"messages"`
+	MaxSize    int             `json:"max_size"`
+	AvgSize    int             `json:"avg_size"`
+	Warnings   []string        `json:"warnings"`
+	OutputDir  string          `json:"output_dir"`
+	Duration   string          `json:"duration"`
+}
+
+// DryRun renders and builds the full MIME message for a sample of
+// subscribers and saves them as .eml files under opts.OutputDir. No
+// transport is contacted, nothing is deferred and no tracking is recorded.
+func (s *Sender) DryRun(issue Issue, subscribers []store.Subscriber, opts DryRunOptions) (*DryRunReport, error) {
+	start := time.Now()
+	fm, err := mailer.NewFileMailer(opts.OutputDir, false, opts.Sender, opts.PublicURL)
+	if err != nil {
+		return nil, err
+	}
+	fm.DKIM = opts.DKIM
+
+	report := &DryRunReport{
+		IssueID:    issue.ID,
+		Subject:    issue.Subject,
+		Recipients: len(subscribers),
+		OutputDir:  opts.OutputDir,
+		Warnings:   []string{},
+	}
+	fm.OnWrite = func(recipient, path string, size int) {
+		report.Messages = append(report.Messages, DryRunMessage{Email: recipient, File: path, Size: size})
+	}
+
+	// Same rendering as a real send, but into the file mailer
+	preview := &Sender{Mailer: fm, Template: s.Template, Tracker: s.Tracker}
+	result := preview.Send(issue, sampleSubscribers(subscribers, opts.Sample))
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("dry run: %v", err)
+	}
+
+	sort.Slice(report.Messages, func(i, j int) bool { return report.Messages[i].Email < report.Messages[j].Email })
+	total := 0
+	for _, m := range report.Messages {
+		total += m.Size
+		if m.Size > report.MaxSize {
+			report.MaxSize = m.Size
+		}
+	}
+	if len(report.Messages) > 0 {
+		report.AvgSize = total / len(report.Messages)
+	}
+
+	if len(subscribers) == 0 {
+		report.Warnings = append(report.Warnings, "no active subscribers")
+	}
+	report.Warnings = append(report.Warnings, SpamWarnings(issue.Subject, issue.HTML, report.MaxSize)...)
+	report.Duration = time.Since(start).Round(time.Millisecond).String()
+	return report, nil
+}
+
+// sampleSubscribers picks n subscribers at random, or all of them when n is
+// not positive or covers the whole list.
+func sampleSubscribers(subscribers []store.Subscriber, n int) []store.Subscriber {
+	if n <= 0 || n >= len(subscribers) {
+		return subscribers
+	}
+	picked := make([]store.Subscriber, 0, n)
+	for _, i := range rand.Perm(len(subscribers))[:n] {
+		picked = append(picked, subscribers[i])
+	}
+	return picked
+}
@@ -0,0 +1,222 @@
+// Package newsletter turns a generated article into per-subscriber messages
+// and hands them to a mailer.
+package newsletter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/mailer"
+	"github.com/drumil/system-design-mailer/internal/store"
+	"github.com/drumil/system-design-mailer/internal/tracking"
+)
+
+// Issue is one generated newsletter ready to be sent.
+type Issue struct {
+	ID      string
+	Subject string
+	HTML    string
+}
+
+// Result summarizes a send.
+type Result struct {
+	Sent   int
+	Failed map[string]error
+	// Deferred recipients were over quota and will be sent in the next
+	// window.
+	Deferred []string
+	// Skipped recipients already got the issue before the broadcast was
+	// resumed.
+	Skipped int
+	// Cancelled is set when an admin stopped the broadcast part way.
+	Cancelled bool
+	// Unsent recipients weren't tried because the broadcast was cancelled,
+	// or paused during a send that doesn't wait for it.
+	Unsent []string
+}
+
+func (r Result) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to send to %d of %d recipients", len(r.Failed), r.Sent+len(r.Failed))
+}
+
+// Sender delivers an issue to subscribers one at a time so every recipient
+// can get their own rendering of the body.
+type Sender struct {
+	Mailer mailer.Mailer
+	// Template personalizes the body for each subscriber; nil sends the
+	// article as is.
+	Template *Template
+	// Tracker instruments the body for open and click tracking; nil disables it.
+	Tracker *tracking.Tracker
+	// Deferred queues recipients that hit the sending quota; nil counts
+	// them as failed.
+	Deferred DeferredStore
+	// Control pauses or cancels a broadcast between recipients and skips
+	// those already delivered; nil sends to everyone.
+	Control *BroadcastControl
+	// OnDeferredSent, if set, is called after each deferred batch is sent.
+	OnDeferredSent func(issue Issue, result Result)
+}
+
+// Send delivers issue to subscribers, waiting out a pause of its broadcast.
+func (s *Sender) Send(issue Issue, subscribers []store.Subscriber) Result {
+	return s.send(issue, subscribers, true)
+}
+
+// send delivers issue to subscribers. With block unset, a pause of the
+// broadcast stops the send instead of holding it up.
+func (s *Sender) send(issue Issue, subscribers []store.Subscriber, block bool) Result {
+	result := Result{Failed: make(map[string]error)}
+	var resetAt time.Time
+	for i, sub := range subscribers {
+		if err := s.Control.wait(issue.ID, block); err != nil {
+			for _, rest := range subscribers[i:] {
+				result.Unsent = append(result.Unsent, rest.Email)
+			}
+			if errors.Is(err, ErrBroadcastCancelled) {
+				log.Printf("Broadcast of issue %s cancelled after %d recipients", issue.ID, result.Sent)
+				result.Cancelled = true
+			} else {
+				log.Printf("Broadcast of issue %s paused after %d recipients", issue.ID, result.Sent)
+			}
+			break
+		}
+		if s.Control.sent(issue.ID, sub.Email) {
+			result.Skipped++
+			continue
+		}
+
+		body := s.Render(issue, sub)
+		if err := s.Mailer.Send([]string{sub.Email}, issue.Subject, body); err != nil {
+			var qe *mailer.QuotaError
+			if s.Deferred != nil && errors.As(err, &qe) {
+				result.Deferred = append(result.Deferred, sub.Email)
+				if qe.ResetAt.After(resetAt) {
+					resetAt = qe.ResetAt
+				}
+				continue
+			}
+			log.Printf("Failed to send issue %s to %s: %v", issue.ID, sub.Email, err)
+			result.Failed[sub.Email] = err
+			continue
+		}
+		result.Sent++
+		s.Control.record(issue.ID, sub.Email)
+	}
+
+	if len(result.Deferred) > 0 {
+		if err := s.Deferred.Defer(issue, result.Deferred, resetAt); err != nil {
+			log.Printf("Failed to queue %d deferred recipients of issue %s: %v", len(result.Deferred), issue.ID, err)
+			for _, email := range result.Deferred {
+				result.Failed[email] = err
+			}
+			result.Deferred = nil
+		} else {
+			s.Control.Queue(issue.ID, result.Deferred)
+			log.Printf("Quota reached: deferred %d recipients of issue %s until %s", len(result.Deferred), issue.ID, resetAt.Format(time.RFC3339))
+		}
+	}
+	return result
+}
+
+// Schedule queues the subscribers whose delivery hour comes later than now
+// (see PlanDelivery) and returns the ones due now. Queued recipients are
+// recorded with the broadcast control so resuming doesn't queue them twice.
+// A batch that can't be queued is returned as due: better early than never.
+func (s *Sender) Schedule(issue Issue, subscribers []store.Subscriber, now time.Time, defaultHour int) []store.Subscriber {
+	var due, unqueued []store.Subscriber
+	for _, batch := range PlanDelivery(subscribers, now, defaultHour) {
+		if !batch.At.After(now) {
+			due = batch.Subscribers
+			continue
+		}
+		emails := make([]string, len(batch.Subscribers))
+		for i, sub := range batch.Subscribers {
+			emails[i] = sub.Email
+		}
+		if err := s.Deferred.Defer(issue, emails, batch.At); err != nil {
+			log.Printf("Unable to schedule issue %s for %d subscribers at %s, sending now: %v",
+				issue.ID, len(emails), batch.At.Format(time.RFC3339), err)
+			unqueued = append(unqueued, batch.Subscribers...)
+			continue
+		}
+		s.Control.Queue(issue.ID, emails)
+		log.Printf("Scheduled issue %s for %d subscribers at %s", issue.ID, len(emails), batch.At.Format(time.RFC3339))
+	}
+	return append(due, unqueued...)
+}
+
+// SendDeferred sends every deferred batch whose window has started to the
+// recipients that are still active. Recipients that hit the quota again are
+// queued for the next window. A batch whose broadcast is paused or
+// cancelled is kept, and so is the rest of a batch stopped part way.
+func (s *Sender) SendDeferred(subs store.Store, now time.Time) error {
+	if s.Deferred == nil {
+		return nil
+	}
+	pending, err := s.Deferred.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range pending {
+		if now.Before(d.NotBefore) || len(d.Emails) == 0 {
+			continue
+		}
+		if state := s.Control.halted(d.Issue.ID); state != "" {
+			log.Printf("Keeping %d deferred recipients of issue %s: its broadcast is %s", len(d.Emails), d.Issue.ID, state)
+			continue
+		}
+
+		var recipients []store.Subscriber
+		var gone []string
+		for _, email := range d.Emails {
+			sub, err := subs.Get(email)
+			if err != nil || !sub.Active() {
+				// Unsubscribed or bounced since the issue was deferred
+				gone = append(gone, email)
+				continue
+			}
+			recipients = append(recipients, *sub)
+		}
+
+		log.Printf("Sending deferred issue %s to %d recipients", d.Issue.ID, len(recipients))
+		result := s.send(d.Issue, recipients, false)
+		log.Printf("Deferred issue %s: %d sent, %d failed, %d deferred again, %d no longer subscribed, %d kept",
+			d.Issue.ID, result.Sent, len(result.Failed), len(result.Deferred), len(gone), len(result.Unsent))
+		if s.OnDeferredSent != nil {
+			s.OnDeferredSent(d.Issue, result)
+		}
+
+		// Everyone tried is done with the batch, sent or not; send has
+		// queued those over quota again in a later batch
+		done := removeEmails(d.Emails, result.Unsent)
+		if err := s.Deferred.Remove(d.Issue.ID, d.NotBefore, done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render returns the HTML body a subscriber receives.
+func (s *Sender) Render(issue Issue, sub store.Subscriber) string {
+	body := s.Personalize(issue, sub)
+	if s.Tracker != nil && !sub.TrackingOptOut {
+		body = s.Tracker.Instrument(body, issue.ID, sub.Email)
+	}
+	return body
+}
+
+// Personalize applies the template only, without tracking, so previews
+// don't register as opens.
+func (s *Sender) Personalize(issue Issue, sub store.Subscriber) string {
+	if s.Template == nil {
+		return issue.HTML
+	}
+	return s.Template.Execute(issue, sub)
+}
@@ -0,0 +1,84 @@
+package newsletter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+func TestSendDeferredKeepsHaltedBatches(t *testing.T) {
+	dir := t.TempDir()
+	subs, err := store.NewFileStore(filepath.Join(dir, "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails := []string{"a@example.org", "b@example.org"}
+	for _, email := range emails {
+		if err := subs.Add(email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issue := Issue{ID: "2026-10-18", Subject: "Caching", HTML: "<p>Hi</p>"}
+	now := time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+	deferred := NewFileDeferredStore(filepath.Join(dir, "deferred.json"))
+	if err := deferred.Defer(issue, emails, now); err != nil {
+		t.Fatal(err)
+	}
+	control := NewBroadcastControl(NewFileProgressStore(filepath.Join(dir, "broadcasts.json")))
+	m := &countingMailer{got: make(map[string]int)}
+	s := &Sender{Mailer: m, Deferred: deferred, Control: control}
+
+	pending := func() []string {
+		t.Helper()
+		all, err := deferred.Pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []string
+		for _, d := range all {
+			left = append(left, d.Emails...)
+		}
+		return left
+	}
+
+	if err := control.Begin(issue, 2); err != nil {
+		t.Fatal(err)
+	}
+	control.Pause()
+	done := make(chan error, 1)
+	go func() { done <- s.SendDeferred(subs, now) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SendDeferred blocked on a paused broadcast")
+	}
+	if left := pending(); len(left) != 2 || len(m.got) != 0 {
+		t.Errorf("paused: sent %v, left %v; want the batch kept", m.got, left)
+	}
+
+	// A cancel part way through the batch keeps the rest of it
+	control.Resume()
+	m.afterSend = func() { control.Cancel() }
+	if err := s.SendDeferred(subs, now); err != nil {
+		t.Fatal(err)
+	}
+	if left := pending(); len(m.got) != 1 || len(left) != 1 {
+		t.Errorf("cancelled: sent %v, left %v; want one sent and one kept", m.got, left)
+	}
+
+	// Still kept after a restart
+	m.afterSend = nil
+	s.Control = NewBroadcastControl(NewFileProgressStore(filepath.Join(dir, "broadcasts.json")))
+	if err := s.SendDeferred(subs, now); err != nil {
+		t.Fatal(err)
+	}
+	if left := pending(); len(m.got) != 1 || len(left) != 1 {
+		t.Errorf("after restart: sent %v, left %v; want the rest kept", m.got, left)
+	}
+}
@@ -0,0 +1,103 @@
+package newsletter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// gmailClipSize is the size after which Gmail clips a message behind a
+// "View entire message" link, which also hides the tracking pixel.
+const gmailClipSize = 102 * 1024
+
+var (
+	spamPhrases = []string{
+		"act now", "100% free", "free money", "guarantee", "winner", "click here",
+		"limited time", "risk-free", "no cost", "cash bonus", "urgent", "$$$",
+	}
+	shorteners = []string{"bit.ly/", "tinyurl.com/", "goo.gl/", "t.co/", "ow.ly/", "is.gd/"}
+
+	hrefPattern    = regexp.MustCompile(`(?i)href\s*=\s*"([^"]*)"`)
+	imgPattern     = regexp.MustCompile(`(?i)<img\b`)
+	tagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	ipLinkPattern  = regexp.MustCompile(`(?i)^https?://\d{1,3}(\.\d{1,3}){3}`)
+	riskyTagsRegex = regexp.MustCompile(`(?i)<(script|form|iframe|object|embed)\b`)
+)
+
+// SpamWarnings runs heuristic checks that commonly push mail into spam or
+// break rendering. They are warnings only; nothing is blocked.
+func SpamWarnings(subject, bodyHTML string, messageSize int) []string {
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(subject) == "" {
+		warn("subject is empty")
+	}
+	if letters, upper := countCase(subject); letters >= 10 && upper*10 > letters*7 {
+		warn("subject is mostly upper case")
+	}
+	if strings.Count(subject, "!") > 1 {
+		warn("subject has %d exclamation marks", strings.Count(subject, "!"))
+	}
+
+	lowerBody := strings.ToLower(bodyHTML)
+	lowerSubject := strings.ToLower(subject)
+	for _, phrase := range spamPhrases {
+		if strings.Contains(lowerSubject, phrase) || strings.Contains(lowerBody, phrase) {
+			warn("contains spam trigger phrase %q", phrase)
+		}
+	}
+
+	if messageSize > gmailClipSize {
+		warn("message is %d KB; Gmail clips messages over 102 KB", messageSize/1024)
+	}
+
+	text := strings.TrimSpace(tagPattern.ReplaceAllString(bodyHTML, " "))
+	words := len(strings.Fields(text))
+	images := len(imgPattern.FindAllString(bodyHTML, -1))
+	if words < 50 {
+		warn("body has only %d words of text", words)
+	}
+	if images > 0 && words/images < 100 {
+		warn("high image-to-text ratio (%d images, %d words)", images, words)
+	}
+
+	links := hrefPattern.FindAllStringSubmatch(bodyHTML, -1)
+	if len(links) > 50 {
+		warn("body has %d links", len(links))
+	}
+	for _, l := range links {
+		target := strings.ToLower(l[1])
+		for _, s := range shorteners {
+			if strings.Contains(target, s) {
+				warn("link uses URL shortener: %s", l[1])
+			}
+		}
+		if ipLinkPattern.MatchString(target) {
+			warn("link points to a raw IP address: %s", l[1])
+		}
+	}
+
+	if m := riskyTagsRegex.FindStringSubmatch(bodyHTML); m != nil {
+		warn("body contains a <%s> tag, which mail clients strip or flag", strings.ToLower(m[1]))
+	}
+	if strings.Contains(bodyHTML, "```") {
+		warn("body contains unrendered markdown code fences")
+	}
+	return warnings
+}
+
+func countCase(s string) (letters, upper int) {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters, upper
+}
@@ -0,0 +1,154 @@
+package newsletter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drumil/system-design-mailer/internal/store"
+)
+
+// DefaultTemplate wraps the article with a greeting and a referral line.
+const DefaultTemplate = `<p>Hi {{.FirstName}},</p>
+{{.Article}}
+<p style="font-size: 13px; color: #555;">
+{{- if gt .DaysSubscribed 0}}You've been learning with us for {{.DaysSubscribed}} day{{if ne .DaysSubscribed 1}}s{{end}}.{{end}}
+{{- if gt .Streak 1}} That's a {{.Streak}}-issue reading streak!{{end}}
+Know someone preparing for system design interviews? Share your link: <a href="{{.ReferralURL}}">{{.ReferralURL}}</a></p>`
+
+// MergeFields are the values a template can use. Every field has a usable
+// value even when the subscriber record is sparse.
+type MergeFields struct {
+	Email          string
+	Name           string // may be empty
+	FirstName      string // Name's first word, or "there"
+	Language       string // defaults to "en"
+	DaysSubscribed int
+	Streak         int
+	ReferralURL    string
+	IssueID        string
+	Subject        string
+	Article        template.HTML
+}
+
+// Template personalizes an issue for each subscriber with html/template.
+// The article is inserted as trusted HTML; merge fields are escaped.
+type Template struct {
+	tmpl      *template.Template
+	PublicURL string
+}
+
+var templateFuncs = template.FuncMap{
+	// default returns fallback when value is empty: {{default "friend" .Name}}
+	"default": func(fallback string, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+func NewTemplate(text, publicURL string) (*Template, error) {
+	tmpl, err := template.New("newsletter").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse newsletter template: %v", err)
+	}
+	t := &Template{tmpl: tmpl, PublicURL: strings.TrimRight(publicURL, "/")}
+
+	// Catch references to unknown fields at startup rather than on send
+	sample := Issue{ID: "2006-01-02", Subject: "Sample", HTML: "<p>Sample</p>"}
+	if err := tmpl.Execute(io.Discard, t.Fields(sample, store.Subscriber{Email: "sample@example.com"})); err != nil {
+		return nil, fmt.Errorf("newsletter template does not render: %v", err)
+	}
+	return t, nil
+}
+
+// LoadTemplate reads a template from path, or uses DefaultTemplate when path
+// is empty.
+func LoadTemplate(path, publicURL string) (*Template, error) {
+	if path == "" {
+		return NewTemplate(DefaultTemplate, publicURL)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read newsletter template: %v", err)
+	}
+	return NewTemplate(string(data), publicURL)
+}
+
+// Fields builds the merge fields for sub.
+func (t *Template) Fields(issue Issue, sub store.Subscriber) MergeFields {
+	f := MergeFields{
+		Email:       sub.Email,
+		Name:        strings.TrimSpace(sub.Name),
+		FirstName:   "there",
+		Language:    sub.Language,
+		Streak:      sub.Streak,
+		ReferralURL: t.PublicURL + "/?ref=" + url.QueryEscape(ReferralCode(sub.Email)),
+		IssueID:     issue.ID,
+		Subject:     issue.Subject,
+		Article:     template.HTML(issue.HTML),
+	}
+	if first, _, _ := strings.Cut(f.Name, " "); first != "" {
+		f.FirstName = first
+	}
+	if f.Language == "" {
+		f.Language = "en"
+	}
+	if !sub.CreatedAt.IsZero() {
+		f.DaysSubscribed = int(time.Since(sub.CreatedAt).Hours() / 24)
+	}
+	return f
+}
+
+// Execute renders the issue for sub. If the template fails (e.g. a custom
+// template references a field that doesn't exist) the plain article is
+// returned so the subscriber still gets the issue.
+func (t *Template) Execute(issue Issue, sub store.Subscriber) string {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, t.Fields(issue, sub)); err != nil {
+		log.Printf("Template failed for %s, sending unpersonalized issue: %v", sub.Email, err)
+		return issue.HTML
+	}
+	return buf.String()
+}
+
+// ReferralCode is a stable, non-reversible code identifying a subscriber in
+// referral links.
+func ReferralCode(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return strings.ToLower(base32.StdEncoding.EncodeToString(sum[:])[:10])
+}
+
+// UpdateStreak records that sub opened issueID and reports whether the
+// record changed. Issue IDs are dates, so opening the issue after the last
+// one opened extends the streak and a gap resets it.
+func UpdateStreak(sub *store.Subscriber, issueID string) bool {
+	if sub.LastOpened == issueID {
+		return false
+	}
+	opened, err := time.Parse("2006-01-02", issueID)
+	if err != nil {
+		return false
+	}
+	last, err := time.Parse("2006-01-02", sub.LastOpened)
+	switch {
+	case err == nil && opened.Before(last):
+		// An old issue opened late doesn't affect the streak
+		return false
+	case err == nil && opened.Sub(last) == 24*time.Hour:
+		sub.Streak++
+	default:
+		sub.Streak = 1
+	}
+	sub.LastOpened = issueID
+	return true
+}
@@ -0,0 +1,354 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	// Named time zones work even when the host has no zoneinfo database
+	_ "time/tzdata"
+)
+
+// CronSchedule is a parsed cron expression evaluated in a time zone.
+//
+// Expressions have five fields (minute hour day-of-month month day-of-week)
+// or six with a leading seconds field. Fields accept *, ?, lists (1,15),
+// ranges (1-5), steps (*/15, 0-30/10) and month and weekday names (JAN,
+// MON). The macros @yearly, @monthly, @weekly, @daily and @hourly are also
+// accepted. As in standard cron, when both day fields are restricted a day
+// matching either one runs.
+//
+// Times skipped by a daylight saving change don't run that day; times
+// repeated by one run once.
+type CronSchedule struct {
+	Expr     string
+	Location *time.Location
+
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool
+}
+
+const allHours = 1<<24 - 1
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// ParseCron parses expr for evaluation in loc; nil loc means UTC.
+func ParseCron(expr string, loc *time.Location) (*CronSchedule, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 or 6 fields, got %d", expr, len(fields))
+	}
+
+	s := &CronSchedule{Expr: expr, Location: loc}
+	var err error
+	if s.second, _, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid seconds in %q: %v", expr, err)
+	}
+	if s.minute, _, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minutes in %q: %v", expr, err)
+	}
+	if s.hour, _, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hours in %q: %v", expr, err)
+	}
+	if s.dom, s.domStar, err = parseCronField(fields[3], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month in %q: %v", expr, err)
+	}
+	if s.month, _, err = parseCronField(fields[4], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid month in %q: %v", expr, err)
+	}
+	if s.dow, s.dowStar, err = parseCronField(fields[5], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week in %q: %v", expr, err)
+	}
+	// 7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parseCronField returns the bit set of values matched by field and whether
+// it was an unrestricted * or ?.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, bool, error) {
+	var bits uint64
+	star := false
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, false, fmt.Errorf("bad step %q", stepPart)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch rangePart {
+		case "*", "?":
+			lo, hi = min, max
+			star = star || !hasStep
+		default:
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = cronValue(from, names); err != nil {
+				return 0, false, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(to, names); err != nil {
+					return 0, false, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end in steps of 15
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, false, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that matches the schedule, or the
+// zero time if there is none within five years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := s.Location
+	t = t.In(loc)
+	// Start from the next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	// Once a field doesn't match, the smaller fields start from zero. Hours
+	// and below are stepped by adding durations, since building a wall time
+	// with time.Date is ambiguous during a fall-back hour.
+	added := false
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second)
+		}
+		prev := t
+		t = t.Add(time.Hour)
+		if t.Day() != prev.Day() {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			goto wrap
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+			t = t.Add(-time.Duration(t.Second()) * time.Second)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	// A wall time repeated by a fall-back change already had its turn an
+	// hour earlier, unless the job runs every hour anyway
+	if s.hour != allHours {
+		if earlier := t.Add(-time.Hour); earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() {
+			return s.Next(t)
+		}
+	}
+	return t
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Prev returns the latest run time at or before t, looking back at most
+// lookback, or the zero time if there is none.
+func (s *CronSchedule) Prev(t time.Time, lookback time.Duration) time.Time {
+	// Widen the search window until it contains a run, so frequent
+	// schedules don't have to step through the whole lookback
+	for window := time.Hour; ; window *= 2 {
+		if window > lookback {
+			window = lookback
+		}
+		var last time.Time
+		for next := s.Next(t.Add(-window)); !next.IsZero() && !next.After(t); next = s.Next(next) {
+			last = next
+		}
+		if !last.IsZero() || window >= lookback {
+			return last
+		}
+	}
+}
+
+// NextN returns the next n run times after t.
+func (s *CronSchedule) NextN(t time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	for len(runs) < n {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// Clock is the source of time for CronScheduler, replaceable in tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// CronScheduler runs a job at the times given by a cron expression. A run
+// that is still going when the next time arrives delays it rather than
+// overlapping.
+type CronScheduler struct {
+	Schedule *CronSchedule
+	Clock    Clock
+
+	job  Job
+	stop chan struct{}
+}
+
+func NewCronScheduler(expr string, loc *time.Location, job Job) (*CronScheduler, error) {
+	schedule, err := ParseCron(expr, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &CronScheduler{
+		Schedule: schedule,
+		Clock:    realClock{},
+		job:      job,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (s *CronScheduler) Start() {
+	go func() {
+		log.Printf("Cron scheduler started: %q in %s, next run at %s",
+			s.Schedule.Expr, s.Schedule.Location, s.Schedule.Next(s.Clock.Now()).Format(time.RFC3339))
+		for {
+			now := s.Clock.Now()
+			next := s.Schedule.Next(now)
+			if next.IsZero() {
+				log.Printf("Cron scheduler: %q never runs again, stopping", s.Schedule.Expr)
+				return
+			}
+			select {
+			case <-s.Clock.After(next.Sub(now)):
+				select {
+				case <-s.stop:
+					log.Println("Cron scheduler stopped")
+					return
+				default:
+				}
+				log.Printf("Cron scheduler triggered job (scheduled for %s)", next.Format(time.RFC3339))
+				s.job()
+			case <-s.stop:
+				log.Println("Cron scheduler stopped")
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops scheduling. A job in progress is not interrupted.
+func (s *CronScheduler) Stop() {
+	close(s.stop)
+}
+
+// NextRuns returns the next n scheduled run times.
+func (s *CronScheduler) NextRuns(n int) []time.Time {
+	return s.Schedule.NextN(s.Clock.Now(), n)
+}
@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+	} {
+		if _, err := ParseCron(expr, nil); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	kolkata := mustLocation(t, "Asia/Kolkata")
+
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		from string
+		want string
+	}{
+		// Five fields, UTC
+		{"0 7 * * *", time.UTC, "2026-03-01T06:59:59Z", "2026-03-01T07:00:00Z"},
+		{"0 7 * * *", time.UTC, "2026-03-01T07:00:00Z", "2026-03-02T07:00:00Z"},
+		{"*/15 * * * *", time.UTC, "2026-03-01T10:07:00Z", "2026-03-01T10:15:00Z"},
+		{"0 9 * * MON-FRI", time.UTC, "2026-03-06T10:00:00Z", "2026-03-09T09:00:00Z"},
+		{"0 0 1 jan *", time.UTC, "2026-03-01T00:00:00Z", "2027-01-01T00:00:00Z"},
+		{"0 12 29 2 *", time.UTC, "2026-03-01T00:00:00Z", "2028-02-29T12:00:00Z"},
+		{"0 0 * * 7", time.UTC, "2026-03-02T00:00:00Z", "2026-03-08T00:00:00Z"},
+		// Both day fields restricted: either matches
+		{"0 0 13 * FRI", time.UTC, "2026-03-01T00:00:00Z", "2026-03-06T00:00:00Z"},
+		// Six fields
+		{"30 0 7 * * *", time.UTC, "2026-03-01T07:00:00Z", "2026-03-01T07:00:30Z"},
+		{"*/10 * * * * *", time.UTC, "2026-03-01T07:00:01.5Z", "2026-03-01T07:00:10Z"},
+		// Macros
+		{"@daily", time.UTC, "2026-03-01T12:00:00Z", "2026-03-02T00:00:00Z"},
+		{"@hourly", time.UTC, "2026-03-01T12:30:00Z", "2026-03-01T13:00:00Z"},
+		// Named zones
+		{"0 7 * * *", newYork, "2026-01-15T00:00:00Z", "2026-01-15T12:00:00Z"},
+		{"0 7 * * *", newYork, "2026-07-15T00:00:00Z", "2026-07-15T11:00:00Z"},
+		{"30 6 * * *", kolkata, "2026-03-01T00:00:00Z", "2026-03-01T01:00:00Z"},
+		// 2:30 doesn't exist on the spring-forward day, so it's skipped
+		{"30 2 * * *", newYork, "2026-03-08T00:00:00Z", "2026-03-09T06:30:00Z"},
+		// 1:30 happens twice on the fall-back day but runs once
+		{"30 1 * * *", newYork, "2026-11-01T05:31:00Z", "2026-11-02T06:30:00Z"},
+		// ...unless it runs every hour
+		{"30 * * * *", newYork, "2026-11-01T05:31:00Z", "2026-11-01T06:30:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr, tt.loc)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		from, _ := time.Parse(time.RFC3339Nano, tt.from)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := s.Next(from); !got.Equal(want) {
+			t.Errorf("%q in %s: Next(%s) = %s, want %s", tt.expr, tt.loc, tt.from, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestCronNextN(t *testing.T) {
+	s, err := ParseCron("0 7 * * *", mustLocation(t, "Europe/London"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks go forward on 2026-03-29
+	from, _ := time.Parse(time.RFC3339, "2026-03-27T12:00:00Z")
+	got := s.NextN(from, 3)
+	want := []string{"2026-03-28T07:00:00Z", "2026-03-29T06:00:00Z", "2026-03-30T06:00:00Z"}
+	if len(got) != len(want) {
+		t.Fatalf("NextN returned %d times, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].UTC().Format(time.RFC3339) != want[i] {
+			t.Errorf("run %d = %s, want %s", i, got[i].UTC().Format(time.RFC3339), want[i])
+		}
+	}
+}
+
+func TestCronPrev(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	tests := []struct {
+		expr     string
+		loc      *time.Location
+		at       string
+		lookback time.Duration
+		want     string
+	}{
+		{"0 7 * * *", time.UTC, "2026-03-02T06:59:59Z", 48 * time.Hour, "2026-03-01T07:00:00Z"},
+		{"0 7 * * *", time.UTC, "2026-03-02T07:00:00Z", 48 * time.Hour, "2026-03-02T07:00:00Z"},
+		{"0 7 * * *", newYork, "2026-03-02T15:00:00Z", 48 * time.Hour, "2026-03-02T12:00:00Z"},
+		{"*/5 * * * *", time.UTC, "2026-03-02T10:07:00Z", 48 * time.Hour, "2026-03-02T10:05:00Z"},
+		{"0 9 * * MON", time.UTC, "2026-03-06T00:00:00Z", 8 * 24 * time.Hour, "2026-03-02T09:00:00Z"},
+		// Nothing within the lookback
+		{"0 9 * * MON", time.UTC, "2026-03-06T00:00:00Z", 48 * time.Hour, ""},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr, tt.loc)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		got := s.Prev(at, tt.lookback)
+		gotStr := ""
+		if !got.IsZero() {
+			gotStr = got.UTC().Format(time.RFC3339)
+		}
+		if gotStr != tt.want {
+			t.Errorf("%q: Prev(%s, %s) = %q, want %q", tt.expr, tt.at, tt.lookback, gotStr, tt.want)
+		}
+	}
+}
+
+// fakeClock only moves when Advance is called.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{}
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, added: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	c.added <- struct{}{}
+	return ch
+}
+
+// Advance moves the clock forward and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(c.now) {
+			w.ch <- c.now
+		} else {
+			kept = append(kept, w)
+		}
+	}
+	c.waiters = kept
+}
+
+// waitForTimer blocks until the scheduler has set its next timer.
+func (c *fakeClock) waitForTimer(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.added:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scheduler did not set a timer")
+	}
+}
+
+func TestCronSchedulerRunsOnSchedule(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2026-03-01T06:00:00Z")
+	clock := newFakeClock(start)
+
+	runs := make(chan time.Time, 10)
+	s, err := NewCronScheduler("0 7 * * *", time.UTC, func() { runs <- clock.Now() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Clock = clock
+
+	next := s.NextRuns(2)
+	if len(next) != 2 || next[0].Format(time.RFC3339) != "2026-03-01T07:00:00Z" || next[1].Format(time.RFC3339) != "2026-03-02T07:00:00Z" {
+		t.Fatalf("NextRuns = %v", next)
+	}
+
+	s.Start()
+	defer s.Stop()
+
+	clock.waitForTimer(t)
+	clock.Advance(59 * time.Minute)
+	select {
+	case <-runs:
+		t.Fatal("job ran before its time")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case at := <-runs:
+		if at.Format(time.RFC3339) != "2026-03-01T07:00:00Z" {
+			t.Errorf("job ran at %s", at.Format(time.RFC3339))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+
+	clock.waitForTimer(t)
+	clock.Advance(24 * time.Hour)
+	select {
+	case at := <-runs:
+		if at.Format(time.RFC3339) != "2026-03-02T07:00:00Z" {
+			t.Errorf("second run at %s", at.Format(time.RFC3339))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second run did not happen")
+	}
+}
+
+func TestCronSchedulerStop(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	s, err := NewCronScheduler("@hourly", nil, func() { t.Error("job ran after Stop") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Clock = clock
+	s.Start()
+	clock.waitForTimer(t)
+	s.Stop()
+	clock.Advance(2 * time.Hour)
+}
@@ -1,8 +1,85 @@
 package store
 
+import (
+	"errors"
+	"time"
+)
+
+// Subscriber statuses. Only active subscribers receive the newsletter.
+const (
+	StatusActive     = "active"
+	StatusBounced    = "bounced"
+	StatusComplained = "complained"
+)
+
+// ErrNotFound is returned by Get when no subscriber has the given email.
+var ErrNotFound = errors.New("subscriber not found")
+
+type Subscriber struct {
+	Email        string    `bson:"email" json:"email"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at,omitzero"`
+	Status       string    `bson:"status,omitempty" json:"status,omitempty"`
+	StatusReason string    `bson:"status_reason,omitempty" json:"status_reason,omitempty"`
+	SoftBounces  int       `bson:"soft_bounces,omitempty" json:"soft_bounces,omitempty"`
+	// TrackingOptOut disables open and click tracking for this subscriber
+	TrackingOptOut bool      `bson:"tracking_opt_out,omitempty" json:"tracking_opt_out,omitempty"`
+	UpdatedAt      time.Time `bson:"updated_at,omitempty" json:"updated_at,omitzero"`
+
+	// Personalization, all optional
+	Name       string `bson:"name,omitempty" json:"name,omitempty"`
+	Language   string `bson:"language,omitempty" json:"language,omitempty"`
+	ReferredBy string `bson:"referred_by,omitempty" json:"referred_by,omitempty"`
+	// Streak counts consecutive daily issues opened, ending with LastOpened
+	Streak     int    `bson:"streak,omitempty" json:"streak,omitempty"`
+	LastOpened string `bson:"last_opened,omitempty" json:"last_opened,omitempty"`
+
+	// Delivery window: an IANA time zone and the local hour (0-23) to
+	// receive the issue at; both optional
+	TimeZone     string `bson:"time_zone,omitempty" json:"time_zone,omitempty"`
+	DeliveryHour *int   `bson:"delivery_hour,omitempty" json:"delivery_hour,omitempty"`
+}
+
+// Active reports whether the subscriber should receive mail. Records created
+// before statuses existed have no status and count as active.
+func (s Subscriber) Active() bool {
+	return s.Status == "" || s.Status == StatusActive
+}
+
+// Reactivate makes a subscriber disabled by bounces active again. It is
+// only for a confirmed opt-in: subscribing again never reactivates an
+// address by itself.
+func (s *Subscriber) Reactivate() {
+	s.Status = StatusActive
+	s.StatusReason = ""
+	s.SoftBounces = 0
+}
+
+// suppression returns what Remove keeps of a disabled subscriber: enough to
+// stop the address from being subscribed again without the checks its
+// status calls for, and none of the personal details.
+func (s Subscriber) suppression() Subscriber {
+	return Subscriber{
+		Email:        s.Email,
+		CreatedAt:    s.CreatedAt,
+		Status:       s.Status,
+		StatusReason: s.StatusReason,
+		SoftBounces:  s.SoftBounces,
+	}
+}
+
 // Store defines the behavior for subscriber persistence
 type Store interface {
+	// Add creates an active subscriber. An existing record, whatever its
+	// status, is left unchanged.
 	Add(email string) error
+	// Remove deletes an active subscriber. A bounced or complained one is
+	// kept as a suppression record, so Add still leaves it disabled.
 	Remove(email string) error
+	// GetAll returns the emails of active subscribers.
 	GetAll() ([]string, error)
+	// ListActive returns the full records of active subscribers.
+	ListActive() ([]Subscriber, error)
+	Get(email string) (*Subscriber, error)
+	// Update replaces the stored record for sub.Email.
+	Update(sub Subscriber) error
 }
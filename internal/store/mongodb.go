@@ -14,11 +14,6 @@ type MongoStore struct {
 	collection *mongo.Collection
 }
 
-type Subscriber struct {
-	Email     string    `bson:"email"`
-	CreatedAt time.Time `bson:"created_at"`
-}
-
 func NewMongoStore(uri string) (*MongoStore, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -56,15 +51,13 @@ func (s *MongoStore) Add(email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	sub := Subscriber{
-		Email:     email,
-		CreatedAt: time.Now(),
-	}
-
 	// Use UpdateOne with Upsert to be safe, or InsertOne and ignore duplicate error.
-	// UpdateOne is cleaner for idempotency.
+	// UpdateOne is cleaner for idempotency. An existing record is left alone, so
+	// an address disabled by a bounce or complaint stays disabled.
 	filter := bson.M{"email": email}
-	update := bson.M{"$setOnInsert": sub}
+	update := bson.M{
+		"$setOnInsert": bson.M{"email": email, "created_at": time.Now(), "status": StatusActive},
+	}
 	opts := options.Update().SetUpsert(true)
 
 	_, err := s.collection.UpdateOne(ctx, filter, update, opts)
@@ -75,19 +68,50 @@ func (s *MongoStore) Remove(email string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.M{"email": email}
-	_, err := s.collection.DeleteOne(ctx, filter)
+	// Only active records are deleted; a disabled one is replaced by its
+	// suppression record below
+	filter := bson.M{"email": email, "status": bson.M{"$in": bson.A{nil, "", StatusActive}}}
+	res, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil || res.DeletedCount > 0 {
+		return err
+	}
+
+	var sub Subscriber
+	err = s.collection.FindOne(ctx, bson.M{"email": email}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil // Not found, treat as success
+	}
+	if err != nil {
+		return err
+	}
+	suppressed := sub.suppression()
+	suppressed.UpdatedAt = time.Now()
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"email": email}, suppressed)
 	return err
 }
 
 func (s *MongoStore) GetAll() ([]string, error) {
+	subs, err := s.ListActive()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		results = append(results, sub.Email)
+	}
+	return results, nil
+}
+
+func (s *MongoStore) ListActive() ([]Subscriber, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var results []string
-	
-	// Projection to return only email
-	cursor, err := s.collection.Find(ctx, bson.M{})
+	var results []Subscriber
+
+	// Records without a status predate bounce handling and count as active
+	filter := bson.M{"status": bson.M{"$in": bson.A{nil, "", StatusActive}}}
+	cursor, err := s.collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +122,7 @@ func (s *MongoStore) GetAll() ([]string, error) {
 		if err := cursor.Decode(&sub); err != nil {
 			continue
 		}
-		results = append(results, sub.Email)
+		results = append(results, sub)
 	}
 
 	if err := cursor.Err(); err != nil {
@@ -107,3 +131,39 @@ func (s *MongoStore) GetAll() ([]string, error) {
 
 	return results, nil
 }
+
+func (s *MongoStore) Get(email string) (*Subscriber, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sub Subscriber
+	err := s.collection.FindOne(ctx, bson.M{"email": email}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *MongoStore) Update(sub Subscriber) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub.UpdatedAt = time.Now()
+	res, err := s.collection.ReplaceOne(ctx, bson.M{"email": sub.Email}, sub)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Database exposes the underlying database so other components can keep
+// their own collections next to the subscribers.
+func (s *MongoStore) Database() *mongo.Database {
+	return s.collection.Database()
+}
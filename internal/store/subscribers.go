@@ -4,18 +4,19 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 )
 
 type FileStore struct {
-	mu       sync.RWMutex
-	filePath string
-	emails   []string
+	mu          sync.RWMutex
+	filePath    string
+	subscribers []Subscriber
 }
 
 func NewFileStore(filePath string) (*FileStore, error) {
 	s := &FileStore{
-		filePath: filePath,
-		emails:   []string{},
+		filePath:    filePath,
+		subscribers: []Subscriber{},
 	}
 	if err := s.load(); err != nil {
 		if os.IsNotExist(err) {
@@ -35,11 +36,21 @@ func (s *FileStore) load() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &s.emails)
+	// Older files are a plain list of emails
+	var emails []string
+	if err := json.Unmarshal(data, &emails); err == nil {
+		s.subscribers = make([]Subscriber, 0, len(emails))
+		for _, e := range emails {
+			s.subscribers = append(s.subscribers, Subscriber{Email: e, Status: StatusActive})
+		}
+		return nil
+	}
+
+	return json.Unmarshal(data, &s.subscribers)
 }
 
 func (s *FileStore) save() error {
-	data, err := json.MarshalIndent(s.emails, "", "  ")
+	data, err := json.MarshalIndent(s.subscribers, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -50,14 +61,19 @@ func (s *FileStore) Add(email string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Check for duplicates
-	for _, e := range s.emails {
-		if e == email {
+	// Check for duplicates. A disabled address stays disabled: only a
+	// confirmed opt-in reactivates it (see Subscriber.Reactivate).
+	for _, sub := range s.subscribers {
+		if sub.Email == email {
 			return nil // Already exists
 		}
 	}
 
-	s.emails = append(s.emails, email)
+	s.subscribers = append(s.subscribers, Subscriber{
+		Email:     email,
+		CreatedAt: time.Now(),
+		Status:    StatusActive,
+	})
 	return s.save()
 }
 
@@ -65,10 +81,15 @@ func (s *FileStore) Remove(email string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for i, e := range s.emails {
-		if e == email {
+	for i, sub := range s.subscribers {
+		if sub.Email == email {
+			if !sub.Active() {
+				s.subscribers[i] = sub.suppression()
+				s.subscribers[i].UpdatedAt = time.Now()
+				return s.save()
+			}
 			// Remove element at index i
-			s.emails = append(s.emails[:i], s.emails[i+1:]...)
+			s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
 			return s.save()
 		}
 	}
@@ -78,9 +99,52 @@ func (s *FileStore) Remove(email string) error {
 func (s *FileStore) GetAll() ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	
-	// Return a copy
-	result := make([]string, len(s.emails))
-	copy(result, s.emails)
+
+	result := make([]string, 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		if sub.Active() {
+			result = append(result, sub.Email)
+		}
+	}
 	return result, nil
 }
+
+func (s *FileStore) ListActive() ([]Subscriber, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Subscriber, 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		if sub.Active() {
+			result = append(result, sub)
+		}
+	}
+	return result, nil
+}
+
+func (s *FileStore) Get(email string) (*Subscriber, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sub := range s.subscribers {
+		if sub.Email == email {
+			found := sub
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *FileStore) Update(sub Subscriber) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.subscribers {
+		if existing.Email == sub.Email {
+			sub.UpdatedAt = time.Now()
+			s.subscribers[i] = sub
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreAddKeepsDisabledSubscribers(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{StatusBounced, StatusComplained} {
+		email := status + "@example.org"
+		if err := s.Add(email); err != nil {
+			t.Fatal(err)
+		}
+		sub, _ := s.Get(email)
+		sub.Status, sub.StatusReason, sub.SoftBounces = status, "5.1.1", 3
+		if err := s.Update(*sub); err != nil {
+			t.Fatal(err)
+		}
+
+		// Subscribing again is not a confirmed opt-in
+		if err := s.Add(email); err != nil {
+			t.Fatal(err)
+		}
+		sub, _ = s.Get(email)
+		if sub.Status != status || sub.SoftBounces != 3 {
+			t.Errorf("Add changed a %s subscriber to %+v", status, sub)
+		}
+	}
+
+	sub, _ := s.Get("bounced@example.org")
+	sub.Reactivate()
+	if err := s.Update(*sub); err != nil {
+		t.Fatal(err)
+	}
+	if emails, _ := s.GetAll(); len(emails) != 1 || emails[0] != "bounced@example.org" {
+		t.Errorf("active subscribers = %v, want the reactivated one", emails)
+	}
+}
+
+func TestFileStoreRemoveKeepsSuppressionRecord(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("spam@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := s.Get("spam@example.org")
+	sub.Name = "Ada"
+	sub.Status, sub.StatusReason = StatusComplained, "abuse report"
+	if err := s.Update(*sub); err != nil {
+		t.Fatal(err)
+	}
+
+	// Complaint, then unsubscribe, then subscribe
+	if err := s.Remove("spam@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("spam@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err = s.Get("spam@example.org")
+	if err != nil {
+		t.Fatalf("suppression record was deleted: %v", err)
+	}
+	if sub.Status != StatusComplained || sub.Active() {
+		t.Errorf("status after unsubscribe and subscribe = %q, want %q", sub.Status, StatusComplained)
+	}
+	if sub.Name != "" {
+		t.Errorf("suppression record kept the name %q", sub.Name)
+	}
+	if emails, _ := s.GetAll(); len(emails) != 0 {
+		t.Errorf("active subscribers = %v, want none", emails)
+	}
+}
+
+func TestFileStoreRemoveDeletesActiveSubscriber(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "subscribers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("reader@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("reader@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("reader@example.org"); err != ErrNotFound {
+		t.Errorf("Get after Remove = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package topics spots articles that repeat a recently covered topic.
+package topics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Embedder turns text into an embedding vector.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// Past is a previously sent topic.
+type Past struct {
+	ID    string
+	Title string
+	// Embedding of Title, if already known.
+	Embedding []float32
+}
+
+// Match is the past topic a new title repeats.
+type Match struct {
+	ID    string  `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+	// By is "title" or "embedding", whichever similarity crossed its
+	// threshold.
+	By string `json:"by"`
+}
+
+func (m *Match) String() string {
+	return fmt.Sprintf("%q (issue %s, %s similarity %.2f)", m.Title, m.ID, m.By, m.Score)
+}
+
+// Deduper compares a new title with past ones by normalized title
+// similarity and, with an Embedder, by embedding cosine similarity.
+type Deduper struct {
+	// TitleThreshold is the title similarity (0-1) at or above which a
+	// title repeats a past one.
+	TitleThreshold float64
+	// Embedder is optional; without it only titles are compared.
+	Embedder           Embedder
+	EmbeddingThreshold float64
+
+	mu    sync.Mutex
+	cache map[string][]float32
+}
+
+func NewDeduper(titleThreshold float64, embedder Embedder, embeddingThreshold float64) *Deduper {
+	return &Deduper{
+		TitleThreshold:     titleThreshold,
+		Embedder:           embedder,
+		EmbeddingThreshold: embeddingThreshold,
+		cache:              make(map[string][]float32),
+	}
+}
+
+// Check returns the past topic title repeats, or nil. It also returns
+// title's embedding (nil without an Embedder) so it can be stored with the
+// article. An embedding failure is returned with any title match found.
+func (d *Deduper) Check(ctx context.Context, title string, past []Past) (*Match, []float32, error) {
+	var best *Match
+	for _, p := range past {
+		if score := Similarity(title, p.Title); score >= d.TitleThreshold && (best == nil || score > best.Score) {
+			best = &Match{ID: p.ID, Title: p.Title, Score: score, By: "title"}
+		}
+	}
+	if d.Embedder == nil {
+		return best, nil, nil
+	}
+
+	vec, err := d.embed(ctx, title, nil)
+	if err != nil {
+		return best, nil, fmt.Errorf("unable to embed %q: %v", title, err)
+	}
+	if best != nil {
+		return best, vec, nil
+	}
+	for _, p := range past {
+		pv, err := d.embed(ctx, p.Title, p.Embedding)
+		if err != nil {
+			return nil, vec, fmt.Errorf("unable to embed %q: %v", p.Title, err)
+		}
+		if score := Cosine(vec, pv); score >= d.EmbeddingThreshold && (best == nil || score > best.Score) {
+			best = &Match{ID: p.ID, Title: p.Title, Score: score, By: "embedding"}
+		}
+	}
+	return best, vec, nil
+}
+
+// embed returns known if set, else a cached or freshly computed embedding
+// of text.
+func (d *Deduper) embed(ctx context.Context, text string, known []float32) ([]float32, error) {
+	if len(known) > 0 {
+		return known, nil
+	}
+	key := Normalize(text)
+	d.mu.Lock()
+	vec, ok := d.cache[key]
+	d.mu.Unlock()
+	if ok {
+		return vec, nil
+	}
+	vec, err := d.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.cache[key] = vec
+	d.mu.Unlock()
+	return vec, nil
+}
+
+// stopwords carry no topic: "Design a URL Shortener" and "URL Shortener
+// Design Explained" are the same article.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "of": true,
+	"to": true, "in": true, "for": true, "on": true, "with": true, "how": true,
+	"what": true, "why": true, "is": true, "are": true, "it": true, "its": true,
+	"your": true, "you": true, "we": true, "vs": true, "versus": true,
+	"design": true, "designing": true, "understanding": true, "explained": true,
+	"introduction": true, "intro": true, "guide": true, "deep": true, "dive": true,
+	"simplified": true, "simple": true, "basics": true, "works": true, "work": true,
+	"pattern": true, "patterns": true, "principle": true, "system": true,
+	"building": true, "build": true, "really": true,
+}
+
+// Normalize lowercases a title and reduces it to its topic words, without
+// punctuation, stopwords or plural "s".
+func Normalize(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	kept := words[:0]
+	for _, w := range words {
+		if stopwords[w] {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && !strings.HasSuffix(w, "us") && !strings.HasSuffix(w, "is") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		kept = append(kept, w)
+	}
+	return strings.Join(kept, " ")
+}
+
+// Similarity scores two titles from 0 to 1 by the share of their topic
+// words they have in common (Jaccard similarity), so a short title isn't a
+// repeat of every longer one that contains it. Titles are compared whole
+// and by their main part before any subtitle, taking the higher score, so
+// "Bloom Filters" matches "Bloom Filter: Probabilistic Membership".
+func Similarity(a, b string) float64 {
+	return math.Max(overlap(a, b), overlap(mainTitle(a), mainTitle(b)))
+}
+
+func mainTitle(title string) string {
+	if i := strings.Index(title, " - "); i > 0 {
+		title = title[:i]
+	}
+	if i := strings.IndexAny(title, ":–—("); i > 0 {
+		title = title[:i]
+	}
+	return title
+}
+
+func overlap(a, b string) float64 {
+	wa, wb := strings.Fields(Normalize(a)), strings.Fields(Normalize(b))
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	in := make(map[string]bool, len(wb))
+	for _, w := range wb {
+		in[w] = true
+	}
+	seen := make(map[string]bool, len(wa))
+	shared := 0
+	for _, w := range wa {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		if in[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(seen)+len(in)-shared)
+}
+
+// Cosine is the cosine similarity of two vectors, 0 if they differ in
+// length or either is zero.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,73 @@
+package topics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		repeat bool
+	}{
+		// Near duplicates
+		{"Consistent Hashing", "Understanding Consistent Hashing", true},
+		{"Bloom Filters", "Bloom Filter: Probabilistic Membership", true},
+		{"Design a Rate Limiter", "Rate Limiter Design Explained", true},
+		{"The CAP Theorem", "CAP Theorem - A Simple Guide", true},
+		{"Database Sharding vs Partitioning", "Partitioning vs Sharding a Database", true},
+
+		// A short title inside a longer one is not a repeat
+		{"Caching", "Caching Strategies for Microservices", false},
+		{"Load Balancing", "Load Balancing Algorithms: Round Robin to Least Connections", false},
+		{"Raft", "Raft Consensus Leader Election", false},
+		{"Observer Pattern", "Observer Pattern vs Pub/Sub Messaging Queues", false},
+
+		// Different topics
+		{"Consistent Hashing", "Bloom Filters", false},
+		{"Design Instagram's Feed", "Design a Chat Application", false},
+		{"", "Consistent Hashing", false},
+	}
+	for _, tt := range tests {
+		score := Similarity(tt.a, tt.b)
+		if got := score >= 0.75; got != tt.repeat {
+			t.Errorf("Similarity(%q, %q) = %.2f, repeat %v, want %v", tt.a, tt.b, score, got, tt.repeat)
+		}
+		if back := Similarity(tt.b, tt.a); back != score {
+			t.Errorf("Similarity(%q, %q) = %.2f one way and %.2f the other", tt.a, tt.b, score, back)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Understanding Bloom Filters!", "bloom filter"},
+		{"Design a URL Shortener", "url shortener"},
+		{"CAP Theorem: Consistency vs Availability", "cap theorem consistency availability"},
+		{"Thread Pools Explained", "thread pool"},
+		{"Consensus & Replication", "consensus replication"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeduperCheckTitles(t *testing.T) {
+	d := NewDeduper(0.75, nil, 0.85)
+	past := []Past{
+		{ID: "2026-10-16", Title: "Caching Strategies for Microservices"},
+		{ID: "2026-10-17", Title: "Consistent Hashing Explained"},
+	}
+	m, vec, err := d.Check(context.Background(), "Consistent Hashing", past)
+	if err != nil || vec != nil {
+		t.Fatalf("Check = %v, %v", vec, err)
+	}
+	if m == nil || m.ID != "2026-10-17" || m.By != "title" {
+		t.Errorf("match = %v, want issue 2026-10-17 by title", m)
+	}
+	if m, _, _ := d.Check(context.Background(), "Caching", past); m != nil {
+		t.Errorf("Caching repeats %v", m)
+	}
+}
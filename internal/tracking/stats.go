@@ -0,0 +1,31 @@
+package tracking
+
+// Stats summarizes the events of an issue or a subscriber.
+type Stats struct {
+	Opens        int            `json:"opens"`
+	UniqueOpens  int            `json:"unique_opens"`
+	Clicks       int            `json:"clicks"`
+	UniqueClicks int            `json:"unique_clicks"`
+	Links        map[string]int `json:"links"`
+}
+
+// Summarize counts opens and clicks. Unique counts are per subscriber.
+func Summarize(events []Event) Stats {
+	stats := Stats{Links: make(map[string]int)}
+	opened := make(map[string]bool)
+	clicked := make(map[string]bool)
+	for _, e := range events {
+		switch e.Type {
+		case EventOpen:
+			stats.Opens++
+			opened[e.Email] = true
+		case EventClick:
+			stats.Clicks++
+			clicked[e.Email] = true
+			stats.Links[e.URL]++
+		}
+	}
+	stats.UniqueOpens = len(opened)
+	stats.UniqueClicks = len(clicked)
+	return stats
+}
@@ -0,0 +1,123 @@
+package tracking
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FileEventStore appends events to a JSON-lines file.
+type FileEventStore struct {
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewFileEventStore(filePath string) *FileEventStore {
+	return &FileEventStore{filePath: filePath}
+}
+
+func (s *FileEventStore) Record(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+func (s *FileEventStore) ForIssue(issueID string) ([]Event, error) {
+	return s.filter(func(e Event) bool { return e.IssueID == issueID })
+}
+
+func (s *FileEventStore) ForSubscriber(email string) ([]Event, error) {
+	return s.filter(func(e Event) bool { return e.Email == email })
+}
+
+func (s *FileEventStore) filter(match func(Event) bool) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if match(e) {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// MongoEventStore keeps events in the tracking_events collection.
+type MongoEventStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoEventStore(db *mongo.Database) (*MongoEventStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := db.Collection("tracking_events")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "issue_id", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoEventStore{collection: collection}, nil
+}
+
+func (s *MongoEventStore) Record(e Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.collection.InsertOne(ctx, e)
+	return err
+}
+
+func (s *MongoEventStore) ForIssue(issueID string) ([]Event, error) {
+	return s.find(bson.M{"issue_id": issueID})
+}
+
+func (s *MongoEventStore) ForSubscriber(email string) ([]Event, error) {
+	return s.find(bson.M{"email": email})
+}
+
+func (s *MongoEventStore) find(filter bson.M) ([]Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []Event
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
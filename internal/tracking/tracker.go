@@ -0,0 +1,211 @@
+// Package tracking records per-recipient opens (via a 1x1 pixel) and clicks
+// (via signed redirect links) for each issue.
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Event types.
+const (
+	EventOpen  = "open"
+	EventClick = "click"
+)
+
+// Event is a single open or click by a subscriber.
+type Event struct {
+	Type      string    `bson:"type" json:"type"`
+	IssueID   string    `bson:"issue_id" json:"issue_id"`
+	Email     string    `bson:"email" json:"email"`
+	URL       string    `bson:"url,omitempty" json:"url,omitempty"`
+	UserAgent string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	At        time.Time `bson:"at" json:"at"`
+}
+
+// EventStore persists tracking events.
+type EventStore interface {
+	Record(e Event) error
+	ForIssue(issueID string) ([]Event, error)
+	ForSubscriber(email string) ([]Event, error)
+}
+
+var errInvalidToken = errors.New("invalid tracking token")
+
+// tokenOptOut marks tokens that authorize the tracking opt-out link.
+const tokenOptOut = "opt-out"
+
+// transparentGIF is a 1x1 transparent GIF.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(<a\s[^>]*?href\s*=\s*")([^"]*)(")`)
+
+// Tracker instruments outgoing HTML and serves the pixel and redirect
+// endpoints. Tokens are HMAC-signed so the redirect cannot be abused as an
+// open redirect and events cannot be forged.
+type Tracker struct {
+	Secret  []byte
+	BaseURL string
+	Events  EventStore
+
+	// OptedOut, if set, is consulted before recording an event so that a
+	// subscriber who opted out after receiving an issue is not tracked.
+	OptedOut func(email string) bool
+
+	// OnEvent, if set, is called after an event has been recorded.
+	OnEvent func(e Event)
+}
+
+func NewTracker(secret, baseURL string, events EventStore) *Tracker {
+	return &Tracker{
+		Secret:  []byte(secret),
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Events:  events,
+	}
+}
+
+type tokenPayload struct {
+	Type    string `json:"t"`
+	IssueID string `json:"i"`
+	Email   string `json:"e"`
+	URL     string `json:"u,omitempty"`
+}
+
+// Instrument rewrites every http(s) link in body through the click redirect,
+// appends the open pixel and adds an opt-out link for the recipient.
+func (t *Tracker) Instrument(body, issueID, email string) string {
+	body = linkPattern.ReplaceAllStringFunc(body, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		target := html.UnescapeString(parts[2])
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			return m
+		}
+		token := t.sign(tokenPayload{Type: EventClick, IssueID: issueID, Email: email, URL: target})
+		return parts[1] + t.BaseURL + "/r/" + token + parts[3]
+	})
+
+	pixel := fmt.Sprintf(`<img src="%s/t/%s.gif" width="1" height="1" alt="" style="border:0; width:1px; height:1px;">`,
+		t.BaseURL, t.sign(tokenPayload{Type: EventOpen, IssueID: issueID, Email: email}))
+	optOut := fmt.Sprintf(
+		`<p style="font-size: 12px; color: #666; text-align: center;"><a href="%s/tracking/opt-out?token=%s">Stop tracking my opens and clicks</a></p>`,
+		t.BaseURL, url.QueryEscape(t.sign(tokenPayload{Type: tokenOptOut, IssueID: issueID, Email: email})))
+
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + optOut + pixel + body[i:]
+	}
+	return body + optOut + pixel
+}
+
+// OpenHandler serves /t/{token}.gif.
+func (t *Tracker) OpenHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), ".gif")
+		if p, err := t.verify(token); err == nil && p.Type == EventOpen {
+			t.record(r, p)
+		}
+		// Always answer with the pixel so mail clients don't show a broken image
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		w.Write(transparentGIF)
+	})
+}
+
+// ClickHandler serves /r/{token}: it records the click and redirects to the
+// original link.
+func (t *Tracker) ClickHandler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := t.verify(strings.TrimPrefix(r.URL.Path, prefix))
+		if err != nil || p.Type != EventClick {
+			http.NotFound(w, r)
+			return
+		}
+		t.record(r, p)
+		http.Redirect(w, r, p.URL, http.StatusFound)
+	})
+}
+
+// OptOutHandler serves the opt-out link added by Instrument. The link is
+// signed like the pixel and redirects, so nobody can switch off tracking for
+// an address they don't receive mail at.
+func (t *Tracker) OptOutHandler(optOut func(email string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := t.verify(r.URL.Query().Get("token"))
+		if err != nil || p.Type != tokenOptOut {
+			http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+			return
+		}
+		if err := optOut(p.Email); err != nil {
+			log.Printf("Failed to update tracking preference: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>Tracking disabled</h1><p>Opens and clicks are no longer tracked for %s.</p>", html.EscapeString(p.Email))
+		log.Printf("Tracking opt-out: %s", p.Email)
+	})
+}
+
+func (t *Tracker) record(r *http.Request, p *tokenPayload) {
+	if t.OptedOut != nil && t.OptedOut(p.Email) {
+		return
+	}
+	e := Event{
+		Type:      p.Type,
+		IssueID:   p.IssueID,
+		Email:     p.Email,
+		URL:       p.URL,
+		UserAgent: r.UserAgent(),
+		At:        time.Now(),
+	}
+	if err := t.Events.Record(e); err != nil {
+		log.Printf("Failed to record %s event for %s: %v", e.Type, e.Email, err)
+		return
+	}
+	if t.OnEvent != nil {
+		t.OnEvent(e)
+	}
+}
+
+func (t *Tracker) sign(p tokenPayload) string {
+	data, _ := json.Marshal(p)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + t.mac(payload)
+}
+
+func (t *Tracker) verify(token string) (*tokenPayload, error) {
+	payload, mac, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(t.mac(payload))) {
+		return nil, errInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var p tokenPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errInvalidToken
+	}
+	return &p, nil
+}
+
+func (t *Tracker) mac(payload string) string {
+	h := hmac.New(sha256.New, t.Secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
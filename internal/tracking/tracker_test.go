@@ -0,0 +1,50 @@
+package tracking
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestOptOutRequiresSignedLink(t *testing.T) {
+	tr := NewTracker("secret", "https://news.example.com", nil)
+	var optedOut []string
+	h := tr.OptOutHandler(func(email string) error {
+		optedOut = append(optedOut, email)
+		return nil
+	})
+
+	body := tr.Instrument("<html><body><p>Hi</p></body></html>", "2026-10-18", "jane@example.org")
+	m := regexp.MustCompile(`https://news\.example\.com(/tracking/opt-out\?token=[^"]+)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no opt-out link in %s", body)
+	}
+
+	for _, target := range []string{
+		"/tracking/opt-out?email=jane@example.org",
+		"/tracking/opt-out?token=forged",
+		// A click token is signed but not for opting out
+		"/tracking/opt-out?token=" + tr.sign(tokenPayload{Type: EventClick, Email: "jane@example.org", URL: "https://x"}),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, rec.Code)
+		}
+	}
+	if len(optedOut) != 0 {
+		t.Fatalf("opted out %v without a valid token", optedOut)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, m[1], nil))
+	if rec.Code != http.StatusOK || len(optedOut) != 1 || optedOut[0] != "jane@example.org" {
+		t.Errorf("signed link: status %d, opted out %v", rec.Code, optedOut)
+	}
+
+	other := NewTracker("other", "https://news.example.com", nil)
+	rec = httptest.NewRecorder()
+	other.OptOutHandler(func(string) error { t.Error("accepted a token signed with another secret"); return nil }).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, m[1], nil))
+}